@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rizome-dev/go-moonshot"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func init() {
+	commands["ask"] = command{summary: "Send a single prompt and print the answer", run: runAsk}
+}
+
+func runAsk(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "ask", "[flags] [prompt...] [-]")
+	cf := addClientFlags(fs)
+	model := cf.addModelFlag(fs, "model to ask")
+	system := fs.String("system", "", "system prompt")
+	temperature := fs.Float64("temperature", -1, "sampling temperature (default: the API default)")
+	maxTokens := fs.Int("max-tokens", 0, "maximum tokens in the answer (default: the API default)")
+	jsonOut := fs.Bool("json", false, "print the full response as JSON instead of streaming the answer")
+	schemaArg := fs.String("schema", "", "JSON schema the answer must follow, inline or as a file path")
+	keepFiles := fs.Bool("keep-files", false, "keep attached files on the server after answering")
+	var attachments []string
+	fs.Func("f", "attach a file; may be repeated", func(path string) error {
+		attachments = append(attachments, path)
+		return nil
+	})
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	prompt, err := readPrompt(e.stdin, fs.Args())
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		return usagef("no prompt given as arguments or on stdin (use - to add stdin to arguments)")
+	}
+
+	var schema map[string]any
+	if *schemaArg != "" {
+		if schema, err = loadSchema(*schemaArg); err != nil {
+			return err
+		}
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+
+	var messages []types.Message
+	if *system != "" {
+		messages = append(messages, types.Message{Role: "system", Content: *system})
+	}
+	for _, path := range attachments {
+		content, err := extractFile(ctx, sdk, path, *keepFiles)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, types.Message{Role: "system", Content: content})
+	}
+	if schema != nil {
+		messages = append(messages, types.Message{Role: "system", Content: schemaInstruction(schema)})
+	}
+	messages = append(messages, types.Message{Role: "user", Content: prompt})
+
+	req := types.ChatCompletionRequest{
+		Model:    *model,
+		Messages: messages,
+	}
+	if *temperature >= 0 {
+		req.Temperature = temperature
+	}
+	if *maxTokens > 0 {
+		req.MaxTokens = maxTokens
+	}
+	if schema != nil {
+		req.ResponseFormat = map[string]string{"type": "json_object"}
+	}
+
+	var answer string
+	if *jsonOut || schema != nil {
+		resp, err := sdk.Chat.CreateCompletion(ctx, req)
+		if err != nil {
+			return err
+		}
+		answer = chatContent(resp)
+		if schema != nil {
+			if err := checkSchema(answer, schema); err != nil {
+				fmt.Fprintln(e.stdout, answer)
+				return err
+			}
+		}
+		if *jsonOut {
+			return printJSON(e.stdout, resp)
+		}
+		fmt.Fprintln(e.stdout, answer)
+		return nil
+	}
+
+	stream, err := sdk.Chat.CreateCompletionStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	for delta, err := range stream.Deltas() {
+		if err != nil {
+			fmt.Fprintln(e.stdout)
+			return err
+		}
+		fmt.Fprint(e.stdout, delta.Content)
+	}
+	fmt.Fprintln(e.stdout)
+	return nil
+}
+
+// readPrompt builds the prompt from the arguments and standard input.
+// Standard input is read when there are no arguments and it is piped, or
+// when an argument is "-"; it follows the arguments, separated by a blank
+// line, so "git diff | moonshot ask review this -" works. Otherwise stdin is
+// left alone, so a script with an open but idle stdin does not hang.
+func readPrompt(stdin io.Reader, args []string) (string, error) {
+	readStdin := len(args) == 0 && isPiped(stdin)
+	var words []string
+	for _, arg := range args {
+		if arg == "-" {
+			readStdin = true
+			continue
+		}
+		words = append(words, arg)
+	}
+	prompt := strings.Join(words, " ")
+	if !readStdin {
+		return prompt, nil
+	}
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("reading stdin: %w", err)
+	}
+	input := strings.TrimSpace(string(data))
+	switch {
+	case input == "":
+		return prompt, nil
+	case prompt == "":
+		return input, nil
+	default:
+		return prompt + "\n\n" + input, nil
+	}
+}
+
+// isPiped reports whether r is something other than an interactive terminal
+func isPiped(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return true
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// extractFile uploads path for extraction and returns the extracted text
+func extractFile(ctx context.Context, sdk *moonshot.SDK, path string, keep bool) (string, error) {
+	file, err := sdk.Files.UploadFile(ctx, path, "file-extract")
+	if err != nil {
+		return "", fmt.Errorf("uploading %s: %w", path, err)
+	}
+	if !keep {
+		defer sdk.Files.Delete(context.WithoutCancel(ctx), file.ID)
+	}
+
+	content, err := sdk.Files.GetContent(ctx, file.ID)
+	if err != nil {
+		return "", fmt.Errorf("extracting %s: %w", path, err)
+	}
+	return string(content), nil
+}
+
+// loadSchema reads a JSON schema given inline or as a file path
+func loadSchema(arg string) (map[string]any, error) {
+	data := []byte(arg)
+	if !strings.HasPrefix(strings.TrimSpace(arg), "{") {
+		var err error
+		if data, err = os.ReadFile(arg); err != nil {
+			return nil, fmt.Errorf("reading schema: %w", err)
+		}
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, usagef("invalid schema %s: %v", filepath.Base(arg), err)
+	}
+	return schema, nil
+}
+
+// schemaInstruction asks the model to answer with JSON following schema
+func schemaInstruction(schema map[string]any) string {
+	data, _ := json.MarshalIndent(schema, "", "  ")
+	return "Answer only with a JSON object that validates against this JSON schema:\n" + string(data)
+}
+
+// checkSchema checks that answer is a JSON object of the type schema
+// describes with the properties it requires
+func checkSchema(answer string, schema map[string]any) error {
+	var value any
+	dec := json.NewDecoder(bytes.NewReader([]byte(answer)))
+	if err := dec.Decode(&value); err != nil {
+		return outputError{msg: fmt.Sprintf("answer is not valid JSON: %v", err)}
+	}
+
+	if typ, _ := schema["type"].(string); typ == "object" {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return outputError{msg: "answer is not a JSON object"}
+		}
+		required, _ := schema["required"].([]any)
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := obj[name]; !ok {
+				return outputError{msg: fmt.Sprintf("answer is missing required property %q", name)}
+			}
+		}
+	}
+	return nil
+}
+
+// chatContent returns the text of the first choice of resp
+func chatContent(resp *types.ChatCompletionResponse) string {
+	if len(resp.Choices) == 0 {
+		return ""
+	}
+	content, _ := resp.Choices[0].Message.Content.(string)
+	return content
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func TestAsk(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	api := []string{"-base-url", srv.URL, "-api-key", "sk-test"}
+
+	t.Run("prompt from arguments", func(t *testing.T) {
+		stdout, stderr, code := runCLI(t, "", append(append([]string{"ask"}, api...), "What", "is", "Go?")...)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		if stdout != "echo: What is Go?\n" {
+			t.Errorf("stdout = %q", stdout)
+		}
+	})
+
+	t.Run("prompt and stdin", func(t *testing.T) {
+		_, stderr, code := runCLI(t, "func main() {}\n", append(append([]string{"ask"}, api...), "Review this", "-")...)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		last := srv.LastChatRequest(t)
+		if got := last.Messages[0].Content; got != "Review this\n\nfunc main() {}" {
+			t.Errorf("prompt = %q", got)
+		}
+	})
+
+	t.Run("stdin only", func(t *testing.T) {
+		_, stderr, code := runCLI(t, "Hello\n", append([]string{"ask"}, api...)...)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		if got := srv.LastChatRequest(t).Messages[0].Content; got != "Hello" {
+			t.Errorf("prompt = %q", got)
+		}
+	})
+
+	t.Run("stdin ignored with arguments", func(t *testing.T) {
+		_, stderr, code := runCLI(t, "unrelated input\n", append(append([]string{"ask"}, api...), "Hi")...)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		if got := srv.LastChatRequest(t).Messages[0].Content; got != "Hi" {
+			t.Errorf("prompt = %q", got)
+		}
+	})
+
+	t.Run("no prompt", func(t *testing.T) {
+		_, _, code := runCLI(t, "", append([]string{"ask"}, api...)...)
+		if code != exitUsage {
+			t.Errorf("exit code = %d, want %d", code, exitUsage)
+		}
+	})
+
+	t.Run("attached file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "notes.txt")
+		os.WriteFile(path, []byte("The launch is on Tuesday."), 0o644)
+
+		_, stderr, code := runCLI(t, "", append(append([]string{"ask"}, api...), "-f", path, "When is the launch?")...)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		last := srv.LastChatRequest(t)
+		if len(last.Messages) != 2 || last.Messages[0].Role != "system" || !strings.Contains(last.Messages[0].Content.(string), "Tuesday") {
+			t.Errorf("messages = %+v", last.Messages)
+		}
+		// The upload is removed afterwards
+		list, err := srv.SDK().Files.List(context.Background(), nil)
+		if err != nil || len(list.Data) != 0 {
+			t.Errorf("files left on the server = %+v, %v", list, err)
+		}
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		stdout, stderr, code := runCLI(t, "", append(append([]string{"ask"}, api...), "-json", "Hi")...)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		var resp types.ChatCompletionResponse
+		if err := json.Unmarshal([]byte(stdout), &resp); err != nil {
+			t.Fatalf("stdout is not a response: %v\n%s", err, stdout)
+		}
+		if resp.Choices[0].Message.Content != "echo: Hi" || resp.Usage.TotalTokens == 0 {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		schema := `{"type":"object","required":["city"]}`
+
+		srv.EnqueueReply(moonshottest.Reply{Content: `{"city":"Paris"}`})
+		stdout, stderr, code := runCLI(t, "", append(append([]string{"ask"}, api...), "-schema", schema, "Capital of France?")...)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		if strings.TrimSpace(stdout) != `{"city":"Paris"}` {
+			t.Errorf("stdout = %q", stdout)
+		}
+		if format, _ := srv.LastChatRequest(t).ResponseFormat.(map[string]any); format["type"] != "json_object" {
+			t.Errorf("response_format = %v", srv.LastChatRequest(t).ResponseFormat)
+		}
+
+		srv.EnqueueReply(moonshottest.Reply{Content: `{"country":"France"}`})
+		_, stderr, code = runCLI(t, "", append(append([]string{"ask"}, api...), "-schema", schema, "Capital of France?")...)
+		if code != exitBadOutput || !strings.Contains(stderr, `missing required property "city"`) {
+			t.Errorf("exit code = %d, stderr = %s", code, stderr)
+		}
+	})
+}
+
+func TestAsk_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault moonshottest.Fault
+		want  int
+	}{
+		{name: "authentication", fault: moonshottest.Fault{Status: http.StatusUnauthorized, Type: "invalid_authentication_error"}, want: exitAuth},
+		{name: "rate limited", fault: moonshottest.RateLimited(0), want: exitRateLimited},
+		{name: "quota", fault: moonshottest.Fault{Status: http.StatusTooManyRequests, Type: errors.ErrTypeQuotaExceeded}, want: exitQuota},
+		{name: "invalid request", fault: moonshottest.Fault{Status: http.StatusBadRequest, Type: "invalid_request_error"}, want: exitInvalid},
+		{name: "server error", fault: moonshottest.ServerError(), want: exitServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := moonshottest.NewServer()
+			defer srv.Close()
+			srv.InjectFault(tt.fault)
+
+			_, _, code := runCLI(t, "", "ask", "-base-url", srv.URL, "-api-key", "sk-test", "Hi")
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
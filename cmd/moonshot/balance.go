@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+func init() {
+	commands["balance"] = command{summary: "Show the account balance", run: runBalance}
+}
+
+func runBalance(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "balance", "[flags]")
+	cf := addClientFlags(fs)
+	jsonOut := fs.Bool("json", false, "print the balance as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments %q", fs.Args())
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	balance, err := sdk.Balance.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return printJSON(e.stdout, balance)
+	}
+
+	tw := newTable(e.stdout)
+	fmt.Fprintf(tw, "Available:\t%.2f\n", balance.AvailableBalance)
+	fmt.Fprintf(tw, "Voucher:\t%.2f\n", balance.VoucherBalance)
+	fmt.Fprintf(tw, "Cash:\t%.2f\n", balance.CashBalance)
+	return tw.Flush()
+}
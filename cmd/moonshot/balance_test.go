@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func TestBalance(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	srv.SetBalance(types.Balance{AvailableBalance: 49.58, VoucherBalance: 46.58, CashBalance: 3})
+
+	stdout, stderr, code := runCLI(t, "", "balance", "-base-url", srv.URL, "-api-key", "sk-test")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	for _, want := range []string{"Available:  49.58", "Voucher:    46.58", "Cash:       3.00"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout does not contain %q:\n%s", want, stdout)
+		}
+	}
+
+	t.Setenv("MOONSHOT_API_KEY", "")
+	if _, _, code := runCLI(t, "", "balance", "-base-url", srv.URL); code != exitAuth {
+		t.Errorf("without API key: exit code = %d, want %d", code, exitAuth)
+	}
+}
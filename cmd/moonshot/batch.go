@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/batch"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+)
+
+func init() {
+	commands["batch"] = command{summary: "Run chat completions from a JSONL file and report on the results", run: runBatch}
+}
+
+// batchCommands are the subcommands of "moonshot batch"
+var batchCommands = map[string]func(ctx context.Context, e *env, args []string) error{
+	"run":    runBatchRun,
+	"report": runBatchReport,
+}
+
+const batchUsage = "run|report [flags] [args]"
+
+func runBatch(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: moonshot batch %s", batchUsage)
+	}
+	run, ok := batchCommands[args[0]]
+	if !ok {
+		return usagef("unknown batch command %q; want one of %s", args[0], batchUsage)
+	}
+	return run(ctx, e, args[1:])
+}
+
+func runBatchRun(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "batch run", "input.jsonl -o output.jsonl [flags]")
+	cf := addClientFlags(fs)
+	output := fs.String("o", "", "output file; results already in it are skipped (required)")
+	concurrency := fs.Int("concurrency", 4, "number of requests in flight")
+	restart := fs.Bool("restart", false, "discard the results in the output file instead of resuming")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usagef("want exactly one input file")
+	}
+	if *output == "" {
+		return usagef("no output file given with -o")
+	}
+	input := positional[0]
+
+	if *restart {
+		if err := os.Remove(*output); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing output: %w", err)
+		}
+	}
+
+	total, err := countLines(input)
+	if err != nil {
+		return err
+	}
+	done, err := batch.CompletedIDs(*output)
+	if err != nil {
+		return err
+	}
+	if len(done) > 0 {
+		fmt.Fprintf(e.stderr, "resuming: %d requests already completed\n", len(done))
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	progress := newBatchProgress(e.stderr, max(total-len(done), 0))
+	runner := batch.NewRunner(sdk.Chat, batch.Options{
+		Concurrency: *concurrency,
+		OnResult:    progress.add,
+	})
+
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	summary, err := runner.RunFile(runCtx, input, *output)
+	progress.finish()
+	if summary != nil {
+		fmt.Fprintf(e.stderr, "%d requests in %s: %d succeeded, %d failed, %d skipped; %d tokens, $%.4f\n",
+			summary.Total, summary.Duration.Round(time.Millisecond), summary.Succeeded, summary.Failed,
+			summary.Skipped, summary.Usage.TotalTokens, summary.Cost)
+	}
+	switch {
+	case errors.Is(err, context.Canceled) && ctx.Err() == nil:
+		return errors.New("interrupted; run the same command again to resume")
+	case err != nil:
+		return err
+	case summary.Failed > 0:
+		return fmt.Errorf("%d of %d requests failed; run the same command again to retry them", summary.Failed, summary.Total)
+	}
+	return nil
+}
+
+// countLines returns the number of non-blank lines in the file at path
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("opening input: %w", err)
+	}
+	defer f.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			n++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("reading input: %w", err)
+	}
+	return n, nil
+}
+
+// batchProgress keeps a live progress line on a terminal
+type batchProgress struct {
+	w       io.Writer
+	live    bool
+	total   int
+	start   time.Time
+	drawn   time.Time
+	done    int
+	failed  int
+	tokens  int
+	cost    float64
+	pending bool
+}
+
+func newBatchProgress(w io.Writer, total int) *batchProgress {
+	return &batchProgress{w: w, live: isTerminal(w), total: total, start: time.Now()}
+}
+
+// add records a result. The runner serialises calls.
+func (p *batchProgress) add(res batch.Result) {
+	p.done++
+	if !res.Succeeded() {
+		p.failed++
+	} else {
+		u := res.Response.Usage
+		p.tokens += u.TotalTokens
+		if price, ok := models.Model(res.Model).Pricing(); ok {
+			p.cost += price.Cost(u.PromptTokens, u.CachedTokens, u.CompletionTokens)
+		}
+	}
+	p.pending = true
+	if time.Since(p.drawn) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+func (p *batchProgress) draw() {
+	if !p.live {
+		return
+	}
+	p.drawn = time.Now()
+	p.pending = false
+	fmt.Fprintf(p.w, "\r\033[K%s", p.line())
+}
+
+// line formats the current progress
+func (p *batchProgress) line() string {
+	rate := float64(p.done) / time.Since(p.start).Seconds()
+	return fmt.Sprintf("%d/%d done, %d failed, %.1f req/s, %d tokens, $%.4f", p.done, p.total, p.failed, rate, p.tokens, p.cost)
+}
+
+// finish draws the final state and ends the progress line
+func (p *batchProgress) finish() {
+	if !p.live || p.done == 0 {
+		return
+	}
+	if p.pending {
+		p.draw()
+	}
+	fmt.Fprintln(p.w)
+}
+
+func runBatchReport(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "batch report", "output.jsonl [flags]")
+	jsonOut := fs.Bool("json", false, "print the report as JSON")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usagef("want exactly one results file")
+	}
+
+	f, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	results, err := batch.ReadResults(f)
+	if err != nil {
+		return err
+	}
+
+	report := newBatchReport(results)
+	if *jsonOut {
+		return printJSON(e.stdout, report)
+	}
+	report.print(e.stdout)
+	return nil
+}
+
+// batchReport summarises the results of a batch run
+type batchReport struct {
+	Requests      int            `json:"requests"`
+	Succeeded     int            `json:"succeeded"`
+	Failed        int            `json:"failed"`
+	Latency       latencyStats   `json:"latency"`
+	FinishReasons map[string]int `json:"finish_reasons"`
+	Errors        map[string]int `json:"errors"`
+	Models        []modelReport  `json:"models"`
+}
+
+// modelReport summarises the results for one model
+type modelReport struct {
+	Model            string       `json:"model"`
+	Requests         int          `json:"requests"`
+	Failed           int          `json:"failed"`
+	PromptTokens     int          `json:"prompt_tokens"`
+	CachedTokens     int          `json:"cached_tokens"`
+	CompletionTokens int          `json:"completion_tokens"`
+	TotalTokens      int          `json:"total_tokens"`
+	Cost             float64      `json:"cost"`
+	Latency          latencyStats `json:"latency"`
+}
+
+// latencyStats are latency percentiles in milliseconds
+type latencyStats struct {
+	P50 int64 `json:"p50_ms"`
+	P90 int64 `json:"p90_ms"`
+	P99 int64 `json:"p99_ms"`
+	Max int64 `json:"max_ms"`
+}
+
+func newBatchReport(results []batch.Result) *batchReport {
+	r := &batchReport{
+		FinishReasons: map[string]int{},
+		Errors:        map[string]int{},
+	}
+	var all []int64
+	byModel := map[string]*modelReport{}
+	latencies := map[string][]int64{}
+	for _, res := range results {
+		r.Requests++
+		all = append(all, res.LatencyMS)
+
+		model := res.Model
+		if model == "" {
+			model = "-"
+		}
+		m := byModel[model]
+		if m == nil {
+			m = &modelReport{Model: model}
+			byModel[model] = m
+		}
+		m.Requests++
+		latencies[model] = append(latencies[model], res.LatencyMS)
+
+		if !res.Succeeded() {
+			r.Failed++
+			m.Failed++
+			r.Errors[errorKey(res.Error)]++
+			continue
+		}
+		r.Succeeded++
+		for _, choice := range res.Response.Choices {
+			reason := choice.FinishReason
+			if reason == "" {
+				reason = "-"
+			}
+			r.FinishReasons[reason]++
+		}
+		u := res.Response.Usage
+		m.PromptTokens += u.PromptTokens
+		m.CachedTokens += u.CachedTokens
+		m.CompletionTokens += u.CompletionTokens
+		m.TotalTokens += u.TotalTokens
+		if price, ok := models.Model(res.Model).Pricing(); ok {
+			m.Cost += price.Cost(u.PromptTokens, u.CachedTokens, u.CompletionTokens)
+		}
+	}
+
+	r.Latency = newLatencyStats(all)
+	for name, m := range byModel {
+		m.Latency = newLatencyStats(latencies[name])
+		r.Models = append(r.Models, *m)
+	}
+	sort.Slice(r.Models, func(i, j int) bool { return r.Models[i].Model < r.Models[j].Model })
+	return r
+}
+
+// errorKey names the category of a failed result
+func errorKey(e *batch.ResultError) string {
+	switch {
+	case e == nil:
+		return "no_response"
+	case e.Code != "":
+		return e.Code
+	case e.Type != "":
+		return e.Type
+	case e.StatusCode != 0:
+		return fmt.Sprintf("http_%d", e.StatusCode)
+	}
+	return "unknown"
+}
+
+// newLatencyStats computes nearest-rank percentiles of ms
+func newLatencyStats(ms []int64) latencyStats {
+	if len(ms) == 0 {
+		return latencyStats{}
+	}
+	sorted := append([]int64(nil), ms...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return latencyStats{
+		P50: percentile(sorted, 50),
+		P90: percentile(sorted, 90),
+		P99: percentile(sorted, 99),
+		Max: sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted
+func percentile[T cmp.Ordered](sorted []T, p float64) T {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func (r *batchReport) print(w io.Writer) {
+	fmt.Fprintf(w, "Requests: %d (%d succeeded, %d failed)\n", r.Requests, r.Succeeded, r.Failed)
+	fmt.Fprintf(w, "Latency:  p50 %s  p90 %s  p99 %s  max %s\n\n",
+		formatMS(r.Latency.P50), formatMS(r.Latency.P90), formatMS(r.Latency.P99), formatMS(r.Latency.Max))
+
+	tw := newTable(w)
+	fmt.Fprintln(tw, "MODEL\tREQUESTS\tFAILED\tPROMPT\tCACHED\tCOMPLETION\tCOST\tP50\tP90\tP99")
+	for _, m := range r.Models {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t$%.4f\t%s\t%s\t%s\n", m.Model, m.Requests, m.Failed,
+			m.PromptTokens, m.CachedTokens, m.CompletionTokens, m.Cost,
+			formatMS(m.Latency.P50), formatMS(m.Latency.P90), formatMS(m.Latency.P99))
+	}
+	tw.Flush()
+
+	printCounts(w, "FINISH REASON", r.FinishReasons)
+	printCounts(w, "ERROR", r.Errors)
+}
+
+// printCounts prints a table of counts, most frequent first
+func printCounts(w io.Writer, heading string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintln(w)
+	tw := newTable(w)
+	fmt.Fprintf(tw, "%s\tCOUNT\n", heading)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%d\n", k, counts[k])
+	}
+	tw.Flush()
+}
+
+// formatMS formats a latency in milliseconds
+func formatMS(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/batch"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+const batchInput = `{"custom_id":"a","body":{"model":"kimi-k2-0905-preview","messages":[{"role":"user","content":"one"}]}}
+{"custom_id":"b","model":"moonshot-v1-8k","messages":[{"role":"user","content":"long"}]}
+
+not json
+`
+
+func TestBatch(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	srv.SetReplyFunc(func(req types.ChatCompletionRequest) moonshottest.Reply {
+		reply := moonshottest.EchoReply(req)
+		if strings.HasSuffix(reply.Content, "long") {
+			reply.FinishReason = "length"
+		}
+		return reply
+	})
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.jsonl")
+	output := filepath.Join(dir, "out.jsonl")
+	if err := os.WriteFile(input, []byte(batchInput), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	api := []string{"-base-url", srv.URL, "-api-key", "sk-test"}
+
+	_, stderr, code := runCLI(t, "", append([]string{"batch", "run", input, "-o", output, "-concurrency", "2"}, api...)...)
+	if code != exitError || !strings.Contains(stderr, "3 requests in") || !strings.Contains(stderr, "1 of 3 requests failed") {
+		t.Fatalf("run: exit code = %d, stderr = %s", code, stderr)
+	}
+	srv.AssertRequestCount(t, "/chat/completions", 2)
+
+	t.Run("resume", func(t *testing.T) {
+		_, stderr, code := runCLI(t, "", append([]string{"batch", "run", "-o", output, input}, api...)...)
+		if code != exitError || !strings.Contains(stderr, "resuming: 2 requests already completed") || !strings.Contains(stderr, "2 skipped") {
+			t.Errorf("exit code = %d, stderr = %s", code, stderr)
+		}
+		srv.AssertRequestCount(t, "/chat/completions", 2)
+	})
+
+	t.Run("report", func(t *testing.T) {
+		stdout, stderr, code := runCLI(t, "", "batch", "report", output)
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		for _, want := range []string{"Requests: 3 (2 succeeded, 1 failed)", "kimi-k2-0905-preview", "moonshot-v1-8k", "length", "invalid_line"} {
+			if !strings.Contains(stdout, want) {
+				t.Errorf("report does not contain %q:\n%s", want, stdout)
+			}
+		}
+
+		stdout, _, _ = runCLI(t, "", "batch", "report", "-json", output)
+		var report batchReport
+		if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+			t.Fatalf("decoding report: %v", err)
+		}
+		if report.FinishReasons["stop"] != 1 || report.FinishReasons["length"] != 1 || report.Errors["invalid_line"] != 1 || len(report.Models) != 3 {
+			t.Errorf("report = %+v", report)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		if _, _, code := runCLI(t, "", "batch", "run", input); code != exitUsage {
+			t.Errorf("missing -o: exit code = %d, want %d", code, exitUsage)
+		}
+		if _, _, code := runCLI(t, "", "batch", "nope"); code != exitUsage {
+			t.Errorf("unknown subcommand: exit code = %d, want %d", code, exitUsage)
+		}
+	})
+}
+
+func TestNewBatchReport(t *testing.T) {
+	var results []batch.Result
+	for i := 1; i <= 100; i++ {
+		results = append(results, batch.Result{
+			CustomID:  "r",
+			Model:     "moonshot-v1-8k",
+			LatencyMS: int64(i),
+			Response: &types.ChatCompletionResponse{
+				Choices: []types.Choice{{FinishReason: "stop"}},
+				Usage:   types.Usage{PromptTokens: 10_000, CompletionTokens: 10_000, TotalTokens: 20_000},
+			},
+		})
+	}
+	results = append(results, batch.Result{Model: "moonshot-v1-8k", LatencyMS: 500, Error: &batch.ResultError{StatusCode: 502}})
+
+	report := newBatchReport(results)
+	if report.Latency != (latencyStats{P50: 51, P90: 91, P99: 100, Max: 500}) {
+		t.Errorf("latency = %+v", report.Latency)
+	}
+	if report.Errors["http_502"] != 1 {
+		t.Errorf("errors = %v", report.Errors)
+	}
+	m := report.Models[0]
+	if m.Requests != 101 || m.Failed != 1 || m.TotalTokens != 2_000_000 || m.Cost < 2.19 || m.Cost > 2.21 {
+		t.Errorf("model report = %+v", m)
+	}
+}
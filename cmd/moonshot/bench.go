@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/batch"
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	apierrors "github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func init() {
+	commands["bench"] = command{summary: "Measure throughput and latency of chat completions", run: runBench}
+}
+
+// benchRequest is an entry of a request mix
+type benchRequest struct {
+	weight int
+	req    types.ChatCompletionRequest
+}
+
+// benchSample is the measurement of one request
+type benchSample struct {
+	ttft             time.Duration
+	latency          time.Duration
+	promptTokens     int
+	completionTokens int
+	err              string
+}
+
+func runBench(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "bench", "[flags]")
+	cf := addClientFlags(fs)
+	concurrency := fs.Int("concurrency", 4, "number of requests in flight")
+	total := fs.Int("n", 100, "number of requests to send; 0 runs until -duration")
+	duration := fs.Duration("duration", 0, "stop after this long (default: when -n requests are done)")
+	mixPath := fs.String("mix", "", "JSONL file of requests to send, optionally weighted with a \"weight\" field")
+	model := cf.addModelFlag(fs, "model for the default request")
+	prompt := fs.String("prompt", "Write a haiku about the moon.", "prompt for the default request")
+	maxTokens := fs.Int("max-tokens", 64, "maximum tokens of the default request's answer")
+	stream := fs.Bool("stream", true, "stream responses, which is needed to measure time to first token")
+	fake := fs.Bool("fake", false, "run against an in-process fake API to measure SDK overhead")
+	fakeDelay := fs.Duration("fake-delay", 0, "time to first token of the fake API")
+	jsonOut := fs.Bool("json", false, "print the results as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments %q", fs.Args())
+	}
+	if *total <= 0 && *duration <= 0 {
+		return usagef("-n or -duration must be positive")
+	}
+
+	if *fake {
+		srv := moonshottest.NewServer()
+		defer srv.Close()
+		if *fakeDelay > 0 {
+			srv.InjectFault(moonshottest.Fault{Path: "/chat/completions", Times: -1, Delay: *fakeDelay})
+		}
+		cf.apiKey, cf.baseURL = moonshottest.APIKey, srv.URL
+	}
+	// Measure the API as it is; retries would hide errors and skew latency
+	sdk, err := cf.sdk(client.WithRetryPolicy(client.RetryPolicy{}))
+	if err != nil {
+		return err
+	}
+	s := sdk.Chat
+
+	mix := []benchRequest{{weight: 1, req: types.ChatCompletionRequest{
+		Model:     *model,
+		Messages:  []types.Message{{Role: "user", Content: *prompt}},
+		MaxTokens: maxTokens,
+	}}}
+	if *mixPath != "" {
+		if mix, err = loadBenchMix(*mixPath); err != nil {
+			return err
+		}
+	}
+
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, *duration)
+		defer cancel()
+	}
+
+	progress := newBenchProgress(e.stderr)
+	start := time.Now()
+	samples := driveBench(runCtx, *concurrency, *total, mix, func(ctx context.Context, req types.ChatCompletionRequest) benchSample {
+		sample := benchRequestOnce(ctx, s, req, *stream)
+		progress.add(sample)
+		return sample
+	})
+	elapsed := time.Since(start)
+	progress.finish()
+
+	report := newBenchReport(samples, elapsed, *concurrency)
+	if *jsonOut {
+		return printJSON(e.stdout, report)
+	}
+	report.print(e.stdout)
+	return nil
+}
+
+// driveBench sends requests drawn from mix with concurrency workers until
+// total requests are done (if positive) or ctx is done. Requests cut off by
+// ctx are not part of the results.
+func driveBench(ctx context.Context, concurrency, total int, mix []benchRequest, send func(context.Context, types.ChatCompletionRequest) benchSample) []benchSample {
+	weights := 0
+	for _, m := range mix {
+		weights += m.weight
+	}
+	pick := func() types.ChatCompletionRequest {
+		n := rand.IntN(weights)
+		for _, m := range mix {
+			if n < m.weight {
+				return m.req
+			}
+			n -= m.weight
+		}
+		return mix[len(mix)-1].req
+	}
+
+	var (
+		mu      sync.Mutex
+		samples []benchSample
+		wg      sync.WaitGroup
+	)
+	jobs := make(chan types.ChatCompletionRequest)
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				sample := send(ctx, req)
+				if ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				samples = append(samples, sample)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for i := 0; total <= 0 || i < total; i++ {
+		select {
+		case jobs <- pick():
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return samples
+}
+
+// benchRequestOnce sends req and measures it
+func benchRequestOnce(ctx context.Context, s *chat.Service, req types.ChatCompletionRequest, stream bool) benchSample {
+	start := time.Now()
+	var sample benchSample
+	if !stream {
+		resp, err := s.CreateCompletion(ctx, req)
+		sample.latency = time.Since(start)
+		sample.ttft = sample.latency
+		if err != nil {
+			sample.err = benchErrorKey(err)
+			return sample
+		}
+		sample.promptTokens, sample.completionTokens = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+		return sample
+	}
+
+	sr, err := s.CreateCompletionStream(ctx, req)
+	if err != nil {
+		sample.latency = time.Since(start)
+		sample.err = benchErrorKey(err)
+		return sample
+	}
+	defer sr.Close()
+	acc := sr.Accumulated()
+	for {
+		chunk, err := sr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sample.latency = time.Since(start)
+			sample.err = benchErrorKey(err)
+			return sample
+		}
+		if sample.ttft == 0 && hasToken(chunk) {
+			sample.ttft = time.Since(start)
+		}
+	}
+	sample.latency = time.Since(start)
+	if sample.ttft == 0 {
+		sample.ttft = sample.latency
+	}
+	if usage := acc.Usage(); usage != nil {
+		sample.promptTokens, sample.completionTokens = usage.PromptTokens, usage.CompletionTokens
+	}
+	return sample
+}
+
+// hasToken reports whether chunk carries generated output
+func hasToken(chunk *types.ChatCompletionStream) bool {
+	for _, c := range chunk.Choices {
+		d := c.Delta
+		if (d.Content != nil && *d.Content != "") || (d.ReasoningContent != nil && *d.ReasoningContent != "") || len(d.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// benchErrorKey names the category of a failed request
+func benchErrorKey(err error) string {
+	var apiErr apierrors.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return errorKey(&batch.ResultError{Code: apiErr.Code, Type: apiErr.Type, StatusCode: apiErr.StatusCode})
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "client_error"
+}
+
+// loadBenchMix reads a request mix: one request per line, in the batch
+// input format, with an optional positive "weight" (default 1)
+func loadBenchMix(path string) ([]benchRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mix []benchRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var envelope struct {
+			Weight *int            `json:"weight"`
+			Body   json.RawMessage `json:"body"`
+		}
+		if err := json.Unmarshal(line, &envelope); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		entry := benchRequest{weight: 1}
+		if envelope.Weight != nil {
+			if *envelope.Weight <= 0 {
+				return nil, fmt.Errorf("%s:%d: weight must be positive", path, lineNo)
+			}
+			entry.weight = *envelope.Weight
+		}
+		body := envelope.Body
+		if len(body) == 0 {
+			body = line
+		}
+		if err := json.Unmarshal(body, &entry.req); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		for _, key := range []string{"weight", "custom_id", "method", "url"} {
+			delete(entry.req.ExtraBody, key)
+		}
+		if len(entry.req.ExtraBody) == 0 {
+			entry.req.ExtraBody = nil
+		}
+		mix = append(mix, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("%s: no requests", path)
+	}
+	return mix, nil
+}
+
+// benchProgress keeps a live progress line on a terminal
+type benchProgress struct {
+	mu     sync.Mutex
+	w      io.Writer
+	live   bool
+	start  time.Time
+	drawn  time.Time
+	done   int
+	failed int
+}
+
+func newBenchProgress(w io.Writer) *benchProgress {
+	return &benchProgress{w: w, live: isTerminal(w), start: time.Now()}
+}
+
+func (p *benchProgress) add(s benchSample) {
+	if !p.live {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if s.err != "" {
+		p.failed++
+	}
+	if time.Since(p.drawn) >= 200*time.Millisecond {
+		p.drawn = time.Now()
+		fmt.Fprintf(p.w, "\r\033[K%d done, %d failed, %.1f req/s", p.done, p.failed, float64(p.done)/time.Since(p.start).Seconds())
+	}
+}
+
+func (p *benchProgress) finish() {
+	if p.live && p.done > 0 {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
+
+// benchReport summarises a benchmark run
+type benchReport struct {
+	Requests         int            `json:"requests"`
+	Errors           int            `json:"errors"`
+	ErrorRate        float64        `json:"error_rate"`
+	ErrorTypes       map[string]int `json:"error_types"`
+	Concurrency      int            `json:"concurrency"`
+	DurationMS       int64          `json:"duration_ms"`
+	RequestsPerSec   float64        `json:"requests_per_second"`
+	PromptTokens     int            `json:"prompt_tokens"`
+	CompletionTokens int            `json:"completion_tokens"`
+	TokensPerSec     float64        `json:"completion_tokens_per_second"`
+	TTFT             durationStats  `json:"ttft"`
+	Latency          durationStats  `json:"latency"`
+	// OutputSpeed is the per-request rate of completion tokens after the
+	// first token, in tokens per second
+	OutputSpeed rateStats `json:"output_speed"`
+}
+
+// durationStats are duration percentiles in milliseconds
+type durationStats struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+// rateStats are rate percentiles
+type rateStats struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func newBenchReport(samples []benchSample, elapsed time.Duration, concurrency int) *benchReport {
+	r := &benchReport{
+		Requests:    len(samples),
+		ErrorTypes:  map[string]int{},
+		Concurrency: concurrency,
+		DurationMS:  elapsed.Milliseconds(),
+	}
+	var ttfts, latencies []time.Duration
+	var speeds []float64
+	for _, s := range samples {
+		if s.err != "" {
+			r.Errors++
+			r.ErrorTypes[s.err]++
+			continue
+		}
+		r.PromptTokens += s.promptTokens
+		r.CompletionTokens += s.completionTokens
+		ttfts = append(ttfts, s.ttft)
+		latencies = append(latencies, s.latency)
+		if gen := s.latency - s.ttft; gen > 0 && s.completionTokens > 1 {
+			// The first token arrives at ttft; the rest are generated after it
+			speeds = append(speeds, float64(s.completionTokens-1)/gen.Seconds())
+		}
+	}
+	if r.Requests > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(r.Requests)
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		r.RequestsPerSec = float64(r.Requests) / secs
+		r.TokensPerSec = float64(r.CompletionTokens) / secs
+	}
+	r.TTFT = newDurationStats(ttfts)
+	r.Latency = newDurationStats(latencies)
+	if len(speeds) > 0 {
+		sort.Float64s(speeds)
+		r.OutputSpeed = rateStats{
+			P50: percentile(speeds, 50),
+			P90: percentile(speeds, 90),
+			P99: percentile(speeds, 99),
+			Max: speeds[len(speeds)-1],
+		}
+	}
+	return r
+}
+
+func newDurationStats(d []time.Duration) durationStats {
+	if len(d) == 0 {
+		return durationStats{}
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return durationStats{
+		P50: ms(percentile(d, 50)),
+		P90: ms(percentile(d, 90)),
+		P99: ms(percentile(d, 99)),
+		Max: ms(d[len(d)-1]),
+	}
+}
+
+func (r *benchReport) print(w io.Writer) {
+	fmt.Fprintf(w, "Requests:     %d in %s at concurrency %d (%.1f req/s)\n",
+		r.Requests, (time.Duration(r.DurationMS) * time.Millisecond).String(), r.Concurrency, r.RequestsPerSec)
+	fmt.Fprintf(w, "Errors:       %d (%.1f%%)\n", r.Errors, 100*r.ErrorRate)
+	fmt.Fprintf(w, "Tokens:       %d prompt, %d completion (%.1f completion tokens/s)\n\n",
+		r.PromptTokens, r.CompletionTokens, r.TokensPerSec)
+
+	tw := newTable(w)
+	fmt.Fprintln(tw, "\tP50\tP90\tP99\tMAX")
+	row := func(name string, s durationStats) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, msString(s.P50), msString(s.P90), msString(s.P99), msString(s.Max))
+	}
+	row("Time to first token", r.TTFT)
+	row("Latency", r.Latency)
+	fmt.Fprintf(tw, "Output tokens/s\t%.1f\t%.1f\t%.1f\t%.1f\n", r.OutputSpeed.P50, r.OutputSpeed.P90, r.OutputSpeed.P99, r.OutputSpeed.Max)
+	tw.Flush()
+
+	printCounts(w, "ERROR", r.ErrorTypes)
+}
+
+// msString formats a duration given in milliseconds
+func msString(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(10 * time.Microsecond).String()
+}
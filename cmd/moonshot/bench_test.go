@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+)
+
+func benchJSON(t *testing.T, args ...string) benchReport {
+	t.Helper()
+	stdout, stderr, code := runCLI(t, "", append([]string{"bench", "-json"}, args...)...)
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	var report benchReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("decoding %s: %v", stdout, err)
+	}
+	return report
+}
+
+func TestBench(t *testing.T) {
+	t.Run("fake", func(t *testing.T) {
+		r := benchJSON(t, "-fake", "-fake-delay", "20ms", "-n", "8", "-concurrency", "4")
+		if r.Requests != 8 || r.Errors != 0 || r.CompletionTokens == 0 || r.RequestsPerSec == 0 {
+			t.Errorf("report = %+v", r)
+		}
+		if r.TTFT.P50 < 20 || r.Latency.Max < r.TTFT.P50 {
+			t.Errorf("ttft = %+v, latency = %+v", r.TTFT, r.Latency)
+		}
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		r := benchJSON(t, "-fake", "-n", "0", "-duration", "100ms", "-concurrency", "2")
+		if r.Requests == 0 || r.Errors != 0 {
+			t.Errorf("report = %+v", r)
+		}
+	})
+
+	t.Run("mix and errors", func(t *testing.T) {
+		srv := moonshottest.NewServer()
+		defer srv.Close()
+		srv.InjectFault(moonshottest.Fault{Path: "/chat/completions", Times: 2, Status: 429, Type: "rate_limit_reached_error", Message: "slow down"})
+
+		mix := filepath.Join(t.TempDir(), "mix.jsonl")
+		lines := `{"weight":3,"model":"kimi-k2","messages":[{"role":"user","content":"short"}]}
+{"custom_id":"x","body":{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"a longer question"}]}}
+`
+		if err := os.WriteFile(mix, []byte(lines), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		r := benchJSON(t, "-base-url", srv.URL, "-api-key", "sk-test", "-mix", mix, "-n", "10", "-concurrency", "1", "-stream=false")
+		if r.Requests != 10 || r.Errors != 2 || r.ErrorTypes["rate_limit_reached_error"] != 2 || r.ErrorRate != 0.2 {
+			t.Errorf("report = %+v", r)
+		}
+		for _, req := range srv.ChatRequests() {
+			if req.Model != "kimi-k2" && req.Model != "moonshot-v1-8k" {
+				t.Errorf("unexpected model %q", req.Model)
+			}
+			if len(req.ExtraBody) > 0 {
+				t.Errorf("mix fields sent upstream: %v", req.ExtraBody)
+			}
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		stdout, stderr, code := runCLI(t, "", "bench", "-fake", "-n", "3")
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		for _, want := range []string{"Requests:     3", "Errors:       0 (0.0%)", "Time to first token", "Output tokens/s"} {
+			if !strings.Contains(stdout, want) {
+				t.Errorf("output lacks %q:\n%s", want, stdout)
+			}
+		}
+	})
+
+	t.Run("usage errors", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "bad.jsonl")
+		os.WriteFile(bad, []byte(`{"weight":0,"model":"kimi-k2","messages":[]}`), 0o644)
+
+		if _, stderr, code := runCLI(t, "", "bench", "-n", "0"); code != exitUsage {
+			t.Errorf("-n 0: exit code = %d, stderr = %s", code, stderr)
+		}
+		if _, stderr, code := runCLI(t, "", "bench", "-fake", "-mix", bad); code != exitError || !strings.Contains(stderr, "weight must be positive") {
+			t.Errorf("bad mix: exit code = %d, stderr = %s", code, stderr)
+		}
+	})
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func init() {
+	commands["chat"] = command{summary: "Chat with a model interactively", run: runChat}
+}
+
+const chatHelp = `Commands:
+  /reset          start a new conversation, keeping the system prompt
+  /save [file]    save the conversation (default: the history file)
+  /load [file]    load a saved conversation (default: the history file)
+  /model [name]   show or change the model
+  /tokens         count the tokens of the conversation
+  /help           show this help
+  /exit           quit
+
+End a line with \ to continue on the next line, or enclose several lines
+between lines containing only """.`
+
+// session is a conversation as saved to disk
+type session struct {
+	Model    string          `json:"model"`
+	Messages []types.Message `json:"messages"`
+}
+
+// repl is an interactive chat session
+type repl struct {
+	env         *env
+	chat        *chat.Service
+	in          *bufio.Reader
+	session     session
+	temperature *float64
+	historyPath string
+	lastUsage   *types.Usage
+}
+
+func runChat(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "chat", "[flags]")
+	cf := addClientFlags(fs)
+	model := cf.addModelFlag(fs, "model to chat with")
+	system := fs.String("system", "", "system prompt")
+	temperature := fs.Float64("temperature", -1, "sampling temperature (default: the API default)")
+	historyPath := fs.String("history", defaultHistoryPath(), "file the conversation is saved to after every turn; empty disables saving")
+	resume := fs.Bool("resume", false, "continue the conversation saved in the history file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	r := &repl{
+		env:         e,
+		chat:        sdk.Chat,
+		in:          bufio.NewReader(e.stdin),
+		session:     session{Model: *model},
+		historyPath: *historyPath,
+	}
+	if *temperature >= 0 {
+		r.temperature = temperature
+	}
+	if *resume {
+		if r.historyPath == "" {
+			return usagef("-resume needs a history file")
+		}
+		if err := r.load(r.historyPath); err != nil {
+			return err
+		}
+	}
+	if *system != "" && !*resume {
+		r.session.Messages = []types.Message{{Role: "system", Content: *system}}
+	}
+
+	fmt.Fprintf(e.stderr, "Chatting with %s. Type /help for commands.\n", r.session.Model)
+	for {
+		fmt.Fprint(e.stderr, "> ")
+		input, err := r.readInput()
+		if err == io.EOF {
+			fmt.Fprintln(e.stderr)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if input == "" {
+			continue
+		}
+
+		if strings.HasPrefix(input, "/") {
+			quit, err := r.command(ctx, input)
+			if err != nil {
+				fmt.Fprintf(e.stderr, "error: %v\n", err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+
+		if err := r.send(ctx, input); err != nil {
+			fmt.Fprintf(e.stderr, "error: %v\n", err)
+		}
+	}
+}
+
+// readInput reads one message, joining continued and fenced lines
+func (r *repl) readInput() (string, error) {
+	var lines []string
+	fenced := false
+	for {
+		line, err := r.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		if err != nil {
+			if err == io.EOF && len(lines) > 0 {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.TrimSpace(line) == `"""`:
+			if fenced {
+				return strings.Join(lines, "\n"), nil
+			}
+			fenced = true
+		case fenced:
+			lines = append(lines, line)
+		case strings.HasSuffix(line, `\`):
+			lines = append(lines, strings.TrimSuffix(line, `\`))
+		default:
+			lines = append(lines, line)
+			return strings.TrimSpace(strings.Join(lines, "\n")), nil
+		}
+	}
+}
+
+// command runs a slash command and reports whether to quit
+func (r *repl) command(ctx context.Context, input string) (bool, error) {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/exit", "/quit":
+		return true, nil
+
+	case "/help":
+		fmt.Fprintln(r.env.stderr, chatHelp)
+
+	case "/reset":
+		var kept []types.Message
+		for _, m := range r.session.Messages {
+			if m.Role == "system" {
+				kept = append(kept, m)
+			}
+		}
+		r.session.Messages = kept
+		r.lastUsage = nil
+		fmt.Fprintln(r.env.stderr, "Started a new conversation.")
+
+	case "/save":
+		path := r.pathArg(arg)
+		if path == "" {
+			return false, errors.New("usage: /save <file>")
+		}
+		if err := r.save(path); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(r.env.stderr, "Saved %d messages to %s.\n", len(r.session.Messages), path)
+
+	case "/load":
+		path := r.pathArg(arg)
+		if path == "" {
+			return false, errors.New("usage: /load <file>")
+		}
+		if err := r.load(path); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(r.env.stderr, "Loaded %d messages, model %s.\n", len(r.session.Messages), r.session.Model)
+
+	case "/model":
+		if arg == "" {
+			fmt.Fprintln(r.env.stderr, r.session.Model)
+			break
+		}
+		if !models.Model(arg).IsValid() {
+			fmt.Fprintf(r.env.stderr, "Note: %s is not a model known to this version.\n", arg)
+		}
+		r.session.Model = arg
+		fmt.Fprintf(r.env.stderr, "Model set to %s.\n", arg)
+
+	case "/tokens":
+		return false, r.tokens(ctx)
+
+	default:
+		return false, fmt.Errorf("unknown command %s (try /help)", name)
+	}
+	return false, nil
+}
+
+// pathArg returns the file argument of /save and /load, defaulting to the
+// history file
+func (r *repl) pathArg(arg string) string {
+	if arg != "" {
+		return arg
+	}
+	return r.historyPath
+}
+
+// send streams the reply to input and adds both to the conversation
+func (r *repl) send(ctx context.Context, input string) error {
+	r.session.Messages = append(r.session.Messages, types.Message{Role: "user", Content: input})
+
+	// Ctrl-C stops the reply rather than the program
+	turnCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	req := types.ChatCompletionRequest{
+		Model:       r.session.Model,
+		Messages:    r.session.Messages,
+		Temperature: r.temperature,
+	}
+	stream, err := r.chat.CreateCompletionStream(turnCtx, req)
+	if err != nil {
+		r.dropLastTurn()
+		return err
+	}
+	defer stream.Close()
+
+	acc := stream.Accumulated()
+	reasoning := false
+	for delta, err := range stream.Deltas() {
+		if err != nil {
+			fmt.Fprintln(r.env.stdout)
+			r.dropLastTurn()
+			if turnCtx.Err() != nil && ctx.Err() == nil {
+				return errors.New("interrupted")
+			}
+			return err
+		}
+		if delta.ReasoningContent != "" {
+			reasoning = true
+			fmt.Fprint(r.env.stderr, delta.ReasoningContent)
+		}
+		if delta.Content != "" {
+			if reasoning {
+				fmt.Fprint(r.env.stderr, "\n\n")
+				reasoning = false
+			}
+			fmt.Fprint(r.env.stdout, delta.Content)
+		}
+	}
+	fmt.Fprintln(r.env.stdout)
+
+	resp := acc.Response()
+	if len(resp.Choices) == 0 {
+		r.dropLastTurn()
+		return errors.New("empty reply")
+	}
+	r.session.Messages = append(r.session.Messages, resp.Choices[0].Message)
+	r.lastUsage = acc.Usage()
+
+	if r.historyPath != "" {
+		return r.save(r.historyPath)
+	}
+	return nil
+}
+
+// dropLastTurn removes the user message of a failed turn
+func (r *repl) dropLastTurn() {
+	if n := len(r.session.Messages); n > 0 && r.session.Messages[n-1].Role == "user" {
+		r.session.Messages = r.session.Messages[:n-1]
+	}
+}
+
+// tokens prints the size of the conversation against the model's context
+func (r *repl) tokens(ctx context.Context) error {
+	if len(r.session.Messages) == 0 {
+		fmt.Fprintln(r.env.stderr, "The conversation is empty.")
+		return nil
+	}
+	count, err := r.chat.CountTokens(ctx, types.TokenCountRequest{Model: r.session.Model, Messages: r.session.Messages})
+	if err != nil {
+		return err
+	}
+
+	line := fmt.Sprintf("Conversation: %d tokens", count.TokenCount)
+	if limit := models.Model(r.session.Model).MaxTokens(); limit > 0 {
+		line += fmt.Sprintf(" of %d (%.1f%%)", limit, float64(count.TokenCount)/float64(limit)*100)
+	}
+	fmt.Fprintln(r.env.stderr, line)
+	if r.lastUsage != nil {
+		fmt.Fprintf(r.env.stderr, "Last reply: %d prompt + %d completion tokens\n", r.lastUsage.PromptTokens, r.lastUsage.CompletionTokens)
+	}
+	return nil
+}
+
+// save writes the conversation to path. Conversations may be private, so
+// the file is readable by the user only.
+func (r *repl) save(path string) error {
+	data, err := json.MarshalIndent(r.session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding conversation: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("saving conversation: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("saving conversation: %w", err)
+	}
+	return nil
+}
+
+// load replaces the conversation with the one saved in path
+func (r *repl) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("loading conversation: %w", err)
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("loading conversation %s: %w", path, err)
+	}
+	if s.Model == "" {
+		s.Model = r.session.Model
+	}
+	r.session = s
+	r.lastUsage = nil
+	return nil
+}
+
+// defaultHistoryPath returns where conversations are saved by default
+func defaultHistoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "moonshot", "history.json")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+)
+
+func TestChat(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	history := filepath.Join(dir, "history.json")
+	saved := filepath.Join(dir, "saved.json")
+
+	input := strings.Join([]string{
+		"Hello",
+		"/model moonshot-v1-8k",
+		`"""`,
+		"line one",
+		"line two",
+		`"""`,
+		"/tokens",
+		"/save " + saved,
+		"/reset",
+		`continued \`,
+		"line",
+		"/load " + saved,
+		"/bogus",
+		"/exit",
+	}, "\n")
+
+	stdout, stderr, code := runCLI(t, input,
+		"chat", "-base-url", srv.URL, "-api-key", "sk-test", "-system", "Be brief", "-history", history)
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+
+	for _, want := range []string{"echo: Hello", "echo: line one\nline two", "echo: continued \nline"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout = %q, want it to contain %q", stdout, want)
+		}
+	}
+	for _, want := range []string{"Model set to moonshot-v1-8k", "Conversation: ", "of 8192", "Saved 5 messages", "Started a new conversation", "Loaded 5 messages", "unknown command /bogus"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr = %q, want it to contain %q", stderr, want)
+		}
+	}
+
+	reqs := srv.ChatRequests()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d chat requests, want 3", len(reqs))
+	}
+	second := reqs[1]
+	if second.Model != "moonshot-v1-8k" || len(second.Messages) != 4 || second.Messages[0].Role != "system" {
+		t.Errorf("second request = %+v", second)
+	}
+	// After /reset only the system prompt is kept
+	if third := reqs[2]; len(third.Messages) != 2 {
+		t.Errorf("third request has %d messages, want 2", len(third.Messages))
+	}
+
+	info, err := os.Stat(history)
+	if err != nil {
+		t.Fatalf("history file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("history file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		_, stderr, code := runCLI(t, "Again\n", "chat", "-base-url", srv.URL, "-api-key", "sk-test", "-history", history, "-resume")
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		last := srv.LastChatRequest(t)
+		// System prompt and the two messages after /reset, plus the new one
+		if len(last.Messages) != 4 || last.Messages[3].Content != "Again" {
+			t.Errorf("resumed request messages = %+v", last.Messages)
+		}
+	})
+
+	t.Run("api error keeps conversation", func(t *testing.T) {
+		srv.InjectFault(moonshottest.ServerError())
+		stdout, stderr, code := runCLI(t, "First\nSecond\n", "chat", "-base-url", srv.URL, "-api-key", "sk-test", "-history", "")
+		if code != exitOK {
+			t.Fatalf("exit code = %d", code)
+		}
+		if !strings.Contains(stderr, "error: moonshot api error (status 500)") || !strings.Contains(stdout, "echo: Second") {
+			t.Errorf("stdout = %q, stderr = %q", stdout, stderr)
+		}
+		// The failed turn is dropped from the conversation
+		if last := srv.LastChatRequest(t); len(last.Messages) != 1 || last.Messages[0].Content != "Second" {
+			t.Errorf("request after failed turn = %+v", last.Messages)
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func init() {
+	commands["files"] = command{summary: "Manage uploaded files", run: runFiles}
+}
+
+// filesCommands are the subcommands of "moonshot files"
+var filesCommands = map[string]func(ctx context.Context, e *env, args []string) error{
+	"upload":  runFilesUpload,
+	"list":    runFilesList,
+	"get":     runFilesGet,
+	"delete":  runFilesDelete,
+	"content": runFilesContent,
+	"prune":   runFilesPrune,
+}
+
+const filesUsage = "upload|list|get|delete|content|prune [flags] [args]"
+
+func runFiles(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: moonshot files %s", filesUsage)
+	}
+	run, ok := filesCommands[args[0]]
+	if !ok {
+		return usagef("unknown files command %q; want one of %s", args[0], filesUsage)
+	}
+	return run(ctx, e, args[1:])
+}
+
+// fileFilter selects files by purpose and age
+type fileFilter struct {
+	purpose   string
+	olderThan time.Duration
+}
+
+func addFileFilterFlags(fs *flag.FlagSet) *fileFilter {
+	f := &fileFilter{}
+	fs.StringVar(&f.purpose, "purpose", "", "only files with this purpose")
+	fs.DurationVar(&f.olderThan, "older-than", 0, "only files uploaded longer ago than this, e.g. 720h")
+	return f
+}
+
+func (f *fileFilter) empty() bool {
+	return f.purpose == "" && f.olderThan == 0
+}
+
+// list returns the files on the server matching the filter, oldest first
+func (f *fileFilter) list(ctx context.Context, sdk *moonshot.SDK) ([]types.File, error) {
+	resp, err := sdk.Files.List(ctx, &types.FileListParams{Purpose: f.purpose})
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-f.olderThan).Unix()
+	var matched []types.File
+	for _, file := range resp.Data {
+		if f.purpose != "" && file.Purpose != f.purpose {
+			continue
+		}
+		if f.olderThan > 0 && file.CreatedAt > cutoff {
+			continue
+		}
+		matched = append(matched, file)
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt < matched[j].CreatedAt })
+	return matched, nil
+}
+
+func runFilesUpload(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "files upload", "[flags] file|glob|directory...")
+	cf := addClientFlags(fs)
+	purpose := fs.String("purpose", "file-extract", "purpose of the uploaded files")
+	concurrency := fs.Int("concurrency", 4, "number of parallel uploads")
+	jsonOut := fs.Bool("json", false, "print the results as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("no files to upload")
+	}
+
+	paths, err := expandPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		Path  string      `json:"path"`
+		File  *types.File `json:"file,omitempty"`
+		Error string      `json:"error,omitempty"`
+	}
+	results := make([]result, len(paths))
+	parallel(*concurrency, len(paths), func(i int) {
+		results[i].Path = paths[i]
+		file, err := sdk.Files.UploadFile(ctx, paths[i], *purpose)
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+		results[i].File = file
+	})
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	if *jsonOut {
+		if err := printJSON(e.stdout, results); err != nil {
+			return err
+		}
+	} else {
+		tw := newTable(e.stdout)
+		fmt.Fprintln(tw, "PATH\tID\tSIZE")
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Fprintf(e.stderr, "%s: %s\n", r.Path, r.Error)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Path, r.File.ID, formatBytes(r.File.Bytes))
+		}
+		tw.Flush()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", failed, len(paths))
+	}
+	return nil
+}
+
+// expandPaths resolves globs and directories to the regular files they
+// contain
+func expandPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, usagef("invalid pattern %q: %v", arg, err)
+		}
+		if len(matches) == 0 {
+			if strings.ContainsAny(arg, "*?[") {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			matches = []string{arg}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				paths = append(paths, match)
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					paths = append(paths, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return paths, nil
+}
+
+func runFilesList(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "files list", "[flags]")
+	cf := addClientFlags(fs)
+	filter := addFileFilterFlags(fs)
+	jsonOut := fs.Bool("json", false, "print the files as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	files, err := filter.list(ctx, sdk)
+	if err != nil {
+		return err
+	}
+	return printFiles(e.stdout, files, *jsonOut)
+}
+
+func runFilesGet(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "files get", "[flags] id...")
+	cf := addClientFlags(fs)
+	jsonOut := fs.Bool("json", false, "print the files as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("no file IDs given")
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	files := make([]types.File, 0, fs.NArg())
+	for _, id := range fs.Args() {
+		file, err := sdk.Files.Get(ctx, id)
+		if err != nil {
+			return fmt.Errorf("getting %s: %w", id, err)
+		}
+		files = append(files, *file)
+	}
+	return printFiles(e.stdout, files, *jsonOut)
+}
+
+// printFiles prints files as a table or as JSON
+func printFiles(w io.Writer, files []types.File, jsonOut bool) error {
+	if jsonOut {
+		if files == nil {
+			files = []types.File{}
+		}
+		return printJSON(w, files)
+	}
+	tw := newTable(w)
+	fmt.Fprintln(tw, "ID\tNAME\tSIZE\tPURPOSE\tSTATUS\tCREATED")
+	for _, f := range files {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", f.ID, f.Filename, formatBytes(f.Bytes), f.Purpose, f.Status, formatUnix(f.CreatedAt))
+	}
+	return tw.Flush()
+}
+
+func runFilesDelete(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "files delete", "[flags] id...")
+	cf := addClientFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "show what would be deleted without deleting")
+	concurrency := fs.Int("concurrency", 4, "number of parallel deletions")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("no file IDs given")
+	}
+
+	files := make([]types.File, fs.NArg())
+	for i, id := range fs.Args() {
+		files[i] = types.File{ID: id}
+	}
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	return deleteFiles(ctx, e, sdk, files, *dryRun, *concurrency)
+}
+
+func runFilesPrune(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "files prune", "[flags]")
+	cf := addClientFlags(fs)
+	filter := addFileFilterFlags(fs)
+	all := fs.Bool("all", false, "delete every file; required when no filter is given")
+	dryRun := fs.Bool("dry-run", false, "show what would be deleted without deleting")
+	concurrency := fs.Int("concurrency", 4, "number of parallel deletions")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if filter.empty() && !*all {
+		return usagef("refusing to delete every file without -all; use -purpose or -older-than to select files")
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	files, err := filter.list(ctx, sdk)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(e.stderr, "No files match.")
+		return nil
+	}
+	return deleteFiles(ctx, e, sdk, files, *dryRun, *concurrency)
+}
+
+// deleteFiles deletes files in parallel, printing one line per file
+func deleteFiles(ctx context.Context, e *env, sdk *moonshot.SDK, files []types.File, dryRun bool, concurrency int) error {
+	describe := func(f types.File) string {
+		if f.Filename == "" {
+			return f.ID
+		}
+		return fmt.Sprintf("%s (%s)", f.ID, f.Filename)
+	}
+
+	if dryRun {
+		for _, f := range files {
+			fmt.Fprintf(e.stdout, "would delete %s\n", describe(f))
+		}
+		return nil
+	}
+
+	errs := make([]error, len(files))
+	parallel(concurrency, len(files), func(i int) {
+		errs[i] = sdk.Files.Delete(ctx, files[i].ID)
+	})
+
+	failed := 0
+	for i, f := range files {
+		if errs[i] != nil {
+			failed++
+			fmt.Fprintf(e.stderr, "%s: %v\n", f.ID, errs[i])
+			continue
+		}
+		fmt.Fprintf(e.stdout, "deleted %s\n", describe(f))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deletions failed", failed, len(files))
+	}
+	return nil
+}
+
+func runFilesContent(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "files content", "[flags] id")
+	cf := addClientFlags(fs)
+	output := fs.String("o", "", "write the content to this file instead of stdout")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usagef("want exactly one file ID")
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	content, err := sdk.Files.GetContent(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, content, 0o644)
+	}
+	_, err = e.stdout.Write(content)
+	return err
+}
+
+// parallel calls fn for 0 <= i < n with at most concurrency calls running
+// at once
+func parallel(concurrency, n int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func TestFiles(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	api := []string{"-base-url", srv.URL, "-api-key", "sk-test"}
+	files := func(sub string, args ...string) (string, string, int) {
+		t.Helper()
+		return runCLI(t, "", append(append([]string{"files", sub}, api...), args...)...)
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs", "nested"), 0o755)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bravo"), 0o644)
+	os.WriteFile(filepath.Join(dir, "docs", "c.md"), []byte("charlie"), 0o644)
+	os.WriteFile(filepath.Join(dir, "docs", "nested", "d.md"), []byte("delta"), 0o644)
+
+	t.Run("upload globs and directories", func(t *testing.T) {
+		stdout, stderr, code := files("upload", "-json", filepath.Join(dir, "*.txt"), filepath.Join(dir, "docs"))
+		if code != exitOK {
+			t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+		}
+		var results []struct {
+			Path string      `json:"path"`
+			File *types.File `json:"file"`
+		}
+		if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+			t.Fatalf("decoding output: %v\n%s", err, stdout)
+		}
+		if len(results) != 4 {
+			t.Fatalf("uploaded %d files, want 4", len(results))
+		}
+		for _, r := range results {
+			if r.File == nil || r.File.Purpose != "file-extract" {
+				t.Errorf("result = %+v", r)
+			}
+		}
+	})
+
+	t.Run("upload missing file", func(t *testing.T) {
+		_, _, code := files("upload", filepath.Join(dir, "missing.txt"))
+		if code != exitError {
+			t.Errorf("exit code = %d, want %d", code, exitError)
+		}
+	})
+
+	old := srv.AddFile(types.File{Filename: "old.pdf", Purpose: "batch", CreatedAt: time.Now().Add(-48 * time.Hour).Unix()}, []byte("old"))
+
+	t.Run("list", func(t *testing.T) {
+		stdout, _, code := files("list")
+		if code != exitOK {
+			t.Fatalf("exit code = %d", code)
+		}
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		if len(lines) != 6 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "old.pdf") {
+			t.Errorf("table =\n%s", stdout)
+		}
+
+		stdout, _, _ = files("list", "-json", "-older-than", "24h")
+		var listed []types.File
+		if err := json.Unmarshal([]byte(stdout), &listed); err != nil || len(listed) != 1 || listed[0].ID != old.ID {
+			t.Errorf("old files = %+v, %v", listed, err)
+		}
+
+		stdout, _, _ = files("list", "-json", "-purpose", "batch")
+		if err := json.Unmarshal([]byte(stdout), &listed); err != nil || len(listed) != 1 {
+			t.Errorf("batch files = %+v, %v", listed, err)
+		}
+	})
+
+	t.Run("get and content", func(t *testing.T) {
+		stdout, _, code := files("get", old.ID)
+		if code != exitOK || !strings.Contains(stdout, "old.pdf") {
+			t.Errorf("get: exit code = %d, stdout = %s", code, stdout)
+		}
+
+		out := filepath.Join(dir, "out.bin")
+		if _, stderr, code := files("content", "-o", out, old.ID); code != exitOK {
+			t.Fatalf("content: exit code = %d, stderr = %s", code, stderr)
+		}
+		if data, _ := os.ReadFile(out); string(data) != "old" {
+			t.Errorf("content = %q", data)
+		}
+
+		if _, _, code := files("get", "file-missing"); code != exitInvalid {
+			t.Errorf("get missing: exit code = %d, want %d", code, exitInvalid)
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		if _, _, code := files("prune"); code != exitUsage {
+			t.Errorf("prune without filter: exit code = %d, want %d", code, exitUsage)
+		}
+
+		stdout, _, code := files("prune", "-older-than", "24h", "-dry-run")
+		if code != exitOK || strings.TrimSpace(stdout) != "would delete "+old.ID+" (old.pdf)" {
+			t.Errorf("dry run: exit code = %d, stdout = %q", code, stdout)
+		}
+
+		stdout, _, code = files("prune", "-older-than", "24h")
+		if code != exitOK || !strings.Contains(stdout, "deleted "+old.ID) {
+			t.Errorf("prune: exit code = %d, stdout = %q", code, stdout)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		list, _ := srv.SDK().Files.List(context.Background(), nil)
+		var ids []string
+		for _, f := range list.Data {
+			ids = append(ids, f.ID)
+		}
+		stdout, _, code := files("delete", ids...)
+		if code != exitOK || strings.Count(stdout, "deleted") != 4 {
+			t.Errorf("exit code = %d, stdout = %q", code, stdout)
+		}
+
+		list, _ = srv.SDK().Files.List(context.Background(), nil)
+		if len(list.Data) != 0 {
+			t.Errorf("files left = %+v", list.Data)
+		}
+	})
+}
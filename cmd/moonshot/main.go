@@ -0,0 +1,284 @@
+// Command moonshot is a command-line client for the Moonshot AI API.
+//
+// Usage:
+//
+//	moonshot <command> [flags] [args]
+//
+// Run "moonshot help" for the list of commands. Commands that call the API
+// read the config file ~/.config/moonshot/config; the -profile flag
+// selects a profile in it, and the MOONSHOT_API_KEY and MOONSHOT_BASE_URL
+// environment variables and the -api-key and -base-url flags override it.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	apierrors "github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+)
+
+// Exit codes. API errors are mapped to a code per category so scripts can
+// tell failures worth retrying from ones that need attention.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitAuth        = 3 // missing or invalid API key, or permission denied
+	exitRateLimited = 4 // rate limited; retry later
+	exitQuota       = 5 // quota exhausted or balance below the guard threshold
+	exitInvalid     = 6 // the API rejected the request
+	exitServer      = 7 // server error, overload or timeout; retry later
+	exitBadOutput   = 8 // the model's answer did not match the requested schema
+)
+
+// env is the environment a command runs in
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a moonshot subcommand
+type command struct {
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+// commands is filled in by the files defining each command
+var commands = map[string]command{}
+
+// usageError reports invalid command-line usage
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+// run executes the command line args and returns the exit code
+func run(ctx context.Context, args []string, e *env) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(e.stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "moonshot: unknown command %q\n\n", args[0])
+		printUsage(e.stderr)
+		return exitUsage
+	}
+
+	err := cmd.run(ctx, e, args[1:])
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	fmt.Fprintf(e.stderr, "moonshot %s: %v\n", args[0], err)
+	return exitCode(err)
+}
+
+// exitCode maps err to the process exit code
+func exitCode(err error) int {
+	var (
+		usageErr   usageError
+		outputErr  outputError
+		apiErr     apierrors.APIError
+		balanceErr apierrors.BalanceError
+	)
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case hasConfigError(err, "api_key"):
+		return exitAuth
+	case errors.As(err, &outputErr):
+		return exitBadOutput
+	case errors.As(err, &balanceErr):
+		return exitQuota
+	case errors.As(err, &apiErr):
+		return apiExitCode(apiErr)
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitServer
+	}
+	return exitError
+}
+
+// hasConfigError reports whether err, or any error it wraps or joins, is a
+// ConfigError for setting
+func hasConfigError(err error, setting string) bool {
+	var configErr apierrors.ConfigError
+	if errors.As(err, &configErr) && configErr.Setting == setting {
+		return true
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return hasConfigError(e.Unwrap(), setting)
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			if hasConfigError(err, setting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apiExitCode maps an API error to its exit code category
+func apiExitCode(e apierrors.APIError) int {
+	switch {
+	case e.Type == apierrors.ErrTypeQuotaExceeded:
+		return exitQuota
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return exitAuth
+	case e.StatusCode == http.StatusTooManyRequests:
+		return exitRateLimited
+	case e.StatusCode == http.StatusRequestTimeout || e.StatusCode >= 500:
+		return exitServer
+	case e.StatusCode >= 400:
+		return exitInvalid
+	}
+	return exitError
+}
+
+// outputError reports a model answer that is not in the requested format
+type outputError struct {
+	msg string
+}
+
+func (e outputError) Error() string {
+	return e.msg
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: moonshot <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "moonshot <command> -h" for the flags of a command.`)
+}
+
+// newFlagSet returns a flag set for a command that reports errors instead
+// of exiting
+func newFlagSet(e *env, name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: moonshot %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args, turning flag errors into usage errors
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{msg: err.Error()}
+	}
+	return nil
+}
+
+// parseInterspersed parses args like parseFlags but also accepts flags
+// after positional arguments, as in "batch run in.jsonl -o out.jsonl". It
+// returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := parseFlags(fs, args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// defaultTimeout is the HTTP timeout unless the flags or config set one
+const defaultTimeout = 5 * time.Minute
+
+// clientFlags are the flags shared by commands that call the API. Settings
+// not given as flags come from the config file (see client.LoadConfig).
+type clientFlags struct {
+	apiKey  string
+	baseURL string
+	profile string
+	timeout time.Duration
+	model   *string
+}
+
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	cf := &clientFlags{}
+	fs.StringVar(&cf.apiKey, "api-key", "", "API key (default $"+client.EnvAPIKey+" or the profile's)")
+	fs.StringVar(&cf.baseURL, "base-url", "", "API base URL (default $"+client.EnvBaseURL+" or the profile's)")
+	fs.StringVar(&cf.profile, "profile", "", "config file profile, such as cn or global (default $"+client.EnvProfile+")")
+	fs.DurationVar(&cf.timeout, "timeout", 0, "HTTP timeout, including reading streamed responses (default 5m or the profile's)")
+	return cf
+}
+
+// addModelFlag adds a -model flag whose default is the profile's default
+// model, filled in by sdk
+func (cf *clientFlags) addModelFlag(fs *flag.FlagSet, usage string) *string {
+	cf.model = fs.String("model", "", usage+" (default: the profile's, or "+models.KimiK2.String()+")")
+	return cf.model
+}
+
+// sdk returns an SDK configured from the config file and the flags
+func (cf *clientFlags) sdk(opts ...client.Option) (*moonshot.SDK, error) {
+	cfg, err := client.LoadConfig(cf.profile)
+	if err != nil {
+		return nil, err
+	}
+	if cf.apiKey != "" {
+		cfg.APIKey = cf.apiKey
+	}
+	if cf.baseURL != "" {
+		cfg.BaseURL = cf.baseURL
+	}
+	switch {
+	case cf.timeout > 0:
+		cfg.Timeout = client.Duration(cf.timeout)
+	case cfg.Timeout == 0:
+		cfg.Timeout = client.Duration(defaultTimeout)
+	}
+	if cfg.DefaultModel == "" {
+		cfg.DefaultModel = models.KimiK2.String()
+	}
+	if cf.model != nil && *cf.model == "" {
+		*cf.model = cfg.DefaultModel
+	}
+	return moonshot.NewFromConfig(cfg, opts...)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	apierrors "github.com/rizome-dev/go-moonshot/pkg/errors"
+)
+
+// TestMain keeps the tests from reading the user's config file
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "moonshot-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	for _, key := range []string{client.EnvBaseURL, client.EnvProfile, client.EnvConfig} {
+		os.Unsetenv(key)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// runCLI runs the command line args with stdin as input
+func runCLI(t *testing.T, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(context.Background(), args, &env{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut})
+	return out.String(), errOut.String(), code
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{name: "no command", args: nil, wantCode: exitUsage, wantStderr: "Usage: moonshot"},
+		{name: "help", args: []string{"help"}, wantCode: exitOK, wantStderr: "chat"},
+		{name: "unknown command", args: []string{"nope"}, wantCode: exitUsage, wantStderr: `unknown command "nope"`},
+		{name: "bad flag", args: []string{"chat", "-nope"}, wantCode: exitUsage, wantStderr: "flag provided but not defined"},
+		{name: "command help", args: []string{"chat", "-h"}, wantCode: exitOK, wantStderr: "Usage: moonshot chat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := runCLI(t, "", tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(stderr, tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr, tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestClientFlags_Profile(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "config")
+	content := fmt.Sprintf(`{"profiles": {"test": {"api_key": %q, "base_url": %q, "default_model": "moonshot-v1-8k"}}}`, moonshottest.APIKey, srv.URL)
+	if err := os.WriteFile(config, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(client.EnvConfig, config)
+
+	stdout, stderr, code := runCLI(t, "", "ask", "-profile", "test", "hi")
+	if code != exitOK || stdout != "echo: hi\n" {
+		t.Fatalf("exit code = %d, stdout = %q, stderr = %s", code, stdout, stderr)
+	}
+	if got := srv.LastChatRequest(t).Model; got != "moonshot-v1-8k" {
+		t.Errorf("model = %q, want the profile's default model", got)
+	}
+
+	runCLI(t, "", "ask", "-profile", "test", "-model", "kimi-k2", "hi")
+	if got := srv.LastChatRequest(t).Model; got != "kimi-k2" {
+		t.Errorf("model = %q, want the -model flag", got)
+	}
+
+	_, stderr, code = runCLI(t, "", "ask", "-profile", "nope", "hi")
+	if code != exitError || !strings.Contains(stderr, `unknown profile "nope"`) {
+		t.Errorf("unknown profile: exit code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	baseURL := apierrors.ConfigError{Setting: "base_url", Message: "bad"}
+	apiKey := apierrors.ConfigError{Setting: "api_key", Message: "missing"}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "missing api key", err: apiKey, want: exitAuth},
+		{name: "api key joined after another setting", err: errors.Join(baseURL, apiKey), want: exitAuth},
+		{name: "joined and wrapped", err: fmt.Errorf("creating client: %w", errors.Join(baseURL, apiKey)), want: exitAuth},
+		{name: "other setting", err: errors.Join(baseURL), want: exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+)
+
+func init() {
+	commands["models"] = command{summary: "List models with their context length and capabilities", run: runModels}
+}
+
+// modelRow describes a model known to the SDK, served by the API, or both
+type modelRow struct {
+	ID            string   `json:"id"`
+	ContextLength int      `json:"context_length,omitempty"`
+	Tools         bool     `json:"tools"`
+	Vision        bool     `json:"vision"`
+	Pricing       *pricing `json:"pricing,omitempty"`
+	// Available is nil when the live list was not fetched
+	Available *bool `json:"available,omitempty"`
+}
+
+// pricing is a list price in USD per million tokens
+type pricing struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cached_input"`
+	Output      float64 `json:"output"`
+}
+
+func runModels(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "models", "[flags]")
+	cf := addClientFlags(fs)
+	offline := fs.Bool("offline", false, "list only the models known to the SDK, without calling the API")
+	jsonOut := fs.Bool("json", false, "print the models as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments %q", fs.Args())
+	}
+
+	var rows []modelRow
+	index := map[string]int{}
+	for _, m := range models.All() {
+		row := modelRow{
+			ID:            m.String(),
+			ContextLength: m.MaxTokens(),
+			Tools:         m.SupportsTools(),
+			Vision:        m.SupportsVision(),
+		}
+		if p, ok := m.Pricing(); ok {
+			row.Pricing = &pricing{Input: p.Input, CachedInput: p.CachedInput, Output: p.Output}
+		}
+		index[row.ID] = len(rows)
+		rows = append(rows, row)
+	}
+
+	if !*offline {
+		sdk, err := cf.sdk()
+		if err != nil {
+			return err
+		}
+		live, err := sdk.Models.List(ctx)
+		if err != nil {
+			return fmt.Errorf("listing models: %w", err)
+		}
+		for i := range rows {
+			rows[i].Available = new(bool)
+		}
+		for _, info := range live.Data {
+			i, ok := index[info.ID]
+			if !ok {
+				i = len(rows)
+				index[info.ID] = i
+				rows = append(rows, modelRow{ID: info.ID, Available: new(bool)})
+			}
+			*rows[i].Available = true
+		}
+	}
+
+	if *jsonOut {
+		return printJSON(e.stdout, rows)
+	}
+
+	tw := newTable(e.stdout)
+	fmt.Fprintln(tw, "MODEL\tCONTEXT\tTOOLS\tVISION\tPRICE (IN/OUT)\tAVAILABLE")
+	for _, r := range rows {
+		window, price, available := "-", "-", "-"
+		if r.ContextLength > 0 {
+			window = fmt.Sprintf("%dk", r.ContextLength/1024)
+		}
+		if r.Pricing != nil {
+			price = fmt.Sprintf("$%.2f/$%.2f", r.Pricing.Input, r.Pricing.Output)
+		}
+		if r.Available != nil {
+			available = yesNo(*r.Available)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, window, yesNo(r.Tools), yesNo(r.Vision), price, available)
+	}
+	return tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
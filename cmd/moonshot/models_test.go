@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+)
+
+func TestModels(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+
+	stdout, stderr, code := runCLI(t, "", "models", "-base-url", srv.URL, "-api-key", "sk-test")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "moonshot-v1-8k") || !strings.Contains(stdout, "8k") || !strings.Contains(stdout, "$0.20/$2.00") {
+		t.Errorf("table =\n%s", stdout)
+	}
+	srv.AssertRequestCount(t, "/models", 1)
+
+	stdout, _, code = runCLI(t, "", "models", "-offline", "-json")
+	if code != exitOK {
+		t.Fatalf("offline: exit code = %d", code)
+	}
+	var rows []modelRow
+	if err := json.Unmarshal([]byte(stdout), &rows); err != nil {
+		t.Fatalf("decoding output: %v", err)
+	}
+	if len(rows) != 6 || rows[0].ContextLength != 8192 || rows[0].Available != nil {
+		t.Errorf("rows = %+v", rows)
+	}
+	srv.AssertRequestCount(t, "/models", 1)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/gateway"
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
+)
+
+func init() {
+	commands["serve"] = command{summary: "Serve an OpenAI-compatible API backed by Moonshot", run: runServe}
+}
+
+// keyConfig is an entry of the virtual keys file
+type keyConfig struct {
+	gateway.VirtualKey
+	// RPS and Burst configure a rate limiter for the key
+	RPS   float64 `json:"rps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+func runServe(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "serve", "[flags]")
+	cf := addClientFlags(fs)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	keysPath := fs.String("keys", "", "JSON file of virtual keys; without it any caller is accepted. Each key only sees the files it uploaded")
+	retries := fs.Int("retries", 2, "retries of failed upstream requests")
+	rps := fs.Float64("rps", 0, "upstream requests per second for all callers (default: unlimited)")
+	burst := fs.Int("burst", 1, "requests allowed at once above -rps")
+	cacheSize := fs.Int("cache-size", 0, "number of deterministic chat responses to cache in memory")
+	cacheDir := fs.String("cache-dir", "", "directory to cache chat responses in")
+	cacheTTL := fs.Duration("cache-ttl", 0, "how long cached responses are used (default: forever)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments %q", fs.Args())
+	}
+
+	var opts []gateway.Option
+	if *keysPath != "" {
+		keys, err := loadVirtualKeys(*keysPath)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, gateway.WithVirtualKeys(keys...))
+	}
+	if *rps > 0 {
+		opts = append(opts, gateway.WithRateLimiter(client.NewRateLimiter(*rps, *burst)))
+	}
+	switch {
+	case *cacheDir != "":
+		cache, err := respcache.NewDir(*cacheDir, *cacheTTL)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, gateway.WithChatOptions(chat.WithResponseCache(cache)))
+	case *cacheSize > 0:
+		opts = append(opts, gateway.WithChatOptions(chat.WithResponseCache(respcache.NewMemory(*cacheSize, *cacheTTL))))
+	}
+
+	sdk, err := cf.sdk(client.WithRetryPolicy(client.RetryPolicy{MaxRetries: *retries}))
+	if err != nil {
+		return err
+	}
+	gw := gateway.New(sdk.Client, opts...)
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	log := &syncWriter{w: e.stderr}
+	server := &http.Server{
+		Handler:           logRequests(log, gw),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Fprintf(log, "serving OpenAI-compatible API on http://%s/v1\n", ln.Addr())
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+
+	if usage := gw.Usage(); len(usage) > 0 {
+		tw := newTable(log)
+		fmt.Fprintln(tw, "KEY\tREQUESTS\tFAILED\tTOKENS\tCOST")
+		for _, u := range usage {
+			name := u.Name
+			if name == "" {
+				name = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t$%.4f\n", name, u.Requests, u.Failed, u.TotalTokens, u.Cost)
+		}
+		tw.Flush()
+	}
+	return err
+}
+
+// loadVirtualKeys reads the virtual keys file at path, a JSON array of
+// objects with key, name, token_budget, rps and burst fields
+func loadVirtualKeys(path string) ([]gateway.VirtualKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []keyConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	keys := make([]gateway.VirtualKey, len(configs))
+	seen := map[string]bool{}
+	for i, c := range configs {
+		if c.Key == "" {
+			return nil, fmt.Errorf("%s: key %d has no key", path, i+1)
+		}
+		if seen[c.Key] {
+			return nil, fmt.Errorf("%s: key %d repeats an earlier key", path, i+1)
+		}
+		seen[c.Key] = true
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("key-%d", i+1)
+		}
+		if c.RPS > 0 {
+			c.RateLimiter = client.NewRateLimiter(c.RPS, max(c.Burst, 1))
+		}
+		keys[i] = c.VirtualKey
+	}
+	return keys, nil
+}
+
+// logRequests logs a line per request to w
+func logRequests(w io.Writer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		fmt.Fprintf(w, "%s %s %d %s\n", r.Method, r.URL.Path, sw.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// statusWriter records the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streamed responses through the logging wrapper
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// syncWriter serialises writes from concurrent requests
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
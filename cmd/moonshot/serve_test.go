@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+)
+
+func TestServe(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+
+	keys := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(keys, []byte(`[{"key":"vk-alice","name":"alice","rps":100}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stderr, logw := io.Pipe()
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"serve", "-addr", "127.0.0.1:0", "-keys", keys, "-base-url", srv.URL, "-api-key", "sk-test"},
+			&env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: logw})
+		logw.Close()
+	}()
+
+	lines := bufio.NewScanner(stderr)
+	if !lines.Scan() {
+		t.Fatal("no output from serve")
+	}
+	_, url, ok := strings.Cut(lines.Text(), " on ")
+	if !ok {
+		t.Fatalf("unexpected first line %q", lines.Text())
+	}
+	var log strings.Builder
+	logged := make(chan struct{})
+	go func() {
+		for lines.Scan() {
+			log.WriteString(lines.Text() + "\n")
+		}
+		close(logged)
+	}()
+
+	req, _ := http.NewRequest(http.MethodPost, url+"/chat/completions",
+		strings.NewReader(`{"model":"kimi-k2","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer vk-alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "echo: hi") {
+		t.Errorf("status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	cancel()
+	if code := <-done; code != exitOK {
+		t.Errorf("exit code = %d", code)
+	}
+	<-logged
+	for _, want := range []string{"POST /v1/chat/completions 200", "alice"} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("log does not contain %q:\n%s", want, log.String())
+		}
+	}
+}
+
+func TestLoadVirtualKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: `[{"key":"vk-1","token_budget":1000},{"key":"vk-2","name":"bob","rps":2}]`},
+		{name: "missing key", content: `[{"name":"alice"}]`, wantErr: "key 1 has no key"},
+		{name: "duplicate", content: `[{"key":"vk-1"},{"key":"vk-1"}]`, wantErr: "key 2 repeats an earlier key"},
+		{name: "not json", content: `{`, wantErr: "parsing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			os.WriteFile(path, []byte(tt.content), 0o600)
+			keys, err := loadVirtualKeys(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != 2 || keys[0].Name != "key-1" || keys[0].TokenBudget != 1000 || keys[1].RateLimiter == nil {
+				t.Errorf("keys = %+v", keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func init() {
+	commands["tokens"] = command{summary: "Count the tokens in files or stdin and check which models they fit", run: runTokens}
+}
+
+// tokenReport is the output of the tokens command
+type tokenReport struct {
+	Model  string     `json:"model"`
+	Tokens int        `json:"tokens"`
+	Fits   []modelFit `json:"fits"`
+}
+
+// modelFit tells whether a token count fits a model's context window
+type modelFit struct {
+	Model     string `json:"model"`
+	MaxTokens int    `json:"max_tokens"`
+	Fits      bool   `json:"fits"`
+}
+
+func runTokens(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "tokens", "[flags] [file...]")
+	cf := addClientFlags(fs)
+	model := cf.addModelFlag(fs, "model whose tokenizer counts the tokens")
+	system := fs.String("system", "", "system prompt to include in the count")
+	jsonOut := fs.Bool("json", false, "print the result as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		if !isPiped(e.stdin) {
+			return usagef("no files given and nothing piped to stdin")
+		}
+		paths = []string{"-"}
+	}
+
+	var messages []types.Message
+	if *system != "" {
+		messages = append(messages, types.Message{Role: "system", Content: *system})
+	}
+	for _, path := range paths {
+		text, err := readInput(e.stdin, path)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, types.Message{Role: "user", Content: text})
+	}
+
+	sdk, err := cf.sdk()
+	if err != nil {
+		return err
+	}
+	resp, err := sdk.Chat.CountTokens(ctx, types.TokenCountRequest{Model: *model, Messages: messages})
+	if err != nil {
+		return err
+	}
+
+	report := tokenReport{Model: *model, Tokens: resp.TokenCount}
+	for _, m := range models.All() {
+		report.Fits = append(report.Fits, modelFit{
+			Model:     m.String(),
+			MaxTokens: m.MaxTokens(),
+			Fits:      resp.TokenCount <= m.MaxTokens(),
+		})
+	}
+	if *jsonOut {
+		return printJSON(e.stdout, report)
+	}
+
+	fmt.Fprintf(e.stdout, "%d tokens (counted for %s)\n\n", report.Tokens, report.Model)
+	tw := newTable(e.stdout)
+	fmt.Fprintln(tw, "MODEL\tCONTEXT\tUSED\tFITS")
+	for _, f := range report.Fits {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t%s\n", f.Model, f.MaxTokens, 100*float64(report.Tokens)/float64(f.MaxTokens), yesNo(f.Fits))
+	}
+	return tw.Flush()
+}
+
+// readInput returns the contents of the file at path, or of stdin if path
+// is "-"
+func readInput(stdin io.Reader, path string) (string, error) {
+	if path == "-" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading stdin: %w", err)
+		}
+		return string(data), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
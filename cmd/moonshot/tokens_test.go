@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+)
+
+func TestTokens(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	api := []string{"-base-url", srv.URL, "-api-key", "sk-test"}
+
+	stdout, stderr, code := runCLI(t, "Hello, world, how are you?", append([]string{"tokens"}, api...)...)
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, "11 tokens (counted for kimi-k2)") || !strings.Contains(stdout, "moonshot-v1-8k") {
+		t.Errorf("stdout =\n%s", stdout)
+	}
+
+	big := filepath.Join(t.TempDir(), "big.txt")
+	if err := os.WriteFile(big, []byte(strings.Repeat("abcd", 10_000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code = runCLI(t, "", append(append([]string{"tokens", "-json"}, api...), big)...)
+	if code != exitOK {
+		t.Fatalf("file: exit code = %d, stderr = %s", code, stderr)
+	}
+	var report tokenReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("decoding output: %v", err)
+	}
+	fits := map[string]bool{}
+	for _, f := range report.Fits {
+		fits[f.Model] = f.Fits
+	}
+	if report.Tokens != 10_004 || fits["moonshot-v1-8k"] || !fits["moonshot-v1-32k"] {
+		t.Errorf("report = %+v", report)
+	}
+
+	if _, _, code := runCLI(t, "", append(append([]string{"tokens"}, api...), "missing.txt")...); code != exitError {
+		t.Errorf("missing file: exit code = %d, want %d", code, exitError)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rizome-dev/go-moonshot/internal/version"
+)
+
+func init() {
+	commands["version"] = command{summary: "Print build information", run: runVersion}
+}
+
+func runVersion(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "version", "[flags]")
+	jsonOut := fs.Bool("json", false, "print the build information as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		return printJSON(e.stdout, version.Get())
+	}
+	fmt.Fprintln(e.stdout, version.String())
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/internal/version"
+)
+
+func TestVersion(t *testing.T) {
+	stdout, _, code := runCLI(t, "", "version")
+	if code != exitOK || !strings.Contains(stdout, "Version: "+version.Version) {
+		t.Errorf("exit code = %d, stdout = %q", code, stdout)
+	}
+
+	stdout, _, _ = runCLI(t, "", "version", "-json")
+	var info version.BuildInfo
+	if err := json.Unmarshal([]byte(stdout), &info); err != nil || info.GoVersion == "" {
+		t.Errorf("build info = %+v, %v", info, err)
+	}
+}
@@ -2,6 +2,8 @@
 package moonshot
 
 import (
+	"github.com/rizome-dev/go-moonshot/pkg/balance"
+	"github.com/rizome-dev/go-moonshot/pkg/cache"
 	"github.com/rizome-dev/go-moonshot/pkg/chat"
 	"github.com/rizome-dev/go-moonshot/pkg/client"
 	"github.com/rizome-dev/go-moonshot/pkg/errors"
@@ -25,11 +27,20 @@ type (
 	ChatCompletionStreamChoice = types.ChatCompletionStreamChoice
 	ChatCompletionStreamDelta  = types.ChatCompletionStreamDelta
 	
+	// Fan-out types
+	FanOutOptions = chat.FanOutOptions
+	FanOutResult  = chat.FanOutResult
+	RateLimiter   = client.RateLimiter
+	
 	// File types
 	File           = types.File
 	FileUploadReq  = types.FileUploadRequest
 	FileListParams = types.FileListParams
 	
+	// Context cache types
+	ContextCache              = types.ContextCache
+	ContextCacheCreateRequest = types.ContextCacheCreateRequest
+	
 	// Tool types
 	Tool         = types.Tool
 	ToolCall     = types.ToolCall
@@ -37,9 +48,22 @@ type (
 	Function     = types.Function
 	FunctionCall = types.FunctionCall
 	
+	// Request option types
+	RequestOption = client.RequestOption
+	ResponseMeta  = client.ResponseMeta
+	RetryPolicy   = client.RetryPolicy
+	Config        = client.Config
+	
+	// Account types
+	Balance   = types.Balance
+	ModelInfo = types.ModelInfo
+	
 	// Error types
-	Error    = errors.Error
-	APIError = errors.APIError
+	Error        = errors.Error
+	APIError     = errors.APIError
+	BalanceError = errors.BalanceError
+	ConfigError  = errors.ConfigError
+	RateLimit    = errors.RateLimit
 )
 
 // Re-export model constants
@@ -63,8 +87,36 @@ var (
 	Time    = utils.Time
 )
 
+// Re-export request options
+var (
+	WithHeader             = client.WithHeader
+	WithExtraBody          = client.WithExtraBody
+	WithRequestTimeout     = client.WithRequestTimeout
+	WithIdempotencyKey     = client.WithIdempotencyKey
+	WithRequestBaseURL     = client.WithRequestBaseURL
+	WithRequestAPIKey      = client.WithRequestAPIKey
+	WithRequestRetryPolicy = client.WithRequestRetryPolicy
+	WithResponseMeta       = client.WithResponseMeta
+)
+
+// Re-export client helpers
+var (
+	NewRateLimiter = client.NewRateLimiter
+	LoadConfig     = client.LoadConfig
+)
+
+// Re-export message and tool helpers
+var (
+	PartialMessage = types.PartialMessage
+	BuiltinTool    = types.BuiltinTool
+	WebSearchTool  = types.WebSearchTool
+)
+
 // Re-export error helper functions
-var IsAPIError = errors.IsAPIError
+var (
+	IsAPIError     = errors.IsAPIError
+	IsBalanceError = errors.IsBalanceError
+)
 
 // Re-export error code constants
 const (
@@ -77,28 +129,82 @@ const (
 	ErrCodeTimeout           = errors.ErrCodeTimeout
 )
 
+// BalanceService queries the account balance
+type BalanceService = balance.Service
+
 // SDK provides a convenient all-in-one client with all services
 type SDK struct {
-	Client *client.Client
-	Chat   *chat.Service
-	Files  *files.Service
+	Client  *client.Client
+	Chat    *chat.Service
+	Files   *files.Service
+	Cache   *cache.Service
+	Balance *balance.Service
+	Models  *models.Service
 }
 
 // New creates a new Moonshot SDK instance with all services initialized.
 // This is a convenience wrapper for users who want everything in one place.
+// It accepts an API key string, client options and chat service options,
+// and is kept for compatibility: parameters of other types are ignored and
+// the configuration is not validated. NewSDK reports mistakes instead.
 //
 // Usage:
 //
 //	sdk := moonshot.New()                           // Uses MOONSHOT_API_KEY env var
 //	sdk := moonshot.New("sk-...")                  // Uses provided API key
 //	sdk := moonshot.New(client.WithTimeout(30*time.Second))  // With options
+//	sdk := moonshot.New(chat.WithResponseCache(cache))      // With chat service options
 func New(params ...interface{}) *SDK {
 	c := client.New(params...)
 	
+	var chatOpts []chat.ServiceOption
+	for _, param := range params {
+		if opt, ok := param.(chat.ServiceOption); ok {
+			chatOpts = append(chatOpts, opt)
+		}
+	}
+	
+	return NewFromClient(c, chatOpts...)
+}
+
+// NewSDK creates an SDK from typed client options, returning an error
+// if the configuration is invalid (see client.NewClient).
+//
+//	sdk, err := moonshot.NewSDK(
+//		client.WithAPIKey("sk-..."),
+//		client.WithTimeout(60*time.Second),
+//	)
+func NewSDK(opts ...client.Option) (*SDK, error) {
+	c, err := client.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromClient(c), nil
+}
+
+// NewFromConfig creates an SDK whose client is configured by cfg, usually
+// the result of LoadConfig. opts are applied after the configuration.
+//
+//	cfg, err := moonshot.LoadConfig("cn")
+//	if err != nil { ... }
+//	sdk, err := moonshot.NewFromConfig(cfg)
+func NewFromConfig(cfg *Config, opts ...client.Option) (*SDK, error) {
+	c, err := client.NewFromConfig(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromClient(c), nil
+}
+
+// NewFromClient creates an SDK whose services use c
+func NewFromClient(c *client.Client, chatOpts ...chat.ServiceOption) *SDK {
 	return &SDK{
-		Client: c,
-		Chat:   chat.NewService(c),
-		Files:  files.NewService(c),
+		Client:  c,
+		Chat:    chat.NewService(c, chatOpts...),
+		Files:   files.NewService(c),
+		Cache:   cache.NewService(c),
+		Balance: balance.NewService(c),
+		Models:  models.NewService(c),
 	}
 }
 
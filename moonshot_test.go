@@ -1,9 +1,17 @@
 package moonshot_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	
 	"github.com/rizome-dev/go-moonshot"
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
 )
 
 func TestVersion(t *testing.T) {
@@ -33,6 +41,15 @@ func TestNew(t *testing.T) {
 		if sdk.Files == nil {
 			t.Error("SDK.Files is nil")
 		}
+		if sdk.Cache == nil {
+			t.Error("SDK.Cache is nil")
+		}
+		if sdk.Balance == nil {
+			t.Error("SDK.Balance is nil")
+		}
+		if sdk.Models == nil {
+			t.Error("SDK.Models is nil")
+		}
 	})
 	
 	// Test with API key parameter
@@ -41,5 +58,49 @@ func TestNew(t *testing.T) {
 		if sdk == nil {
 			t.Fatal("New() returned nil")
 		}
+	})	
+	// Test with chat service options
+	t.Run("with chat options", func(t *testing.T) {
+		var calls int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			json.NewEncoder(w).Encode(moonshot.ChatCompletionResponse{
+				Choices: []moonshot.Choice{{Message: moonshot.Message{Role: "assistant", Content: "Hi"}, FinishReason: "stop"}},
+			})
+		}))
+		defer server.Close()
+		
+		sdk := moonshot.New("test-key", client.WithBaseURL(server.URL), chat.WithResponseCache(respcache.NewMemory(10, 0)))
+		temperature := 0.0
+		req := moonshot.ChatCompletionRequest{
+			Model:       string(moonshot.ModelKimiK2),
+			Messages:    []moonshot.Message{{Role: "user", Content: "Hi"}},
+			Temperature: &temperature,
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := sdk.Chat.CreateCompletion(context.Background(), req); err != nil {
+				t.Fatalf("CreateCompletion() error = %v", err)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
 	})
-}
\ No newline at end of file
+}
+
+func TestNewSDK(t *testing.T) {
+	sdk, err := moonshot.NewSDK(client.WithAPIKey("test-key"), client.WithBaseURL("https://api.moonshot.cn/v1"))
+	if err != nil {
+		t.Fatalf("NewSDK() error = %v", err)
+	}
+	if sdk.Chat == nil || sdk.Client.BaseURL() != "https://api.moonshot.cn/v1" {
+		t.Errorf("NewSDK() = %+v", sdk)
+	}
+
+	t.Setenv(client.EnvAPIKey, "")
+	_, err = moonshot.NewSDK()
+	var configErr moonshot.ConfigError
+	if !errors.As(err, &configErr) || configErr.Setting != "api_key" {
+		t.Errorf("NewSDK() without key: error = %v, want a ConfigError for api_key", err)
+	}
+}
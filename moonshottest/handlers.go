@@ -0,0 +1,360 @@
+package moonshottest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+// storedFile is an uploaded file held in memory
+type storedFile struct {
+	file    types.File
+	content []byte
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.URL.Path = trimVersion(r.URL.Path)
+
+	recorded := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/chat/completions" {
+		var chat types.ChatCompletionRequest
+		if err := json.Unmarshal(body, &chat); err == nil {
+			recorded.Chat = &chat
+		}
+	}
+	s.record(recorded)
+
+	w.Header().Set("Msh-Request-Id", s.nextID("req"))
+
+	if key := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer")); key == "" {
+		writeError(w, http.StatusUnauthorized, "invalid_authentication_error", "Invalid Authentication")
+		return
+	}
+
+	fault := s.takeFault(r.URL.Path)
+	if fault != nil && fault.Status != 0 {
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(fault.RetryAfter.Seconds()))))
+		}
+		writeError(w, fault.Status, fault.Type, fault.Message)
+		return
+	}
+
+	if r.URL.Path == "/chat/completions" && r.Method == http.MethodPost {
+		s.handleChat(w, r, recorded.Chat, fault)
+		return
+	}
+
+	if fault != nil && !sleep(r, fault.Delay) {
+		return
+	}
+	if fault != nil && fault.Malformed {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object": "list", "data": [`)
+		return
+	}
+
+	s.routes.ServeHTTP(w, r)
+}
+
+// newMux routes the endpoints other than chat completions
+func (s *Server) newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tokenizers/estimate_token_count", s.handleTokens)
+	mux.HandleFunc("GET /models", s.handleModels)
+	mux.HandleFunc("GET /users/me/balance", s.handleBalance)
+	mux.HandleFunc("POST /files", s.handleFileUpload)
+	mux.HandleFunc("GET /files", s.handleFileList)
+	mux.HandleFunc("GET /files/{id}", s.handleFileGet)
+	mux.HandleFunc("DELETE /files/{id}", s.handleFileDelete)
+	mux.HandleFunc("GET /files/{id}/content", s.handleFileContent)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "resource_not_found_error", fmt.Sprintf("no route for %s %s", r.Method, r.URL.Path))
+	})
+	return mux
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request, req *types.ChatCompletionRequest, fault *Fault) {
+	if req == nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must not be empty")
+		return
+	}
+
+	reply := s.nextReply(*req)
+	usage := reply.Usage
+	if usage == nil {
+		prompt := estimateMessageTokens(req.Messages)
+		completion := estimateTokens(reply.Content) + estimateTokens(reply.ReasoningContent)
+		usage = &types.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	}
+
+	id := s.nextID("chatcmpl")
+	created := time.Now().Unix()
+
+	if req.Stream != nil && *req.Stream {
+		s.streamChat(w, r, *req, reply, usage, id, created, fault)
+		return
+	}
+
+	if fault != nil && !sleep(r, fault.Delay) {
+		return
+	}
+	if fault != nil && fault.Malformed {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": %q, "choices": [{"message": {"content": "`, id)
+		return
+	}
+
+	msg := types.Message{
+		Role:      "assistant",
+		Content:   reply.Content,
+		ToolCalls: reply.ToolCalls,
+	}
+	if reply.ReasoningContent != "" {
+		msg.ReasoningContent = utils.String(reply.ReasoningContent)
+	}
+	writeJSON(w, http.StatusOK, types.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   req.Model,
+		Choices: []types.Choice{{Message: msg, FinishReason: reply.finishReason()}},
+		Usage:   *usage,
+	})
+}
+
+func (s *Server) streamChat(w http.ResponseWriter, r *http.Request, req types.ChatCompletionRequest, reply Reply, usage *types.Usage, id string, created int64, fault *Fault) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	if fault != nil && !sleep(r, fault.Delay) {
+		return
+	}
+
+	send := func(delta types.ChatCompletionStreamDelta, finishReason *string, usage *types.Usage) {
+		data, _ := json.Marshal(types.ChatCompletionStream{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   req.Model,
+			Choices: []types.ChatCompletionStreamChoice{{
+				Delta:        delta,
+				FinishReason: finishReason,
+				Usage:        usage,
+			}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flush()
+	}
+
+	send(types.ChatCompletionStreamDelta{Role: utils.String("assistant"), Content: utils.String("")}, nil, nil)
+
+	if reply.ReasoningContent != "" {
+		for _, part := range strings.SplitAfter(reply.ReasoningContent, " ") {
+			send(types.ChatCompletionStreamDelta{ReasoningContent: utils.String(part)}, nil, nil)
+		}
+	}
+
+	for i, part := range reply.chunks() {
+		send(types.ChatCompletionStreamDelta{Content: utils.String(part)}, nil, nil)
+		if i == 0 && fault != nil && fault.Malformed {
+			io.WriteString(w, "data: {\"choices\": [{\"delta\": \n\n")
+			flush()
+			return
+		}
+	}
+
+	if len(reply.ToolCalls) > 0 {
+		calls := make([]types.ToolCall, len(reply.ToolCalls))
+		for i, tc := range reply.ToolCalls {
+			tc.Index = utils.Int(i)
+			calls[i] = tc
+		}
+		send(types.ChatCompletionStreamDelta{ToolCalls: calls}, nil, nil)
+	}
+
+	send(types.ChatCompletionStreamDelta{}, utils.String(reply.finishReason()), usage)
+	io.WriteString(w, "data: [DONE]\n\n")
+	flush()
+}
+
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	var req types.TokenCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	writeJSON(w, http.StatusOK, types.TokenCountResponse{TokenCount: estimateMessageTokens(req.Messages)})
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	all := models.All()
+	list := make([]types.ModelInfo, len(all))
+	for i, m := range all {
+		list[i] = types.ModelInfo{ID: m.String(), Object: "model", OwnedBy: "moonshot"}
+	}
+	writeJSON(w, http.StatusOK, types.ModelListResponse{Object: "list", Data: list})
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	balance := s.balance
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, types.BalanceResponse{Code: 0, Data: balance, SCode: "0x0", Status: true})
+}
+
+func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "missing file")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "reading file")
+		return
+	}
+
+	f := s.AddFile(types.File{
+		CreatedAt: time.Now().Unix(),
+		Filename:  header.Filename,
+		Purpose:   r.FormValue("purpose"),
+	}, content)
+	writeJSON(w, http.StatusOK, f)
+}
+
+func (s *Server) handleFileList(w http.ResponseWriter, r *http.Request) {
+	purpose := r.URL.Query().Get("purpose")
+
+	s.mu.Lock()
+	data := []types.File{}
+	for _, id := range s.fileOrder {
+		if f := s.files[id].file; purpose == "" || f.Purpose == purpose {
+			data = append(data, f)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, types.FileListResponse{Object: "list", Data: data})
+}
+
+func (s *Server) handleFileGet(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.file(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, f.file)
+}
+
+func (s *Server) handleFileDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.file(w, id); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.files, id)
+	for i, fid := range s.fileOrder {
+		if fid == id {
+			s.fileOrder = append(s.fileOrder[:i], s.fileOrder[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "object": "file", "deleted": true})
+}
+
+// handleFileContent serves the file content. Like the real API, files
+// uploaded for extraction are returned as a JSON document holding the text.
+func (s *Server) handleFileContent(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.file(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if f.file.Purpose == "file-extract" {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"content":   string(f.content),
+			"file_type": http.DetectContentType(f.content),
+			"filename":  f.file.Filename,
+			"title":     "",
+			"type":      "file",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(f.content)
+}
+
+// file looks up a stored file, answering 404 if there is none
+func (s *Server) file(w http.ResponseWriter, id string) (*storedFile, bool) {
+	s.mu.Lock()
+	f, ok := s.files[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "resource_not_found_error", fmt.Sprintf("file %s not found", id))
+	}
+	return f, ok
+}
+
+// sleep waits for d or until the client goes away, reporting whether the
+// response should still be written
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// estimateTokens approximates the token count of text at four characters
+// per token
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// estimateMessageTokens approximates the prompt tokens of messages,
+// counting a few tokens of overhead per message
+func estimateMessageTokens(messages []types.Message) int {
+	total := 0
+	for _, m := range messages {
+		content, _ := m.Content.(string)
+		total += estimateTokens(content) + 4
+	}
+	return total
+}
@@ -0,0 +1,117 @@
+package moonshottest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// Reply is a scripted chat completion answer
+type Reply struct {
+	Content          string
+	ReasoningContent string
+	ToolCalls        []types.ToolCall
+	// FinishReason defaults to "tool_calls" when ToolCalls is set and
+	// "stop" otherwise
+	FinishReason string
+	// Usage defaults to an estimate from the request and reply text
+	Usage *types.Usage
+	// Chunks is how Content is split when streamed. By default it is
+	// streamed word by word.
+	Chunks []string
+}
+
+// EchoReply answers with the text of the last user message, prefixed with
+// "echo: ". It is the default reply of a Server.
+func EchoReply(req types.ChatCompletionRequest) Reply {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			content, _ := req.Messages[i].Content.(string)
+			return Reply{Content: "echo: " + content}
+		}
+	}
+	return Reply{Content: "echo: "}
+}
+
+func (r Reply) finishReason() string {
+	switch {
+	case r.FinishReason != "":
+		return r.FinishReason
+	case len(r.ToolCalls) > 0:
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+func (r Reply) chunks() []string {
+	if r.Chunks != nil {
+		return r.Chunks
+	}
+	if r.Content == "" {
+		return nil
+	}
+	return strings.SplitAfter(r.Content, " ")
+}
+
+// Fault makes the server misbehave for matching requests
+type Fault struct {
+	// Path limits the fault to requests whose path starts with Path, such
+	// as "/chat/completions". Empty matches every request.
+	Path string
+	// Times is the number of requests the fault applies to; zero means 1
+	// and a negative value means every matching request
+	Times int
+
+	// Status, if set, makes the server answer with an API error of this
+	// status, Type and Message
+	Status  int
+	Type    string
+	Message string
+	// RetryAfter is sent as the Retry-After header of an error response
+	RetryAfter time.Duration
+
+	// Malformed sends a response that cannot be decoded: an invalid chunk
+	// in a stream, or a truncated JSON body
+	Malformed bool
+	// Delay holds the response back. Streams send their headers first, so
+	// the delay is before the first token.
+	Delay time.Duration
+}
+
+// RateLimited returns a fault answering with 429 and a Retry-After header
+func RateLimited(retryAfter time.Duration) Fault {
+	return Fault{
+		Status:     http.StatusTooManyRequests,
+		Type:       errors.ErrTypeRateLimit,
+		Message:    "rate limit reached",
+		RetryAfter: retryAfter,
+	}
+}
+
+// ServerError returns a fault answering with 500
+func ServerError() Fault {
+	return Fault{
+		Status:  http.StatusInternalServerError,
+		Type:    "server_error",
+		Message: "internal server error",
+	}
+}
+
+// MalformedStream returns a fault that breaks the SSE stream after its
+// first chunk
+func MalformedStream() Fault {
+	return Fault{Path: "/chat/completions", Malformed: true}
+}
+
+// SlowFirstToken returns a fault delaying the first token of a completion
+func SlowFirstToken(delay time.Duration) Fault {
+	return Fault{Path: "/chat/completions", Delay: delay}
+}
+
+func (f Fault) matches(path string) bool {
+	return strings.HasPrefix(path, f.Path)
+}
@@ -0,0 +1,289 @@
+// Package moonshottest provides an in-process fake of the Moonshot API for
+// tests of code built on the SDK.
+//
+// The fake serves chat completions (streaming and not), token counting,
+// files, models and the account balance. Chat replies are scripted, every
+// request is recorded for assertions, and faults such as rate limits or
+// broken streams can be injected:
+//
+//	srv := moonshottest.NewServer()
+//	defer srv.Close()
+//
+//	srv.EnqueueReply(moonshottest.Reply{Content: "Hello"})
+//	srv.InjectFault(moonshottest.RateLimited(time.Second))
+//
+//	sdk := srv.SDK()
+//	// ... exercise code using sdk ...
+//	srv.AssertRequestCount(t, "/chat/completions", 2)
+package moonshottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// APIKey is the key the clients returned by Server are configured with. The
+// fake accepts any non-empty key.
+const APIKey = "sk-moonshottest"
+
+// Request is a request received by a Server
+type Request struct {
+	Method string
+	// Path is the request path with any /v1 prefix removed
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+	// Chat is the decoded body of chat completion requests
+	Chat *types.ChatCompletionRequest
+}
+
+// Server is a fake Moonshot API server
+type Server struct {
+	*httptest.Server
+
+	routes *http.ServeMux
+
+	mu        sync.Mutex
+	requests  []Request
+	replies   []Reply
+	replyFunc func(types.ChatCompletionRequest) Reply
+	faults    []*activeFault
+	files     map[string]*storedFile
+	fileOrder []string
+	balance   types.Balance
+	seq       int
+}
+
+type activeFault struct {
+	Fault
+	remaining int
+}
+
+// NewServer starts a fake server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		replyFunc: EchoReply,
+		files:     make(map[string]*storedFile),
+		balance: types.Balance{
+			AvailableBalance: 100,
+			CashBalance:      100,
+		},
+	}
+	s.routes = s.newMux()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a client for the server. opts are applied after the
+// base URL and API key are set.
+func (s *Server) Client(opts ...client.Option) *client.Client {
+	params := []interface{}{APIKey, client.WithBaseURL(s.URL)}
+	for _, opt := range opts {
+		params = append(params, opt)
+	}
+	return client.New(params...)
+}
+
+// SDK returns an SDK for the server. params are passed to moonshot.New
+// after the base URL and API key.
+func (s *Server) SDK(params ...interface{}) *moonshot.SDK {
+	return moonshot.New(append([]interface{}{APIKey, client.WithBaseURL(s.URL)}, params...)...)
+}
+
+// EnqueueReply queues replies for the next chat completions, in order.
+// Once the queue is empty the reply function is used.
+func (s *Server) EnqueueReply(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// SetReplyFunc sets how chat completions are answered when no reply is
+// queued. The default is EchoReply.
+func (s *Server) SetReplyFunc(fn func(types.ChatCompletionRequest) Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replyFunc = fn
+}
+
+// InjectFault adds a fault. Faults apply in the order they were added; a
+// request is affected by the first matching fault with uses left.
+func (s *Server) InjectFault(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range faults {
+		remaining := f.Times
+		if remaining == 0 {
+			remaining = 1
+		}
+		s.faults = append(s.faults, &activeFault{Fault: f, remaining: remaining})
+	}
+}
+
+// SetBalance sets the balance reported by /users/me/balance
+func (s *Server) SetBalance(balance types.Balance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance = balance
+}
+
+// AddFile stores a file as if it had been uploaded, for tests that need
+// files with a given age or purpose. An empty ID is assigned, as are the
+// size and status.
+func (s *Server) AddFile(file types.File, content []byte) types.File {
+	if file.ID == "" {
+		file.ID = s.nextID("file")
+	}
+	if file.Object == "" {
+		file.Object = "file"
+	}
+	if file.Status == "" {
+		file.Status = "ok"
+	}
+	file.Bytes = int64(len(content))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[file.ID]; !ok {
+		s.fileOrder = append(s.fileOrder, file.ID)
+	}
+	s.files[file.ID] = &storedFile{file: file, content: content}
+	return file
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ChatRequests returns the chat completion requests received so far
+func (s *Server) ChatRequests() []types.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reqs []types.ChatCompletionRequest
+	for _, r := range s.requests {
+		if r.Chat != nil {
+			reqs = append(reqs, *r.Chat)
+		}
+	}
+	return reqs
+}
+
+// LastChatRequest returns the most recent chat completion request. It fails
+// t if there is none.
+func (s *Server) LastChatRequest(t testing.TB) types.ChatCompletionRequest {
+	t.Helper()
+	reqs := s.ChatRequests()
+	if len(reqs) == 0 {
+		t.Fatal("moonshottest: no chat completion requests received")
+	}
+	return reqs[len(reqs)-1]
+}
+
+// AssertRequestCount fails t unless exactly n requests were received for
+// path. An empty path counts every request.
+func (s *Server) AssertRequestCount(t testing.TB, path string, n int) {
+	t.Helper()
+	count := 0
+	for _, r := range s.Requests() {
+		if path == "" || r.Path == path {
+			count++
+		}
+	}
+	if count != n {
+		t.Errorf("moonshottest: got %d requests for %q, want %d", count, path, n)
+	}
+}
+
+// Reset clears recorded requests, queued replies, faults and files
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.replies = nil
+	s.faults = nil
+	s.files = make(map[string]*storedFile)
+	s.fileOrder = nil
+}
+
+// nextID returns a new identifier with the given prefix
+func (s *Server) nextID(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return fmt.Sprintf("%s-%d", prefix, s.seq)
+}
+
+// takeFault returns the fault for a request to path, if any
+func (s *Server) takeFault(path string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if f.remaining == 0 || !f.matches(path) {
+			continue
+		}
+		if f.remaining > 0 {
+			f.remaining--
+		}
+		if f.remaining == 0 {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+		}
+		fault := f.Fault
+		return &fault
+	}
+	return nil
+}
+
+// nextReply returns the reply for req
+func (s *Server) nextReply(req types.ChatCompletionRequest) Reply {
+	s.mu.Lock()
+	if len(s.replies) > 0 {
+		reply := s.replies[0]
+		s.replies = s.replies[1:]
+		s.mu.Unlock()
+		return reply
+	}
+	fn := s.replyFunc
+	s.mu.Unlock()
+	return fn(req)
+}
+
+func (s *Server) record(r Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an API error response
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]string{"type": errType, "message": message},
+	})
+}
+
+// trimVersion removes the /v1 prefix used by the real API's base URL
+func trimVersion(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/v1/"); ok {
+		return "/" + rest
+	}
+	return path
+}
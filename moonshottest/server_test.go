@@ -0,0 +1,249 @@
+package moonshottest_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func chatRequest(content string) types.ChatCompletionRequest {
+	return types.ChatCompletionRequest{
+		Model:    "kimi-k2-0711-preview",
+		Messages: []types.Message{{Role: "user", Content: content}},
+	}
+}
+
+func TestServer_Chat(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	sdk := srv.SDK()
+	ctx := context.Background()
+
+	srv.EnqueueReply(moonshottest.Reply{Content: "Scripted answer", Usage: &types.Usage{TotalTokens: 42}})
+
+	resp, err := sdk.Chat.CreateCompletion(ctx, chatRequest("Hi"))
+	if err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	if resp.Choices[0].Message.Content != "Scripted answer" || resp.Usage.TotalTokens != 42 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	// The queue is empty, so the default echo reply is streamed
+	stream, err := sdk.Chat.CreateCompletionStream(ctx, chatRequest("stream me"))
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+	acc := stream.Accumulated()
+	var deltas int
+	for _, err := range stream.Deltas() {
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		deltas++
+	}
+	if acc.Content() != "echo: stream me" || deltas != 3 {
+		t.Errorf("stream content = %q in %d deltas", acc.Content(), deltas)
+	}
+	if acc.Usage() == nil || acc.Usage().CompletionTokens == 0 {
+		t.Errorf("stream usage = %+v", acc.Usage())
+	}
+
+	srv.AssertRequestCount(t, "/chat/completions", 2)
+	if last := srv.LastChatRequest(t); last.Messages[0].Content != "stream me" {
+		t.Errorf("LastChatRequest() = %+v", last)
+	}
+	if auth := srv.Requests()[0].Header.Get("Authorization"); auth != "Bearer "+moonshottest.APIKey {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+func TestServer_ToolCalls(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+
+	srv.EnqueueReply(moonshottest.Reply{ToolCalls: []types.ToolCall{{
+		ID:       "call_1",
+		Type:     types.ToolTypeFunction,
+		Function: types.FunctionCall{Name: "lookup", Arguments: `{"q":"x"}`},
+	}}})
+
+	stream, err := srv.SDK().Chat.CreateCompletionStream(context.Background(), chatRequest("Hi"))
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+	acc := stream.Accumulated()
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+	}
+
+	choice := acc.Response().Choices[0]
+	if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Name != "lookup" {
+		t.Errorf("choice = %+v", choice)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rate limited then retried", func(t *testing.T) {
+		srv := moonshottest.NewServer()
+		defer srv.Close()
+
+		// Without Retry-After the client's own backoff applies
+		srv.InjectFault(moonshottest.RateLimited(0))
+		policy := client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+		sdk := srv.SDK(client.WithRetryPolicy(policy))
+
+		var meta client.ResponseMeta
+		if _, err := sdk.Chat.CreateCompletion(ctx, chatRequest("Hi"), client.WithResponseMeta(&meta)); err != nil {
+			t.Fatalf("CreateCompletion() error = %v", err)
+		}
+		if meta.Attempts != 2 {
+			t.Errorf("Attempts = %d, want 2", meta.Attempts)
+		}
+	})
+
+	t.Run("error details", func(t *testing.T) {
+		srv := moonshottest.NewServer()
+		defer srv.Close()
+
+		srv.InjectFault(moonshottest.RateLimited(3 * time.Second))
+		_, err := srv.SDK().Chat.CreateCompletion(ctx, chatRequest("Hi"))
+		apiErr, ok := errors.IsAPIError(err)
+		if !ok {
+			t.Fatalf("error = %v, want APIError", err)
+		}
+		if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 3*time.Second || apiErr.RequestID == "" {
+			t.Errorf("APIError = %+v", apiErr)
+		}
+	})
+
+	t.Run("scoped by path and count", func(t *testing.T) {
+		srv := moonshottest.NewServer()
+		defer srv.Close()
+		sdk := srv.SDK()
+
+		fault := moonshottest.ServerError()
+		fault.Path = "/files"
+		fault.Times = 2
+		srv.InjectFault(fault)
+
+		if _, err := sdk.Chat.CreateCompletion(ctx, chatRequest("Hi")); err != nil {
+			t.Errorf("CreateCompletion() error = %v, want unaffected", err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := sdk.Files.List(ctx, nil); err == nil {
+				t.Errorf("List() #%d error = nil, want 500", i+1)
+			}
+		}
+		if _, err := sdk.Files.List(ctx, nil); err != nil {
+			t.Errorf("List() error = %v after fault expired", err)
+		}
+	})
+
+	t.Run("malformed stream", func(t *testing.T) {
+		srv := moonshottest.NewServer()
+		defer srv.Close()
+
+		srv.InjectFault(moonshottest.MalformedStream())
+		stream, err := srv.SDK().Chat.CreateCompletionStream(ctx, chatRequest("Hi there"))
+		if err != nil {
+			t.Fatalf("CreateCompletionStream() error = %v", err)
+		}
+		defer stream.Close()
+
+		var streamErr error
+		for _, err := range stream.All() {
+			streamErr = err
+		}
+		if streamErr == nil || !strings.Contains(streamErr.Error(), "parsing stream chunk") {
+			t.Errorf("stream error = %v, want parse error", streamErr)
+		}
+	})
+
+	t.Run("slow first token", func(t *testing.T) {
+		srv := moonshottest.NewServer()
+		defer srv.Close()
+
+		srv.InjectFault(moonshottest.SlowFirstToken(50 * time.Millisecond))
+		start := time.Now()
+		stream, err := srv.SDK().Chat.CreateCompletionStream(ctx, chatRequest("Hi"))
+		if err != nil {
+			t.Fatalf("CreateCompletionStream() error = %v", err)
+		}
+		defer stream.Close()
+		headers := time.Since(start)
+
+		for range stream.Deltas() {
+			break
+		}
+		if first := time.Since(start); first < 50*time.Millisecond || headers >= 50*time.Millisecond {
+			t.Errorf("headers after %v, first token after %v", headers, first)
+		}
+	})
+}
+
+func TestServer_Files(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	sdk := srv.SDK()
+	ctx := context.Background()
+
+	file, err := sdk.Files.Upload(ctx, strings.NewReader("hello world"), "hello.txt", "file-extract")
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if file.ID == "" || file.Bytes != 11 || file.Filename != "hello.txt" {
+		t.Errorf("Upload() = %+v", file)
+	}
+
+	list, err := sdk.Files.List(ctx, &types.FileListParams{Purpose: "file-extract"})
+	if err != nil || len(list.Data) != 1 {
+		t.Fatalf("List() = %+v, %v", list, err)
+	}
+
+	content, err := sdk.Files.GetContent(ctx, file.ID)
+	if err != nil || !strings.Contains(string(content), "hello world") {
+		t.Errorf("GetContent() = %s, %v", content, err)
+	}
+
+	if err := sdk.Files.Delete(ctx, file.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := sdk.Files.Get(ctx, file.ID); err == nil {
+		t.Error("Get() after delete error = nil, want not found")
+	}
+}
+
+func TestServer_TokensAndBalance(t *testing.T) {
+	srv := moonshottest.NewServer()
+	defer srv.Close()
+	sdk := srv.SDK()
+	ctx := context.Background()
+
+	count, err := sdk.Chat.CountTokens(ctx, types.TokenCountRequest{
+		Model:    "kimi-k2-0711-preview",
+		Messages: []types.Message{{Role: "user", Content: "12345678"}},
+	})
+	if err != nil || count.TokenCount != 6 {
+		t.Errorf("CountTokens() = %+v, %v, want 6 tokens", count, err)
+	}
+
+	srv.SetBalance(types.Balance{AvailableBalance: 12.5})
+	balance, err := sdk.Balance.Get(ctx)
+	if err != nil || balance.AvailableBalance != 12.5 {
+		t.Errorf("Balance.Get() = %+v, %v", balance, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Package balance provides access to the Moonshot account balance.
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+const (
+	balanceEndpoint = "/users/me/balance"
+)
+
+// Service handles account balance queries
+type Service struct {
+	client *client.Client
+}
+
+// NewService creates a new balance service
+func NewService(c *client.Client) *Service {
+	return &Service{
+		client: c,
+	}
+}
+
+// Get retrieves the account balance
+func (s *Service) Get(ctx context.Context, opts ...client.RequestOption) (*types.Balance, error) {
+	resp, err := s.client.Request(ctx, http.MethodGet, balanceEndpoint, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.HandleErrorResponse(resp)
+	}
+
+	var balanceResp types.BalanceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&balanceResp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return &balanceResp.Data, nil
+}
@@ -0,0 +1,66 @@
+package balance_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/balance"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+)
+
+func TestService_Get(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       float64
+		wantErr    bool
+	}{
+		{
+			name:       "successful get",
+			statusCode: http.StatusOK,
+			body:       `{"code":0,"data":{"available_balance":49.58,"voucher_balance":46.58,"cash_balance":3.0},"scode":"0x0","status":true}`,
+			want:       49.58,
+		},
+		{
+			name:       "unauthorized",
+			statusCode: http.StatusUnauthorized,
+			body:       `{"error":{"message":"Invalid Authentication","type":"invalid_authentication_error"}}`,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/users/me/balance" {
+					t.Errorf("got %s %s, want GET /users/me/balance", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			s := balance.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+			got, err := s.Get(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, ok := errors.IsAPIError(err); !ok {
+					t.Errorf("Get() error type = %T, want APIError", err)
+				}
+				return
+			}
+			if got.AvailableBalance != tt.want {
+				t.Errorf("AvailableBalance = %v, want %v", got.AvailableBalance, tt.want)
+			}
+			if got.VoucherBalance != 46.58 || got.CashBalance != 3.0 {
+				t.Errorf("Balance = %+v", got)
+			}
+		})
+	}
+}
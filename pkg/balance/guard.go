@@ -0,0 +1,120 @@
+package balance
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+)
+
+const defaultGuardInterval = time.Minute
+
+// Guard makes a client check the account balance before sending requests
+// and stop once it drops below a threshold.
+//
+// The check is lazy: nothing is fetched when the client is created. The
+// balance is fetched when a request is made and the last fetched value is
+// missing or older than Interval. Concurrent requests share a single fetch.
+// If the balance cannot be fetched, requests are let through and the next
+// request fetches it again.
+type Guard struct {
+	// Threshold is the lowest available balance at which requests are sent
+	Threshold float64
+	// Interval is how long a fetched balance is trusted (default 1m)
+	Interval time.Duration
+	// OnLow is called when the balance is below Threshold. If it returns
+	// nil the request proceeds; otherwise its error is returned. When OnLow
+	// is nil, requests fail with errors.BalanceError.
+	OnLow func(available float64) error
+}
+
+// WithGuard enables a balance guard on the client
+//
+//	c := client.New(balance.WithGuard(balance.Guard{Threshold: 5}))
+func WithGuard(guard Guard) client.Option {
+	return func(c *client.Client) {
+		g := &guardState{config: guard, service: NewService(c)}
+		client.WithRequestCheck(g.check)(c)
+	}
+}
+
+// guardState holds the state of a Guard
+type guardState struct {
+	config  Guard
+	service *Service
+
+	mu        sync.Mutex
+	checked   time.Time
+	available float64
+	// fetching is closed when the fetch in flight, if any, completes
+	fetching chan struct{}
+}
+
+// check returns an error if req should not be sent
+func (g *guardState) check(req *http.Request) error {
+	// The guard's own balance requests go through the same client
+	if strings.HasSuffix(req.URL.Path, balanceEndpoint) {
+		return nil
+	}
+
+	available, ok := g.balance(req.Context())
+	if !ok || available >= g.config.Threshold {
+		return nil
+	}
+	if g.config.OnLow != nil {
+		return g.config.OnLow(available)
+	}
+	return errors.BalanceError{Available: available, Threshold: g.config.Threshold}
+}
+
+// balance returns the available balance, fetching it if the last value is
+// older than the interval. The lock is not held while fetching; callers
+// arriving during a fetch wait for its result.
+func (g *guardState) balance(ctx context.Context) (float64, bool) {
+	interval := g.config.Interval
+	if interval <= 0 {
+		interval = defaultGuardInterval
+	}
+
+	g.mu.Lock()
+	if !g.checked.IsZero() && time.Since(g.checked) < interval {
+		available := g.available
+		g.mu.Unlock()
+		return available, true
+	}
+	if fetching := g.fetching; fetching != nil {
+		g.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return 0, false
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		// The fetch failed if it did not refresh the balance
+		if g.checked.IsZero() || time.Since(g.checked) >= interval {
+			return 0, false
+		}
+		return g.available, true
+	}
+	fetching := make(chan struct{})
+	g.fetching = fetching
+	g.mu.Unlock()
+
+	b, err := g.service.Get(ctx)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fetching = nil
+	close(fetching)
+	if err != nil {
+		return 0, false
+	}
+	g.checked = time.Now()
+	g.available = b.AvailableBalance
+	return g.available, true
+}
@@ -0,0 +1,159 @@
+package balance_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/balance"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+)
+
+// guardServer serves the balance endpoint and counts the calls to it and to
+// every other path. The balance endpoint fails while failing is set.
+type guardServer struct {
+	*httptest.Server
+	available    float64
+	delay        time.Duration
+	failing      atomic.Bool
+	balanceCalls atomic.Int32
+	apiCalls     atomic.Int32
+}
+
+func newGuardServer(available float64) *guardServer {
+	s := &guardServer{available: available}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/me/balance" {
+			s.apiCalls.Add(1)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		s.balanceCalls.Add(1)
+		time.Sleep(s.delay)
+		if s.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"code":   0,
+			"data":   map[string]float64{"available_balance": s.available},
+			"status": true,
+		})
+	}))
+	return s
+}
+
+func (s *guardServer) request(t *testing.T, c *client.Client) error {
+	t.Helper()
+	resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestWithGuard(t *testing.T) {
+	t.Run("fails fast below threshold", func(t *testing.T) {
+		server := newGuardServer(0.5)
+		defer server.Close()
+
+		c := client.New("test-key", client.WithBaseURL(server.URL), balance.WithGuard(balance.Guard{Threshold: 1}))
+		err := server.request(t, c)
+
+		balanceErr, ok := errors.IsBalanceError(err)
+		if !ok {
+			t.Fatalf("Request() error = %v, want BalanceError", err)
+		}
+		if balanceErr.Available != 0.5 || balanceErr.Threshold != 1 {
+			t.Errorf("BalanceError = %+v", balanceErr)
+		}
+		if server.apiCalls.Load() != 0 {
+			t.Errorf("apiCalls = %d, want 0", server.apiCalls.Load())
+		}
+	})
+
+	t.Run("checks at most once per interval", func(t *testing.T) {
+		server := newGuardServer(100)
+		defer server.Close()
+
+		c := client.New("test-key", client.WithBaseURL(server.URL), balance.WithGuard(balance.Guard{Threshold: 1, Interval: time.Hour}))
+		for i := 0; i < 3; i++ {
+			if err := server.request(t, c); err != nil {
+				t.Fatalf("Request() error = %v", err)
+			}
+		}
+
+		if server.balanceCalls.Load() != 1 || server.apiCalls.Load() != 3 {
+			t.Errorf("balanceCalls = %d, apiCalls = %d, want 1 and 3", server.balanceCalls.Load(), server.apiCalls.Load())
+		}
+	})
+
+	t.Run("concurrent requests share a fetch", func(t *testing.T) {
+		server := newGuardServer(100)
+		server.delay = 50 * time.Millisecond
+		defer server.Close()
+
+		c := client.New("test-key", client.WithBaseURL(server.URL), balance.WithGuard(balance.Guard{Threshold: 1, Interval: time.Hour}))
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := server.request(t, c); err != nil {
+					t.Errorf("Request() error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if server.balanceCalls.Load() != 1 || server.apiCalls.Load() != 5 {
+			t.Errorf("balanceCalls = %d, apiCalls = %d, want 1 and 5", server.balanceCalls.Load(), server.apiCalls.Load())
+		}
+	})
+
+	t.Run("failed fetch is not cached", func(t *testing.T) {
+		server := newGuardServer(0.5)
+		server.failing.Store(true)
+		defer server.Close()
+
+		c := client.New("test-key", client.WithBaseURL(server.URL), balance.WithGuard(balance.Guard{Threshold: 1, Interval: time.Hour}))
+		if err := server.request(t, c); err != nil {
+			t.Fatalf("Request() error = %v, want request let through", err)
+		}
+
+		server.failing.Store(false)
+		if _, ok := errors.IsBalanceError(server.request(t, c)); !ok {
+			t.Error("Request() after recovery: want BalanceError")
+		}
+		if server.balanceCalls.Load() != 2 {
+			t.Errorf("balanceCalls = %d, want 2", server.balanceCalls.Load())
+		}
+	})
+
+	t.Run("callback decides", func(t *testing.T) {
+		server := newGuardServer(0.5)
+		defer server.Close()
+
+		var notified float64
+		c := client.New("test-key", client.WithBaseURL(server.URL), balance.WithGuard(balance.Guard{
+			Threshold: 1,
+			OnLow: func(available float64) error {
+				notified = available
+				return nil
+			},
+		}))
+		if err := server.request(t, c); err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+
+		if notified != 0.5 || server.apiCalls.Load() != 1 {
+			t.Errorf("notified = %v, apiCalls = %d, want 0.5 and 1", notified, server.apiCalls.Load())
+		}
+	})
+}
@@ -0,0 +1,412 @@
+// Package batch executes chat completion requests read from JSONL files.
+//
+// Each input line holds one request with a caller-chosen ID:
+//
+//	{"custom_id": "q-1", "body": {"model": "kimi-k2", "messages": [...]}}
+//
+// Lines may also carry the request fields at the top level next to
+// custom_id. IDs must be unique within a file. Results are written as JSONL,
+// one line per request, keyed by the same ID, so an interrupted run can be
+// resumed from its output file.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+const defaultConcurrency = 4
+
+// Request is one line of a batch input file
+type Request struct {
+	CustomID string                      `json:"custom_id"`
+	Body     types.ChatCompletionRequest `json:"body"`
+}
+
+// Result is one line of a batch output file
+type Result struct {
+	CustomID  string                        `json:"custom_id"`
+	Model     string                        `json:"model,omitempty"`
+	Response  *types.ChatCompletionResponse `json:"response,omitempty"`
+	Error     *ResultError                  `json:"error,omitempty"`
+	LatencyMS int64                         `json:"latency_ms"`
+}
+
+// ResultError describes a failed request
+type ResultError struct {
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message"`
+	Type       string `json:"type,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// Succeeded reports whether the request produced a response
+func (r Result) Succeeded() bool {
+	return r.Error == nil && r.Response != nil
+}
+
+// Summary aggregates the results of a run
+type Summary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	// Skipped counts requests already completed in a resumed output file
+	Skipped  int
+	Usage    types.Usage
+	Cost     float64
+	Duration time.Duration
+}
+
+// Options configures a Runner
+type Options struct {
+	// Concurrency is the number of requests in flight (default 4)
+	Concurrency int
+	// Pricing returns the price of a model, for cost reporting. It defaults
+	// to the list prices of models.Model.Pricing.
+	Pricing func(model string) (models.Pricing, bool)
+	// OnResult, if set, is called after each request completes. Calls are
+	// serialised.
+	OnResult func(Result)
+	// RequestOptions are applied to every request
+	RequestOptions []client.RequestOption
+}
+
+// Runner executes batches through a chat service
+type Runner struct {
+	chat *chat.Service
+	opts Options
+}
+
+// NewRunner creates a new batch runner
+func NewRunner(s *chat.Service, opts Options) *Runner {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.Pricing == nil {
+		opts.Pricing = func(model string) (models.Pricing, bool) {
+			return models.Model(model).Pricing()
+		}
+	}
+	return &Runner{
+		chat: s,
+		opts: opts,
+	}
+}
+
+// RunFile executes the requests in inputPath and writes results to
+// outputPath. If outputPath already exists, requests with a successful
+// result in it are skipped and new results are appended, so an interrupted
+// run can be resumed; failed requests are retried.
+func (r *Runner) RunFile(ctx context.Context, inputPath, outputPath string) (*Summary, error) {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening input: %w", err)
+	}
+	defer in.Close()
+
+	done, err := CompletedIDs(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := trimPartialLine(outputPath); err != nil {
+		return nil, err
+	}
+
+	out, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening output: %w", err)
+	}
+
+	summary, err := r.Run(ctx, in, out, done)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("closing output: %w", closeErr)
+	}
+	return summary, err
+}
+
+// Run executes the requests read from in and writes a result line to out
+// for each. Requests whose IDs are in skip are not sent. The whole input is
+// read before any request is sent, so an input that cannot be read or
+// repeats an ID fails without API calls. Failed requests are recorded in
+// the output and do not stop the run; Run returns an error only when
+// reading input or writing output fails, or ctx is done.
+func (r *Runner) Run(ctx context.Context, in io.Reader, out io.Writer, skip map[string]bool) (*Summary, error) {
+	start := time.Now()
+	summary := &Summary{}
+
+	lines, err := readRequests(in)
+	if err != nil {
+		summary.Duration = time.Since(start)
+		return summary, err
+	}
+
+	var (
+		mu       sync.Mutex
+		writeErr error
+	)
+	enc := json.NewEncoder(out)
+	record := func(res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if writeErr == nil {
+			if err := enc.Encode(res); err != nil {
+				writeErr = fmt.Errorf("writing result: %w", err)
+			}
+		}
+		r.addToSummary(summary, res)
+		if r.opts.OnResult != nil {
+			r.opts.OnResult(res)
+		}
+	}
+
+	jobs := make(chan Request)
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				record(r.execute(ctx, req))
+			}
+		}()
+	}
+
+dispatch:
+	for _, line := range lines {
+		if line.err != nil {
+			record(Result{CustomID: line.req.CustomID, Error: &ResultError{Code: "invalid_line", Message: line.err.Error(), Type: "client_error"}})
+			continue
+		}
+		if skip[line.req.CustomID] {
+			mu.Lock()
+			summary.Skipped++
+			mu.Unlock()
+			continue
+		}
+		select {
+		case jobs <- line.req:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	summary.Duration = time.Since(start)
+	switch {
+	case writeErr != nil:
+		return summary, writeErr
+	default:
+		return summary, ctx.Err()
+	}
+}
+
+// execute sends a single request
+func (r *Runner) execute(ctx context.Context, req Request) Result {
+	start := time.Now()
+	resp, err := r.chat.CreateCompletion(ctx, req.Body, r.opts.RequestOptions...)
+	res := Result{
+		CustomID:  req.CustomID,
+		Model:     req.Body.Model,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		res.Error = resultError(err)
+		return res
+	}
+	res.Response = resp
+	if resp.Model != "" {
+		res.Model = resp.Model
+	}
+	return res
+}
+
+func (r *Runner) addToSummary(s *Summary, res Result) {
+	s.Total++
+	if !res.Succeeded() {
+		s.Failed++
+		return
+	}
+	s.Succeeded++
+
+	u := res.Response.Usage
+	s.Usage.PromptTokens += u.PromptTokens
+	s.Usage.CompletionTokens += u.CompletionTokens
+	s.Usage.TotalTokens += u.TotalTokens
+	s.Usage.CachedTokens += u.CachedTokens
+	if p, ok := r.opts.Pricing(res.Model); ok {
+		s.Cost += p.Cost(u.PromptTokens, u.CachedTokens, u.CompletionTokens)
+	}
+}
+
+func resultError(err error) *ResultError {
+	if apiErr, ok := errors.IsAPIError(err); ok {
+		return &ResultError{
+			Code:       apiErr.Code,
+			Message:    apiErr.Message,
+			Type:       apiErr.Type,
+			StatusCode: apiErr.StatusCode,
+			RequestID:  apiErr.RequestID,
+		}
+	}
+	return &ResultError{Message: err.Error(), Type: "client_error"}
+}
+
+// inputLine is a decoded input line, with the error if it is invalid
+type inputLine struct {
+	req Request
+	err error
+}
+
+// readRequests decodes each non-empty line of in. Lines that cannot be
+// decoded are returned with an error and an ID derived from their line
+// number. A line reusing the ID of an earlier one is an error, as its
+// result could not be told apart.
+func readRequests(in io.Reader) ([]inputLine, error) {
+	reader := bufio.NewReader(in)
+	var lines []inputLine
+	seen := make(map[string]int)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading input: %w", err)
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			req, decodeErr := decodeRequest(trimmed)
+			if req.CustomID == "" {
+				req.CustomID = fmt.Sprintf("line-%d", lineNo)
+			}
+			if first, ok := seen[req.CustomID]; ok {
+				return nil, fmt.Errorf("input line %d: duplicate custom_id %q (first on line %d)", lineNo, req.CustomID, first)
+			}
+			seen[req.CustomID] = lineNo
+			lines = append(lines, inputLine{req: req, err: decodeErr})
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+	}
+}
+
+// decodeRequest decodes an input line with the request either under "body"
+// or inline next to "custom_id"
+func decodeRequest(line []byte) (Request, error) {
+	var envelope struct {
+		CustomID string          `json:"custom_id"`
+		Body     json.RawMessage `json:"body"`
+	}
+	if err := json.Unmarshal(line, &envelope); err != nil {
+		return Request{}, fmt.Errorf("decoding line: %w", err)
+	}
+
+	req := Request{CustomID: envelope.CustomID}
+	body := envelope.Body
+	if len(body) == 0 {
+		body = line
+	}
+	if err := json.Unmarshal(body, &req.Body); err != nil {
+		return req, fmt.Errorf("decoding request: %w", err)
+	}
+	// Inline requests leave the envelope fields in ExtraBody
+	delete(req.Body.ExtraBody, "custom_id")
+	delete(req.Body.ExtraBody, "method")
+	delete(req.Body.ExtraBody, "url")
+	if len(req.Body.ExtraBody) == 0 {
+		req.Body.ExtraBody = nil
+	}
+	return req, nil
+}
+
+// ReadResults decodes all results from a batch output. When an ID appears
+// more than once, as after a resumed run retried a failure, the last result
+// wins.
+func ReadResults(in io.Reader) ([]Result, error) {
+	var results []Result
+	index := map[string]int{}
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading results: %w", err)
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var res Result
+			if decodeErr := json.Unmarshal(trimmed, &res); decodeErr != nil {
+				// A run killed mid-write leaves a truncated last line
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("decoding result: %w", decodeErr)
+			}
+			if i, ok := index[res.CustomID]; ok {
+				results[i] = res
+			} else {
+				index[res.CustomID] = len(results)
+				results = append(results, res)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return results, nil
+}
+
+// trimPartialLine removes a trailing line left incomplete by an interrupted
+// run from the file at path, so appended results start on a new line
+func trimPartialLine(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading output: %w", err)
+	}
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+	keep := bytes.LastIndexByte(data, '\n') + 1
+	if err := os.Truncate(path, int64(keep)); err != nil {
+		return fmt.Errorf("truncating output: %w", err)
+	}
+	return nil
+}
+
+// CompletedIDs returns the IDs with a successful result in the output file
+// at path. A missing file has no completed IDs.
+func CompletedIDs(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening output: %w", err)
+	}
+	defer f.Close()
+
+	results, err := ReadResults(f)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(results))
+	for _, res := range results {
+		if res.Succeeded() {
+			done[res.CustomID] = true
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,177 @@
+package batch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/batch"
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// newServer answers each completion with the user's message echoed back,
+// and fails requests whose message is "fail"
+func newServer(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req types.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		content := req.Messages[0].Content.(string)
+		if content == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(errors.ErrorResponse{Error: errors.APIError{Code: "invalid_request", Message: "bad", Type: "invalid_request_error"}})
+			return
+		}
+		json.NewEncoder(w).Encode(types.ChatCompletionResponse{
+			ID:      "chatcmpl-" + content,
+			Model:   req.Model,
+			Choices: []types.Choice{{Message: types.Message{Role: "assistant", Content: content}, FinishReason: "stop"}},
+			Usage:   types.Usage{PromptTokens: 1_000_000, CompletionTokens: 1_000_000, TotalTokens: 2_000_000},
+		})
+	}))
+}
+
+const input = `{"custom_id":"a","body":{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"one"}]}}
+{"custom_id":"b","model":"moonshot-v1-8k","messages":[{"role":"user","content":"two"}]}
+
+{"custom_id":"c","body":{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"fail"}]}}
+not json
+`
+
+func TestRunner_Run(t *testing.T) {
+	var calls atomic.Int32
+	server := newServer(t, &calls)
+	defer server.Close()
+
+	var progress int
+	runner := batch.NewRunner(chat.NewService(client.New("test-key", client.WithBaseURL(server.URL))), batch.Options{
+		Concurrency: 2,
+		OnResult:    func(batch.Result) { progress++ },
+	})
+
+	var out bytes.Buffer
+	summary, err := runner.Run(context.Background(), strings.NewReader(input), &out, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if summary.Total != 4 || summary.Succeeded != 2 || summary.Failed != 2 {
+		t.Errorf("Summary = %+v, want 4 total, 2 succeeded, 2 failed", summary)
+	}
+	if progress != 4 {
+		t.Errorf("OnResult called %d times, want 4", progress)
+	}
+	if summary.Usage.TotalTokens != 4_000_000 {
+		t.Errorf("Usage.TotalTokens = %d, want 4000000", summary.Usage.TotalTokens)
+	}
+	pricing, _ := models.MoonshotV18K.Pricing()
+	if want := 2 * (pricing.Input + pricing.Output); summary.Cost != want {
+		t.Errorf("Cost = %v, want %v", summary.Cost, want)
+	}
+
+	results, err := batch.ReadResults(&out)
+	if err != nil {
+		t.Fatalf("ReadResults() error = %v", err)
+	}
+	byID := map[string]batch.Result{}
+	for _, res := range results {
+		byID[res.CustomID] = res
+	}
+	if got := byID["b"]; !got.Succeeded() || got.Response.Choices[0].Message.Content != "two" {
+		t.Errorf("result b = %+v", got)
+	}
+	if got := byID["c"]; got.Error == nil || got.Error.StatusCode != http.StatusBadRequest || got.Error.Code != "invalid_request" {
+		t.Errorf("result c = %+v", got)
+	}
+	if got := byID["line-5"]; got.Error == nil || got.Error.Code != "invalid_line" {
+		t.Errorf("result line-5 = %+v", got)
+	}
+}
+
+func TestRunner_RunDuplicateID(t *testing.T) {
+	var calls atomic.Int32
+	server := newServer(t, &calls)
+	defer server.Close()
+
+	in := `{"custom_id":"a","model":"moonshot-v1-8k","messages":[{"role":"user","content":"one"}]}
+{"custom_id":"b","model":"moonshot-v1-8k","messages":[{"role":"user","content":"two"}]}
+{"custom_id":"a","model":"moonshot-v1-8k","messages":[{"role":"user","content":"three"}]}
+`
+	runner := batch.NewRunner(chat.NewService(client.New("test-key", client.WithBaseURL(server.URL))), batch.Options{})
+	var out bytes.Buffer
+	_, err := runner.Run(context.Background(), strings.NewReader(in), &out, nil)
+	if err == nil || !strings.Contains(err.Error(), `duplicate custom_id "a"`) {
+		t.Fatalf("Run() error = %v, want duplicate custom_id", err)
+	}
+	if calls.Load() != 0 || out.Len() != 0 {
+		t.Errorf("server calls = %d, output = %q; want nothing sent", calls.Load(), out.String())
+	}
+}
+
+func TestRunner_RunFileResume(t *testing.T) {
+	var calls atomic.Int32
+	server := newServer(t, &calls)
+	defer server.Close()
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "in.jsonl")
+	outputPath := filepath.Join(dir, "out.jsonl")
+	if err := os.WriteFile(inputPath, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A previous run completed "a", failed "c" and was killed mid-write
+	previous := `{"custom_id":"a","model":"moonshot-v1-8k","response":{"id":"chatcmpl-one","choices":[]},"latency_ms":5}
+{"custom_id":"c","error":{"message":"timeout"},"latency_ms":5}
+{"custom_id":"b","respon`
+	if err := os.WriteFile(outputPath, []byte(previous), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := batch.NewRunner(chat.NewService(client.New("test-key", client.WithBaseURL(server.URL))), batch.Options{})
+	summary, err := runner.RunFile(context.Background(), inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("RunFile() error = %v", err)
+	}
+
+	if summary.Skipped != 1 {
+		t.Errorf("Skipped = %d, want 1", summary.Skipped)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server calls = %d, want 2 (b and c)", calls.Load())
+	}
+
+	f, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	results, err := batch.ReadResults(f)
+	if err != nil {
+		t.Fatalf("ReadResults() error = %v", err)
+	}
+	if len(results) != 4 {
+		t.Errorf("len(results) = %d, want 4 unique IDs", len(results))
+	}
+
+	done, err := batch.CompletedIDs(outputPath)
+	if err != nil {
+		t.Fatalf("CompletedIDs() error = %v", err)
+	}
+	if !done["a"] || !done["b"] || done["c"] {
+		t.Errorf("CompletedIDs() = %v, want a and b", done)
+	}
+}
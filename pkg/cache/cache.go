@@ -0,0 +1,240 @@
+// Package cache provides access to the Moonshot context caching API, which
+// stores long, shared prompt prefixes so later requests are billed at the
+// cached rate.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+const (
+	cachingEndpoint = "/caching"
+
+	// defaultPollInterval is how often WaitReady polls without an interval
+	defaultPollInterval = time.Second
+
+	// RoleCache is the message role used to reference a context cache
+	RoleCache = "cache"
+
+	// Headers used to reference a context cache instead of a cache message
+	HeaderContextCache         = "X-Msh-Context-Cache"
+	HeaderContextCacheResetTTL = "X-Msh-Context-Cache-Reset-TTL"
+)
+
+// Service handles context cache operations
+type Service struct {
+	client *client.Client
+}
+
+// NewService creates a new cache service
+func NewService(c *client.Client) *Service {
+	return &Service{
+		client: c,
+	}
+}
+
+// Create creates a context cache from messages and tools
+func (s *Service) Create(ctx context.Context, req types.ContextCacheCreateRequest, opts ...client.RequestOption) (*types.ContextCache, error) {
+	resp, err := s.client.Request(ctx, http.MethodPost, cachingEndpoint, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.HandleErrorResponse(resp)
+	}
+
+	var cacheResp types.ContextCache
+	if err := json.NewDecoder(resp.Body).Decode(&cacheResp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return &cacheResp, nil
+}
+
+// List lists context caches
+func (s *Service) List(ctx context.Context, params *types.ContextCacheListParams, opts ...client.RequestOption) (*types.ContextCacheListResponse, error) {
+	endpoint := cachingEndpoint
+	if params != nil {
+		query := url.Values{}
+		if params.Limit > 0 {
+			query.Set("limit", strconv.Itoa(params.Limit))
+		}
+		if params.Order != "" {
+			query.Set("order", params.Order)
+		}
+		if params.After != "" {
+			query.Set("after", params.After)
+		}
+		if params.Before != "" {
+			query.Set("before", params.Before)
+		}
+		for key, value := range params.Metadata {
+			query.Set("metadata["+key+"]", value)
+		}
+		if len(query) > 0 {
+			endpoint += "?" + query.Encode()
+		}
+	}
+
+	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.HandleErrorResponse(resp)
+	}
+
+	var listResp types.ContextCacheListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return &listResp, nil
+}
+
+// Get retrieves a context cache by ID
+func (s *Service) Get(ctx context.Context, cacheID string, opts ...client.RequestOption) (*types.ContextCache, error) {
+	endpoint := fmt.Sprintf("%s/%s", cachingEndpoint, cacheID)
+
+	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.HandleErrorResponse(resp)
+	}
+
+	var cacheResp types.ContextCache
+	if err := json.NewDecoder(resp.Body).Decode(&cacheResp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return &cacheResp, nil
+}
+
+// Update updates the metadata or lifetime of a context cache
+func (s *Service) Update(ctx context.Context, cacheID string, req types.ContextCacheUpdateRequest, opts ...client.RequestOption) (*types.ContextCache, error) {
+	endpoint := fmt.Sprintf("%s/%s", cachingEndpoint, cacheID)
+
+	resp, err := s.client.Request(ctx, http.MethodPut, endpoint, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.HandleErrorResponse(resp)
+	}
+
+	var cacheResp types.ContextCache
+	if err := json.NewDecoder(resp.Body).Decode(&cacheResp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return &cacheResp, nil
+}
+
+// Refresh resets the TTL of a context cache, reactivating it if it has
+// become inactive
+func (s *Service) Refresh(ctx context.Context, cacheID string, ttl time.Duration, opts ...client.RequestOption) (*types.ContextCache, error) {
+	seconds := int(ttl / time.Second)
+	return s.Update(ctx, cacheID, types.ContextCacheUpdateRequest{TTL: &seconds}, opts...)
+}
+
+// Delete deletes a context cache by ID
+func (s *Service) Delete(ctx context.Context, cacheID string, opts ...client.RequestOption) error {
+	endpoint := fmt.Sprintf("%s/%s", cachingEndpoint, cacheID)
+
+	resp, err := s.client.Request(ctx, http.MethodDelete, endpoint, nil, opts...)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return errors.HandleErrorResponse(resp)
+	}
+
+	return nil
+}
+
+// WaitReady polls a context cache every interval (1s if interval is not
+// positive) until it is ready, and returns an error if it fails or ctx is
+// done first
+func (s *Service) WaitReady(ctx context.Context, cacheID string, interval time.Duration, opts ...client.RequestOption) (*types.ContextCache, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c, err := s.Get(ctx, cacheID, opts...)
+		if err != nil {
+			return nil, err
+		}
+		switch c.Status {
+		case types.ContextCacheStatusReady:
+			return c, nil
+		case types.ContextCacheStatusError:
+			reason := "unknown error"
+			if c.Error != nil {
+				reason = *c.Error
+			}
+			return c, fmt.Errorf("context cache %s failed: %s", cacheID, reason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return c, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Message returns the message that references a context cache. It replaces
+// the cached messages at the start of a conversation. A positive resetTTL
+// renews the cache's lifetime on use.
+func Message(cacheID string, resetTTL time.Duration) types.Message {
+	content := "cache_id=" + cacheID
+	if resetTTL > 0 {
+		content += ";reset_ttl=" + strconv.Itoa(int(resetTTL/time.Second))
+	}
+	return types.Message{
+		Role:    RoleCache,
+		Content: content,
+	}
+}
+
+// Reference makes req use a context cache by prepending the cache message
+// to its messages, which should then hold only the messages that follow
+// the cached prefix
+func Reference(req *types.ChatCompletionRequest, cacheID string, resetTTL time.Duration) {
+	req.Messages = append([]types.Message{Message(cacheID, resetTTL)}, req.Messages...)
+}
+
+// WithCache returns a request option that references a context cache through
+// request headers rather than a cache message
+func WithCache(cacheID string, resetTTL time.Duration) client.RequestOption {
+	opts := []client.RequestOption{client.WithHeader(HeaderContextCache, cacheID)}
+	if resetTTL > 0 {
+		opts = append(opts, client.WithHeader(HeaderContextCacheResetTTL, strconv.Itoa(int(resetTTL/time.Second))))
+	}
+	return client.CombineRequestOptions(opts...)
+}
@@ -0,0 +1,211 @@
+package cache_test
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/cache"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+func TestService_Create(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/caching" {
+			t.Errorf("got %s %s, want POST /caching", r.Method, r.URL.Path)
+		}
+
+		var req types.ContextCacheCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.Model != "moonshot-v1" || len(req.Messages) != 1 || utils.IntValue(req.TTL) != 3600 {
+			t.Errorf("request = %+v", req)
+		}
+
+		json.NewEncoder(w).Encode(types.ContextCache{
+			ID:     "cache-123",
+			Object: "context_cache_object",
+			Status: types.ContextCacheStatusPending,
+			Model:  req.Model,
+		})
+	}))
+	defer server.Close()
+
+	s := cache.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	got, err := s.Create(context.Background(), types.ContextCacheCreateRequest{
+		Model:    "moonshot-v1",
+		Messages: []types.Message{{Role: "system", Content: "A very long shared system prompt"}},
+		TTL:      utils.Int(3600),
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got.ID != "cache-123" || got.Status != types.ContextCacheStatusPending {
+		t.Errorf("Create() = %+v", got)
+	}
+}
+
+func TestService_List(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("limit") != "5" || q.Get("order") != "desc" || q.Get("metadata[team]") != "search" {
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(types.ContextCacheListResponse{
+			Object: "list",
+			Data:   []types.ContextCache{{ID: "cache-1"}, {ID: "cache-2"}},
+		})
+	}))
+	defer server.Close()
+
+	s := cache.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	got, err := s.List(context.Background(), &types.ContextCacheListParams{
+		Limit:    5,
+		Order:    "desc",
+		Metadata: map[string]string{"team": "search"},
+	})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(got.Data) != 2 {
+		t.Errorf("len(Data) = %d, want 2", len(got.Data))
+	}
+}
+
+func TestService_Refresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/caching/cache-123" {
+			t.Errorf("got %s %s, want PUT /caching/cache-123", r.Method, r.URL.Path)
+		}
+		var req types.ContextCacheUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if utils.IntValue(req.TTL) != 600 {
+			t.Errorf("TTL = %v, want 600", req.TTL)
+		}
+		json.NewEncoder(w).Encode(types.ContextCache{ID: "cache-123", Status: types.ContextCacheStatusReady})
+	}))
+	defer server.Close()
+
+	s := cache.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	got, err := s.Refresh(context.Background(), "cache-123", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got.Status != types.ContextCacheStatusReady {
+		t.Errorf("Status = %q, want ready", got.Status)
+	}
+}
+
+func TestService_Delete(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		wantErr    bool
+	}{
+		{name: "deleted", statusCode: http.StatusOK},
+		{name: "not found", statusCode: http.StatusNotFound, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete {
+					t.Errorf("expected DELETE, got %s", r.Method)
+				}
+				w.WriteHeader(tt.statusCode)
+				if tt.statusCode != http.StatusOK {
+					json.NewEncoder(w).Encode(errors.ErrorResponse{Error: errors.APIError{Message: "no such cache"}})
+				}
+			}))
+			defer server.Close()
+
+			s := cache.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+			err := s.Delete(context.Background(), "cache-123")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_WaitReady(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		status := types.ContextCacheStatusPending
+		if calls == 3 {
+			status = types.ContextCacheStatusReady
+		}
+		json.NewEncoder(w).Encode(types.ContextCache{ID: "cache-123", Status: status})
+	}))
+	defer server.Close()
+
+	s := cache.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	got, err := s.WaitReady(context.Background(), "cache-123", time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitReady() error = %v", err)
+	}
+	if got.Status != types.ContextCacheStatusReady || calls != 3 {
+		t.Errorf("Status = %q after %d calls, want ready after 3", got.Status, calls)
+	}
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		calls = 2 // the next call reports ready
+		if _, err := s.WaitReady(context.Background(), "cache-123", interval); err != nil {
+			t.Errorf("WaitReady(%v) error = %v", interval, err)
+		}
+	}
+
+	// A non-positive interval still waits between polls
+	calls = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.WaitReady(ctx, "cache-123", 0); !stderrors.Is(err, context.DeadlineExceeded) || calls != 2 {
+		t.Errorf("WaitReady(0) error = %v after %d polls, want a deadline after 1", err, calls-1)
+	}
+}
+
+func TestReference(t *testing.T) {
+	req := types.ChatCompletionRequest{
+		Model:    "moonshot-v1-128k",
+		Messages: []types.Message{{Role: "user", Content: "Question"}},
+	}
+	cache.Reference(&req, "cache-123", time.Hour)
+
+	if len(req.Messages) != 2 {
+		t.Fatalf("len(Messages) = %d, want 2", len(req.Messages))
+	}
+	if req.Messages[0].Role != cache.RoleCache || req.Messages[0].Content != "cache_id=cache-123;reset_ttl=3600" {
+		t.Errorf("Messages[0] = %+v", req.Messages[0])
+	}
+}
+
+func TestWithCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(cache.HeaderContextCache) != "cache-123" {
+			t.Errorf("%s = %q", cache.HeaderContextCache, r.Header.Get(cache.HeaderContextCache))
+		}
+		if r.Header.Get(cache.HeaderContextCacheResetTTL) != "60" {
+			t.Errorf("%s = %q", cache.HeaderContextCacheResetTTL, r.Header.Get(cache.HeaderContextCacheResetTTL))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := client.New("test-key", client.WithBaseURL(server.URL))
+	resp, err := c.Request(context.Background(), http.MethodPost, "/chat/completions", map[string]string{}, cache.WithCache("cache-123", time.Minute))
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	resp.Body.Close()
+}
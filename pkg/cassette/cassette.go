@@ -0,0 +1,119 @@
+// Package cassette records HTTP interactions with the Moonshot API to a file
+// and replays them, so integration tests can run offline and
+// deterministically.
+//
+// A Recorder is an http.RoundTripper; plug it into the SDK with
+// client.WithHTTPClient(rec.Client()).
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatVersion is the version of the cassette file format
+const formatVersion = 1
+
+// Redacted replaces the value of scrubbed headers
+const Redacted = "[REDACTED]"
+
+// Cassette is a set of recorded interactions
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and the response it received
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request
+type Request struct {
+	Method string `json:"method"`
+	// URL is the request path and query, relative to the host
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response. Streamed (server-sent events)
+// responses are stored as Chunks instead of Body.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Chunks     []Chunk     `json:"chunks,omitempty"`
+	// Incomplete marks a stream that ended or was closed before its
+	// "data: [DONE]" event. It is replayed with the same chunks, after which
+	// reading fails with io.ErrUnexpectedEOF.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Chunk is one server-sent event of a streamed response
+type Chunk struct {
+	Data string `json:"data"`
+	// DelayMS is the time since the previous chunk, or since the request
+	// was sent for the first chunk, in milliseconds
+	DelayMS int64 `json:"delay_ms"`
+}
+
+// Load reads a cassette file
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("decoding cassette %s: %w", path, err)
+	}
+	if c.Version > formatVersion {
+		return nil, fmt.Errorf("cassette %s has unsupported version %d", path, c.Version)
+	}
+	return &c, nil
+}
+
+// Save writes c to path, creating parent directories as needed
+func (c *Cassette) Save(path string) error {
+	c.Version = formatVersion
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("writing cassette: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing cassette: %w", err)
+	}
+	return nil
+}
+
+// NormalizeBody returns body in a form that is stable across runs of the
+// same request: JSON is re-encoded with sorted keys and no insignificant
+// whitespace, and the random boundary of multipart bodies is replaced.
+func NormalizeBody(contentType string, body []byte) string {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		return string(bytes.ReplaceAll(body, []byte(params["boundary"]), []byte("BOUNDARY")))
+	}
+
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		if canonical, err := json.Marshal(v); err == nil {
+			return string(canonical)
+		}
+	}
+	return string(body)
+}
@@ -0,0 +1,242 @@
+package cassette_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/cassette"
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func newAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req types.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Stream != nil && *req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, word := range []string{"Hello", " there"} {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.ChatCompletionResponse{
+			Choices: []types.Choice{{Message: types.Message{Role: "assistant", Content: "Reply to " + req.Messages[0].Content.(string)}}},
+		})
+	}))
+}
+
+func runScenario(t *testing.T, service *chat.Service) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, prompt := range []string{"one", "two"} {
+		resp, err := service.CreateCompletion(ctx, types.ChatCompletionRequest{
+			Model:    "kimi-k2-0711-preview",
+			Messages: []types.Message{{Role: "user", Content: prompt}},
+		})
+		if err != nil {
+			t.Fatalf("CreateCompletion(%s) error = %v", prompt, err)
+		}
+		if got := resp.Choices[0].Message.Content; got != "Reply to "+prompt {
+			t.Errorf("CreateCompletion(%s) content = %q", prompt, got)
+		}
+	}
+
+	stream, err := service.CreateCompletionStream(ctx, types.ChatCompletionRequest{
+		Model:    "kimi-k2-0711-preview",
+		Messages: []types.Message{{Role: "user", Content: "stream"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+	acc := stream.Accumulated()
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+	}
+	if got := acc.Content(); got != "Hello there" {
+		t.Errorf("stream content = %q, want %q", got, "Hello there")
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "chat.json")
+	server := newAPIServer(t)
+
+	// Record against the server
+	rec, err := cassette.New(path, cassette.ModeAuto)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if rec.Mode() != cassette.ModeRecord {
+		t.Fatalf("Mode() = %v, want ModeRecord", rec.Mode())
+	}
+	c := client.New("sk-secret", client.WithHTTPClient(rec.Client()), client.WithBaseURL(server.URL))
+	runScenario(t, chat.NewService(c))
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-secret") {
+		t.Error("cassette contains the API key")
+	}
+
+	loaded, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Interactions) != 3 {
+		t.Fatalf("len(Interactions) = %d, want 3", len(loaded.Interactions))
+	}
+	streamed := loaded.Interactions[2].Response
+	if len(streamed.Chunks) != 3 || streamed.Chunks[1].DelayMS < 15 {
+		t.Errorf("streamed chunks = %+v, want 3 with recorded delays", streamed.Chunks)
+	}
+	if streamed.Incomplete {
+		t.Error("streamed response marked incomplete")
+	}
+
+	// Replay with the server gone
+	rec, err = cassette.New(path, cassette.ModeAuto, cassette.WithReplayTiming())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if rec.Mode() != cassette.ModeReplay {
+		t.Fatalf("Mode() = %v, want ModeReplay", rec.Mode())
+	}
+	c = client.New("sk-other", client.WithHTTPClient(rec.Client()), client.WithBaseURL(server.URL))
+
+	start := time.Now()
+	runScenario(t, chat.NewService(c))
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("replay took %v, want recorded stream timing", elapsed)
+	}
+
+	// Every interaction has been used
+	_, err = chat.NewService(c).CreateCompletion(context.Background(), types.ChatCompletionRequest{
+		Model:    "kimi-k2-0711-preview",
+		Messages: []types.Message{{Role: "user", Content: "one"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no unused interaction") {
+		t.Errorf("CreateCompletion() error = %v, want no matching interaction", err)
+	}
+}
+
+func TestRecordReplay_IncompleteStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cut.json")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[]}\n\n")
+	}))
+	defer server.Close()
+
+	get := func(rec *cassette.Recorder) ([]byte, error) {
+		resp, err := rec.Client().Get(server.URL + "/stream")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+
+	rec, err := cassette.New(path, cassette.ModeRecord)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := get(rec); err != nil {
+		t.Fatalf("recording: read error = %v", err)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	loaded, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !loaded.Interactions[0].Response.Incomplete {
+		t.Error("stream without [DONE] not marked incomplete")
+	}
+
+	rec, err = cassette.New(path, cassette.ModeReplay)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	data, err := get(rec)
+	if err != io.ErrUnexpectedEOF || string(data) != "data: {\"choices\":[]}\n\n" {
+		t.Errorf("replay = %q, %v; want the recorded chunk, then io.ErrUnexpectedEOF", data, err)
+	}
+}
+
+func TestNormalizeBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		a, b        string
+		same        bool
+	}{
+		{
+			name:        "json key order and whitespace",
+			contentType: "application/json",
+			a:           `{"model": "kimi", "n": 1}`,
+			b:           `{"n":1,"model":"kimi"}`,
+			same:        true,
+		},
+		{
+			name:        "json values differ",
+			contentType: "application/json",
+			a:           `{"n":1}`,
+			b:           `{"n":2}`,
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			a:           "hello",
+			b:           "hello",
+			same:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := cassette.NormalizeBody(tt.contentType, []byte(tt.a))
+			b := cassette.NormalizeBody(tt.contentType, []byte(tt.b))
+			if (a == b) != tt.same {
+				t.Errorf("NormalizeBody() = %q and %q, same = %v, want %v", a, b, a == b, tt.same)
+			}
+		})
+	}
+
+	t.Run("multipart boundary", func(t *testing.T) {
+		body := "--abc123\r\nContent-Disposition: form-data; name=\"purpose\"\r\n\r\nfile-extract\r\n--abc123--\r\n"
+		got := cassette.NormalizeBody("multipart/form-data; boundary=abc123", []byte(body))
+		if strings.Contains(got, "abc123") || !strings.Contains(got, "--BOUNDARY") {
+			t.Errorf("NormalizeBody() = %q", got)
+		}
+	})
+}
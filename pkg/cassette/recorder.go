@@ -0,0 +1,368 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects whether a Recorder records or replays
+type Mode int
+
+const (
+	// ModeReplay serves requests from the cassette and fails requests
+	// that were not recorded
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the API and records them, replacing
+	// the cassette when the Recorder is stopped
+	ModeRecord
+	// ModeAuto replays if the cassette file exists and records otherwise
+	ModeAuto
+)
+
+// Recorder is an http.RoundTripper that records or replays interactions
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	scrub     []string
+	timing    bool
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// Option is a function that configures a Recorder
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to reach the API when recording.
+// The default is http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// WithScrubHeaders redacts further request and response headers in the
+// cassette. Authorization is always redacted.
+func WithScrubHeaders(names ...string) Option {
+	return func(r *Recorder) {
+		r.scrub = append(r.scrub, names...)
+	}
+}
+
+// WithReplayTiming makes replayed streams wait between chunks as long as
+// the recorded stream did. By default chunks are replayed without delay.
+func WithReplayTiming() Option {
+	return func(r *Recorder) {
+		r.timing = true
+	}
+}
+
+// New creates a Recorder for the cassette at path. In replay mode the
+// cassette is loaded immediately.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		scrub:     []string{"Authorization"},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+
+	if r.mode == ModeReplay {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+		r.used = make([]bool, len(c.Interactions))
+	} else {
+		r.cassette = &Cassette{}
+	}
+	return r, nil
+}
+
+// Mode returns the mode the Recorder runs in. ModeAuto is resolved to
+// ModeRecord or ModeReplay.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an HTTP client using the Recorder as its transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Stop saves the cassette when recording. Streams still being read are not
+// included.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.path)
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := Request{
+		Method: req.Method,
+		URL:    req.URL.RequestURI(),
+		Header: r.scrubHeader(req.Header),
+		Body:   NormalizeBody(req.Header.Get("Content-Type"), body),
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+	return r.record(req, recorded)
+}
+
+// record sends req and records the exchange once the response body has been
+// read
+func (r *Recorder) record(req *http.Request, recorded Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.scrubHeader(resp.Header),
+		},
+	}
+
+	if isEventStream(resp) {
+		resp.Body = &recordingBody{
+			ReadCloser: resp.Body,
+			last:       start,
+			done: func(chunks []Chunk, complete bool) {
+				interaction.Response.Chunks = chunks
+				interaction.Response.Incomplete = !complete
+				r.add(interaction)
+			},
+		}
+		return resp, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("recording response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	interaction.Response.Body = string(data)
+	r.add(interaction)
+	return resp, nil
+}
+
+func (r *Recorder) add(interaction Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+}
+
+// replay returns the first unused recorded interaction matching req
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	index := -1
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] && matches(interaction.Request, recorded) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("cassette %s: no unused interaction matches %s %s", r.path, req.Method, recorded.URL)
+	}
+	r.used[index] = true
+	interaction := r.cassette.Interactions[index]
+	r.mu.Unlock()
+
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.Response.Header.Clone(),
+		Request:       req,
+		ContentLength: -1,
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	if interaction.Response.Chunks != nil {
+		resp.Body = &replayBody{
+			ctx:        req.Context(),
+			chunks:     interaction.Response.Chunks,
+			timing:     r.timing,
+			incomplete: interaction.Response.Incomplete,
+		}
+	} else {
+		resp.Body = io.NopCloser(strings.NewReader(interaction.Response.Body))
+		resp.ContentLength = int64(len(interaction.Response.Body))
+	}
+	return resp, nil
+}
+
+// matches reports whether a recorded request matches req by method, URL and
+// normalized body
+func matches(recorded, req Request) bool {
+	if recorded.Method != req.Method || recorded.URL != req.URL {
+		return false
+	}
+	return NormalizeBody(recorded.Header.Get("Content-Type"), []byte(recorded.Body)) == req.Body
+}
+
+// scrubHeader returns a copy of h with the scrubbed headers redacted
+func (r *Recorder) scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.scrub {
+		if h.Get(name) != "" {
+			h.Set(name, Redacted)
+		}
+	}
+	return h
+}
+
+// readRequestBody reads the body of req and restores it for sending
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
+
+// recordingBody splits a streamed body into events as it is read, noting
+// when each event completed and whether the end-of-stream event was seen
+type recordingBody struct {
+	io.ReadCloser
+	last     time.Time
+	pending  []byte
+	chunks   []Chunk
+	complete bool
+	done     func(chunks []Chunk, complete bool)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.pending = append(b.pending, p[:n]...)
+	for {
+		i := bytes.Index(b.pending, []byte("\n\n"))
+		if i < 0 {
+			break
+		}
+		b.emit(b.pending[:i+2])
+		b.pending = b.pending[i+2:]
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) emit(data []byte) {
+	now := time.Now()
+	b.chunks = append(b.chunks, Chunk{Data: string(data), DelayMS: now.Sub(b.last).Milliseconds()})
+	b.last = now
+	if string(bytes.TrimSpace(data)) == "data: [DONE]" {
+		b.complete = true
+	}
+}
+
+// finish records the stream once, at EOF or when the body is closed
+func (b *recordingBody) finish() {
+	if b.done == nil {
+		return
+	}
+	if len(b.pending) > 0 {
+		b.emit(b.pending)
+		b.pending = nil
+	}
+	chunks := b.chunks
+	if chunks == nil {
+		chunks = []Chunk{}
+	}
+	b.done(chunks, b.complete)
+	b.done = nil
+}
+
+// replayBody yields recorded chunks, optionally with their recorded delays.
+// An incomplete stream ends with io.ErrUnexpectedEOF instead of io.EOF.
+type replayBody struct {
+	ctx        context.Context
+	chunks     []Chunk
+	timing     bool
+	incomplete bool
+	buf        []byte
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if len(b.chunks) == 0 {
+			if b.incomplete {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if b.timing && chunk.DelayMS > 0 {
+			select {
+			case <-time.After(time.Duration(chunk.DelayMS) * time.Millisecond):
+			case <-b.ctx.Done():
+				return 0, b.ctx.Err()
+			}
+		}
+		b.buf = []byte(chunk.Data)
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
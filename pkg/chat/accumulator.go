@@ -0,0 +1,240 @@
+package chat
+
+import (
+	"io"
+	"iter"
+	"sort"
+	"strings"
+
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+// Accumulator assembles streamed chunks into a complete response. Answer
+// text and reasoning content are collected separately. The zero value is
+// ready to use.
+type Accumulator struct {
+	id                string
+	object            string
+	created           int64
+	model             string
+	systemFingerprint string
+	usage             *types.Usage
+	choices           map[int]*accumulatedChoice
+}
+
+type accumulatedChoice struct {
+	role         string
+	content      strings.Builder
+	reasoning    strings.Builder
+	hasReasoning bool
+	toolCalls    []types.ToolCall
+	finishReason string
+}
+
+// Add merges chunk into the accumulated response
+func (a *Accumulator) Add(chunk *types.ChatCompletionStream) {
+	if chunk == nil {
+		return
+	}
+	if chunk.ID != "" {
+		a.id = chunk.ID
+	}
+	if chunk.Object != "" {
+		a.object = chunk.Object
+	}
+	if chunk.Created != 0 {
+		a.created = chunk.Created
+	}
+	if chunk.Model != "" {
+		a.model = chunk.Model
+	}
+	if chunk.SystemFingerprint != "" {
+		a.systemFingerprint = chunk.SystemFingerprint
+	}
+	if chunk.Usage != nil {
+		a.usage = chunk.Usage
+	}
+
+	for _, c := range chunk.Choices {
+		choice := a.choice(c.Index)
+		delta := c.Delta
+		if delta.Role != nil {
+			choice.role = *delta.Role
+		}
+		if delta.Content != nil {
+			choice.content.WriteString(*delta.Content)
+		}
+		if delta.ReasoningContent != nil {
+			choice.reasoning.WriteString(*delta.ReasoningContent)
+			choice.hasReasoning = true
+		}
+		for _, tc := range delta.ToolCalls {
+			choice.addToolCall(tc)
+		}
+		if c.FinishReason != nil {
+			choice.finishReason = *c.FinishReason
+		}
+		if c.Usage != nil {
+			a.usage = c.Usage
+		}
+	}
+}
+
+func (a *Accumulator) choice(index int) *accumulatedChoice {
+	if a.choices == nil {
+		a.choices = make(map[int]*accumulatedChoice)
+	}
+	c, ok := a.choices[index]
+	if !ok {
+		c = &accumulatedChoice{}
+		a.choices[index] = c
+	}
+	return c
+}
+
+// addToolCall merges a streamed tool call fragment. The first fragment of a
+// call carries its ID and name; later fragments append to the arguments.
+func (c *accumulatedChoice) addToolCall(tc types.ToolCall) {
+	for i := range c.toolCalls {
+		existing := &c.toolCalls[i]
+		sameIndex := tc.Index != nil && existing.Index != nil && *tc.Index == *existing.Index
+		sameID := tc.Index == nil && tc.ID != "" && tc.ID == existing.ID
+		if !sameIndex && !sameID {
+			continue
+		}
+		if tc.ID != "" {
+			existing.ID = tc.ID
+		}
+		if tc.Type != "" {
+			existing.Type = tc.Type
+		}
+		if tc.Function.Name != "" {
+			existing.Function.Name = tc.Function.Name
+		}
+		existing.Function.Arguments += tc.Function.Arguments
+		return
+	}
+
+	if tc.Index == nil && tc.ID == "" && len(c.toolCalls) > 0 {
+		last := &c.toolCalls[len(c.toolCalls)-1]
+		last.Function.Arguments += tc.Function.Arguments
+		return
+	}
+	c.toolCalls = append(c.toolCalls, tc)
+}
+
+// Content returns the answer text of the first choice
+func (a *Accumulator) Content() string {
+	if c, ok := a.choices[0]; ok {
+		return c.content.String()
+	}
+	return ""
+}
+
+// ReasoningContent returns the reasoning text of the first choice
+func (a *Accumulator) ReasoningContent() string {
+	if c, ok := a.choices[0]; ok {
+		return c.reasoning.String()
+	}
+	return ""
+}
+
+// Usage returns the token usage reported by the stream, or nil if none was sent
+func (a *Accumulator) Usage() *types.Usage {
+	return a.usage
+}
+
+// Response returns the accumulated chunks as a non-streaming response
+func (a *Accumulator) Response() *types.ChatCompletionResponse {
+	resp := &types.ChatCompletionResponse{
+		ID:                a.id,
+		Object:            "chat.completion",
+		Created:           a.created,
+		Model:             a.model,
+		SystemFingerprint: a.systemFingerprint,
+	}
+	if a.usage != nil {
+		resp.Usage = *a.usage
+	}
+
+	indexes := make([]int, 0, len(a.choices))
+	for index := range a.choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		c := a.choices[index]
+		role := c.role
+		if role == "" {
+			role = "assistant"
+		}
+		msg := types.Message{
+			Role:      role,
+			Content:   c.content.String(),
+			ToolCalls: c.toolCalls,
+		}
+		if c.hasReasoning {
+			reasoning := c.reasoning.String()
+			msg.ReasoningContent = &reasoning
+		}
+		resp.Choices = append(resp.Choices, types.Choice{
+			Index:        index,
+			Message:      msg,
+			FinishReason: c.finishReason,
+		})
+	}
+	return resp
+}
+
+// Delta is the text carried by a single stream chunk for the first choice
+type Delta struct {
+	// Content is the answer text
+	Content string
+	// ReasoningContent is the chain of thought of thinking models
+	ReasoningContent string
+}
+
+// All returns an iterator over the remaining chunks of the stream. Iteration
+// stops at the end of the stream or after yielding an error.
+func (sr *StreamReader) All() iter.Seq2[*types.ChatCompletionStream, error] {
+	return func(yield func(*types.ChatCompletionStream, error) bool) {
+		for {
+			chunk, err := sr.Read()
+			if err == io.EOF {
+				return
+			}
+			if !yield(chunk, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Deltas returns an iterator over the text of the first choice, with answer
+// and reasoning text kept apart. Chunks without text are skipped.
+func (sr *StreamReader) Deltas() iter.Seq2[Delta, error] {
+	return func(yield func(Delta, error) bool) {
+		for chunk, err := range sr.All() {
+			if err != nil {
+				yield(Delta{}, err)
+				return
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			d := chunk.Choices[0].Delta
+			delta := Delta{
+				Content:          utils.StringValue(d.Content),
+				ReasoningContent: utils.StringValue(d.ReasoningContent),
+			}
+			if delta.Content == "" && delta.ReasoningContent == "" {
+				continue
+			}
+			if !yield(delta, nil) {
+				return
+			}
+		}
+	}
+}
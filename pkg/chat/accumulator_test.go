@@ -0,0 +1,184 @@
+package chat_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+// thinkingChunks is a stream from a thinking model that reasons, answers and
+// then calls a tool, with usage reported on the final choice
+var thinkingChunks = []string{
+	`{"id":"1","object":"chat.completion.chunk","created":1,"model":"kimi-k2-thinking","choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"Let me "},"finish_reason":null}]}`,
+	`{"id":"1","object":"chat.completion.chunk","created":1,"model":"kimi-k2-thinking","choices":[{"index":0,"delta":{"reasoning_content":"think."},"finish_reason":null}]}`,
+	`{"id":"1","object":"chat.completion.chunk","created":1,"model":"kimi-k2-thinking","choices":[{"index":0,"delta":{"content":"Checking"},"finish_reason":null}]}`,
+	`{"id":"1","object":"chat.completion.chunk","created":1,"model":"kimi-k2-thinking","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}`,
+	`{"id":"1","object":"chat.completion.chunk","created":1,"model":"kimi-k2-thinking","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]},"finish_reason":null}]}`,
+	`{"id":"1","object":"chat.completion.chunk","created":1,"model":"kimi-k2-thinking","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":null}]}`,
+	`{"id":"1","object":"chat.completion.chunk","created":1,"model":"kimi-k2-thinking","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls","usage":{"prompt_tokens":10,"completion_tokens":20,"total_tokens":30,"completion_tokens_details":{"reasoning_tokens":12}}}]}`,
+}
+
+func newThinkingServer(t *testing.T, check func(req types.ChatCompletionRequest)) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req types.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if check != nil {
+			check(req)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range thinkingChunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func TestStreamReader_Accumulated(t *testing.T) {
+	server := newThinkingServer(t, nil)
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	stream, err := s.CreateCompletionStream(context.Background(), types.ChatCompletionRequest{
+		Model:    "kimi-k2-thinking",
+		Messages: []types.Message{{Role: "user", Content: "Weather in Paris?"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+
+	acc := stream.Accumulated()
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("All() error = %v", err)
+		}
+	}
+
+	if acc.ReasoningContent() != "Let me think." {
+		t.Errorf("ReasoningContent() = %q, want %q", acc.ReasoningContent(), "Let me think.")
+	}
+	if acc.Content() != "Checking" {
+		t.Errorf("Content() = %q, want %q", acc.Content(), "Checking")
+	}
+
+	resp := acc.Response()
+	if len(resp.Choices) != 1 {
+		t.Fatalf("len(Choices) = %d, want 1", len(resp.Choices))
+	}
+	msg := resp.Choices[0].Message
+	if utils.StringValue(msg.ReasoningContent) != "Let me think." {
+		t.Errorf("Message.ReasoningContent = %v", msg.ReasoningContent)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.Choices[0].FinishReason)
+	}
+	if len(msg.ToolCalls) != 1 {
+		t.Fatalf("len(ToolCalls) = %d, want 1", len(msg.ToolCalls))
+	}
+	if msg.ToolCalls[0].ID != "call_1" || msg.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("ToolCalls[0] = %+v", msg.ToolCalls[0])
+	}
+	if resp.Usage.TotalTokens != 30 || resp.Usage.ReasoningTokens() != 12 {
+		t.Errorf("Usage = %+v, want 30 total and 12 reasoning tokens", resp.Usage)
+	}
+}
+
+func TestStreamReader_AccumulationIsOptIn(t *testing.T) {
+	server := newThinkingServer(t, nil)
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	stream, err := s.CreateCompletionStream(context.Background(), types.ChatCompletionRequest{
+		Model:    "kimi-k2-thinking",
+		Messages: []types.Message{{Role: "user", Content: "Weather in Paris?"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("All() error = %v", err)
+		}
+	}
+	if got := stream.Accumulated().Content(); got != "" {
+		t.Errorf("Content() = %q, want nothing accumulated without opting in", got)
+	}
+}
+
+func TestStreamReader_Deltas(t *testing.T) {
+	server := newThinkingServer(t, nil)
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	stream, err := s.CreateCompletionStream(context.Background(), types.ChatCompletionRequest{
+		Model:    "kimi-k2-thinking",
+		Messages: []types.Message{{Role: "user", Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() error = %v", err)
+	}
+	defer stream.Close()
+
+	var reasoning, content string
+	for delta, err := range stream.Deltas() {
+		if err != nil {
+			t.Fatalf("Deltas() error = %v", err)
+		}
+		reasoning += delta.ReasoningContent
+		content += delta.Content
+	}
+
+	if reasoning != "Let me think." {
+		t.Errorf("reasoning = %q, want %q", reasoning, "Let me think.")
+	}
+	if content != "Checking" {
+		t.Errorf("content = %q, want %q", content, "Checking")
+	}
+}
+
+func TestService_StripsReasoningFromHistory(t *testing.T) {
+	server := newThinkingServer(t, func(req types.ChatCompletionRequest) {
+		if req.Messages[1].ReasoningContent != nil {
+			t.Error("reasoning of completed assistant turn was sent")
+		}
+		if req.Messages[3].ReasoningContent == nil {
+			t.Error("reasoning of current tool-call turn was stripped")
+		}
+	})
+	defer server.Close()
+
+	history := []types.Message{
+		{Role: "user", Content: "First question"},
+		{Role: "assistant", Content: "First answer", ReasoningContent: utils.String("old thoughts")},
+		{Role: "user", Content: "Weather in Paris?"},
+		{Role: "assistant", ReasoningContent: utils.String("need a tool"), ToolCalls: []types.ToolCall{{ID: "call_1", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: "{}"}}}},
+		{Role: "tool", Content: "sunny", ToolCallID: utils.String("call_1")},
+	}
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	stream, err := s.CreateCompletionStream(context.Background(), types.ChatCompletionRequest{
+		Model:    "kimi-k2-thinking",
+		Messages: history,
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() error = %v", err)
+	}
+	stream.Close()
+
+	if history[1].ReasoningContent == nil {
+		t.Error("caller's history was modified")
+	}
+}
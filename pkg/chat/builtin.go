@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+// maxBuiltinRounds bounds the number of builtin tool round trips made by
+// CreateCompletionWithBuiltins
+const maxBuiltinRounds = 8
+
+// BuiltinResult is the outcome of a completion whose builtin tool calls have
+// been resolved
+type BuiltinResult struct {
+	// Response is the last response from the API. Its finish reason is
+	// "tool_calls" when the model also called client-side functions.
+	Response *types.ChatCompletionResponse
+	// Messages are the assistant and tool messages exchanged during the
+	// builtin round trips, in order, excluding the final response
+	Messages []types.Message
+	// Usage is the token usage summed over all round trips
+	Usage types.Usage
+	// SearchTokens is the number of tokens of $web_search results fed to the
+	// model, as reported by the API in the tool call arguments
+	SearchTokens int
+	// Rounds is the number of completion requests made
+	Rounds int
+}
+
+// CreateCompletionWithBuiltins creates a chat completion and handles calls to
+// builtin functions such as $web_search. The API executes builtin functions
+// itself; the client only echoes each call's arguments back as a tool
+// message, which this method does until the model answers or calls a
+// function the caller must execute.
+func (s *Service) CreateCompletionWithBuiltins(ctx context.Context, req types.ChatCompletionRequest, opts ...client.RequestOption) (*BuiltinResult, error) {
+	result := &BuiltinResult{}
+	messages := append([]types.Message(nil), req.Messages...)
+
+	for result.Rounds < maxBuiltinRounds {
+		req.Messages = messages
+		resp, err := s.CreateCompletion(ctx, req, opts...)
+		if err != nil {
+			return nil, err
+		}
+		result.Rounds++
+		result.Response = resp
+		addUsage(&result.Usage, resp.Usage)
+
+		if len(resp.Choices) == 0 || resp.Choices[0].FinishReason != "tool_calls" {
+			return result, nil
+		}
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || !allBuiltin(msg.ToolCalls) {
+			return result, nil
+		}
+
+		round := []types.Message{msg}
+		for _, tc := range msg.ToolCalls {
+			result.SearchTokens += searchTokens(tc)
+			round = append(round, types.Message{
+				Role:       "tool",
+				Content:    tc.Function.Arguments,
+				Name:       utils.String(tc.Function.Name),
+				ToolCallID: utils.String(tc.ID),
+			})
+		}
+		messages = append(messages, round...)
+		result.Messages = append(result.Messages, round...)
+	}
+
+	return nil, fmt.Errorf("builtin tool calls not resolved after %d rounds", maxBuiltinRounds)
+}
+
+func allBuiltin(calls []types.ToolCall) bool {
+	for _, tc := range calls {
+		if !tc.IsBuiltin() {
+			return false
+		}
+	}
+	return true
+}
+
+// searchTokens returns the result token count reported in the arguments of
+// a $web_search call
+func searchTokens(tc types.ToolCall) int {
+	if tc.Function.Name != types.BuiltinWebSearch {
+		return 0
+	}
+	var args struct {
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+		return 0
+	}
+	return args.Usage.TotalTokens
+}
+
+// addUsage adds the token counts of u to total
+func addUsage(total *types.Usage, u types.Usage) {
+	total.PromptTokens += u.PromptTokens
+	total.CompletionTokens += u.CompletionTokens
+	total.TotalTokens += u.TotalTokens
+	total.CachedTokens += u.CachedTokens
+	if u.CompletionTokensDetails != nil {
+		if total.CompletionTokensDetails == nil {
+			total.CompletionTokensDetails = &types.CompletionTokensDetails{}
+		}
+		total.CompletionTokensDetails.ReasoningTokens += u.CompletionTokensDetails.ReasoningTokens
+	}
+}
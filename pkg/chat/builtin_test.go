@@ -0,0 +1,133 @@
+package chat_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func TestService_CreateCompletionWithBuiltins(t *testing.T) {
+	searchArgs := `{"search_result":{"search_id":"s-1"},"usage":{"total_tokens":1500}}`
+	round := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req types.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Type != types.ToolTypeBuiltinFunction || req.Tools[0].Function.Name != types.BuiltinWebSearch {
+			t.Errorf("Tools = %+v, want $web_search builtin", req.Tools)
+		}
+		round++
+
+		var resp types.ChatCompletionResponse
+		switch round {
+		case 1:
+			if len(req.Messages) != 1 {
+				t.Errorf("round 1: len(Messages) = %d, want 1", len(req.Messages))
+			}
+			resp = types.ChatCompletionResponse{
+				Choices: []types.Choice{{
+					Message: types.Message{
+						Role: "assistant",
+						ToolCalls: []types.ToolCall{{
+							ID:       "call_1",
+							Type:     types.ToolTypeBuiltinFunction,
+							Function: types.FunctionCall{Name: types.BuiltinWebSearch, Arguments: searchArgs},
+						}},
+					},
+					FinishReason: "tool_calls",
+				}},
+				Usage: types.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			}
+		case 2:
+			if len(req.Messages) != 3 {
+				t.Errorf("round 2: len(Messages) = %d, want 3", len(req.Messages))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			echo := req.Messages[2]
+			if echo.Role != "tool" || echo.Content != searchArgs || *echo.ToolCallID != "call_1" || *echo.Name != types.BuiltinWebSearch {
+				t.Errorf("round 2: echo message = %+v", echo)
+			}
+			resp = types.ChatCompletionResponse{
+				Choices: []types.Choice{{
+					Message:      types.Message{Role: "assistant", Content: "It is sunny."},
+					FinishReason: "stop",
+				}},
+				Usage: types.Usage{PromptTokens: 1600, CompletionTokens: 8, TotalTokens: 1608},
+			}
+		default:
+			t.Errorf("unexpected round %d", round)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	result, err := s.CreateCompletionWithBuiltins(context.Background(), types.ChatCompletionRequest{
+		Model:    "kimi-k2",
+		Messages: []types.Message{{Role: "user", Content: "Weather in Paris today?"}},
+		Tools:    []types.Tool{types.WebSearchTool()},
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionWithBuiltins() error = %v", err)
+	}
+
+	if result.Rounds != 2 {
+		t.Errorf("Rounds = %d, want 2", result.Rounds)
+	}
+	if result.Response.Choices[0].Message.Content != "It is sunny." {
+		t.Errorf("final content = %v", result.Response.Choices[0].Message.Content)
+	}
+	if result.SearchTokens != 1500 {
+		t.Errorf("SearchTokens = %d, want 1500", result.SearchTokens)
+	}
+	if result.Usage.TotalTokens != 1623 {
+		t.Errorf("Usage.TotalTokens = %d, want 1623", result.Usage.TotalTokens)
+	}
+	if len(result.Messages) != 2 {
+		t.Errorf("len(Messages) = %d, want 2", len(result.Messages))
+	}
+}
+
+func TestService_CreateCompletionWithBuiltins_ClientTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(types.ChatCompletionResponse{
+			Choices: []types.Choice{{
+				Message: types.Message{
+					Role: "assistant",
+					ToolCalls: []types.ToolCall{{
+						ID:       "call_1",
+						Type:     types.ToolTypeFunction,
+						Function: types.FunctionCall{Name: "get_weather", Arguments: `{}`},
+					}},
+				},
+				FinishReason: "tool_calls",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	result, err := s.CreateCompletionWithBuiltins(context.Background(), types.ChatCompletionRequest{
+		Model:    "kimi-k2",
+		Messages: []types.Message{{Role: "user", Content: "Weather?"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionWithBuiltins() error = %v", err)
+	}
+
+	if result.Rounds != 1 {
+		t.Errorf("Rounds = %d, want 1", result.Rounds)
+	}
+	if result.Response.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls returned to caller", result.Response.Choices[0].FinishReason)
+	}
+}
@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// WithResponseCache answers repeated completion requests from cache instead
+// of calling the API. Streaming requests are served as a synthetic stream
+// replaying the cached response, and completed streams are stored too.
+// Cache failures are treated as misses and never fail a request. Entries
+// are keyed by the client's base URL and API key as well as the request, so
+// a cache may be shared by clients of different endpoints or accounts.
+//
+// By default only deterministic requests are cached; see WithCacheFilter.
+// Calls with request options that change the endpoint, API key or body
+// (WithRequestBaseURL, WithRequestAPIKey, WithExtraBody) bypass the cache.
+// A call answered from cache sends no request, so WithResponseMeta leaves
+// its ResponseMeta untouched.
+func WithResponseCache(cache respcache.Cache) ServiceOption {
+	return func(s *Service) {
+		s.cache = cache
+	}
+}
+
+// WithCacheFilter limits the response cache to requests for which filter
+// returns true. The default is respcache.Deterministic, which caches only
+// requests with a temperature of zero or a seed; pass a filter that always
+// returns true to cache every request.
+func WithCacheFilter(filter func(types.ChatCompletionRequest) bool) ServiceOption {
+	return func(s *Service) {
+		s.cacheFilter = filter
+	}
+}
+
+// cachedResponse looks req up in the response cache. It returns the key
+// under which the response should be stored, or "" if req is not cached,
+// and the cached response on a hit.
+func (s *Service) cachedResponse(ctx context.Context, req types.ChatCompletionRequest, opts []client.RequestOption) (string, *types.ChatCompletionResponse) {
+	if s.cache == nil || client.AltersRequest(opts...) {
+		return "", nil
+	}
+	filter := s.cacheFilter
+	if filter == nil {
+		filter = respcache.Deterministic
+	}
+	if !filter(req) {
+		return "", nil
+	}
+	key, err := respcache.Key(respcache.Scope(s.client.BaseURL(), s.client.APIKey()), req)
+	if err != nil {
+		return "", nil
+	}
+
+	data, ok, err := s.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return key, nil
+	}
+	var resp types.ChatCompletionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return key, nil
+	}
+	return key, &resp
+}
+
+// storeResponse stores resp under key, if set. Responses cut short by the
+// token limit or a content filter are not stored.
+func (s *Service) storeResponse(ctx context.Context, key string, resp *types.ChatCompletionResponse) {
+	if key == "" || len(resp.Choices) == 0 {
+		return
+	}
+	for _, c := range resp.Choices {
+		if c.FinishReason == "length" || c.FinishReason == "content_filter" {
+			return
+		}
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	s.cache.Set(ctx, key, data)
+}
+
+// replayStream returns a StreamReader that yields resp as a stream: one
+// chunk per choice carrying its whole message, then a chunk with the usage
+func replayStream(resp *types.ChatCompletionResponse, prefix string) *StreamReader {
+	var buf bytes.Buffer
+	write := func(chunk types.ChatCompletionStream) {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return
+		}
+		buf.WriteString("data: ")
+		buf.Write(data)
+		buf.WriteString("\n\n")
+	}
+
+	newChunk := func() types.ChatCompletionStream {
+		return types.ChatCompletionStream{
+			ID:                resp.ID,
+			Object:            "chat.completion.chunk",
+			Created:           resp.Created,
+			Model:             resp.Model,
+			SystemFingerprint: resp.SystemFingerprint,
+		}
+	}
+
+	for _, c := range resp.Choices {
+		role := c.Message.Role
+		delta := types.ChatCompletionStreamDelta{
+			Role:             &role,
+			ReasoningContent: c.Message.ReasoningContent,
+		}
+		if content, ok := c.Message.Content.(string); ok {
+			delta.Content = &content
+		}
+		for i, tc := range c.Message.ToolCalls {
+			if tc.Index == nil {
+				index := i
+				tc.Index = &index
+			}
+			delta.ToolCalls = append(delta.ToolCalls, tc)
+		}
+
+		finishReason := c.FinishReason
+		chunk := newChunk()
+		chunk.Choices = []types.ChatCompletionStreamChoice{{
+			Index:        c.Index,
+			Delta:        delta,
+			FinishReason: &finishReason,
+		}}
+		write(chunk)
+	}
+
+	usage := resp.Usage
+	chunk := newChunk()
+	chunk.Choices = []types.ChatCompletionStreamChoice{}
+	chunk.Usage = &usage
+	write(chunk)
+	buf.WriteString("data: [DONE]\n\n")
+
+	return newStreamReader(&buf, nil, prefix)
+}
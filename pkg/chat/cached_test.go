@@ -0,0 +1,198 @@
+package chat_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+func newCountingServer(calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		var req types.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Stream != nil && *req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hello\"},\"finish_reason\":null}]}\n\n")
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\" there\"},\"finish_reason\":\"stop\",\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2,\"total_tokens\":7}}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		json.NewEncoder(w).Encode(types.ChatCompletionResponse{
+			ID:    "chatcmpl-1",
+			Model: req.Model,
+			Choices: []types.Choice{{
+				Message:      types.Message{Role: "assistant", Content: "Hello there"},
+				FinishReason: "stop",
+			}},
+			Usage: types.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+		})
+	}))
+}
+
+func TestService_ResponseCache(t *testing.T) {
+	req := types.ChatCompletionRequest{
+		Model:       "kimi-k2-0711-preview",
+		Messages:    []types.Message{{Role: "user", Content: "Hi"}},
+		Temperature: utils.Float64(0),
+	}
+
+	t.Run("completion served from cache", func(t *testing.T) {
+		var calls int
+		server := newCountingServer(&calls)
+		defer server.Close()
+
+		service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)), chat.WithResponseCache(respcache.NewMemory(10, 0)))
+		for i := 0; i < 3; i++ {
+			resp, err := service.CreateCompletion(context.Background(), req)
+			if err != nil {
+				t.Fatalf("CreateCompletion() error = %v", err)
+			}
+			if resp.Choices[0].Message.Content != "Hello there" || resp.Usage.TotalTokens != 7 {
+				t.Errorf("response = %+v", resp)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+
+	t.Run("clients sharing a cache keep their entries apart", func(t *testing.T) {
+		var calls int
+		server := newCountingServer(&calls)
+		defer server.Close()
+		var otherCalls int
+		other := newCountingServer(&otherCalls)
+		defer other.Close()
+
+		shared := respcache.NewMemory(10, 0)
+		for _, c := range []*client.Client{
+			client.New("test-key", client.WithBaseURL(server.URL)),
+			client.New("other-key", client.WithBaseURL(server.URL)),
+			client.New("test-key", client.WithBaseURL(other.URL)),
+			client.New("test-key", client.WithBaseURL(server.URL)),
+		} {
+			if _, err := chat.NewService(c, chat.WithResponseCache(shared)).CreateCompletion(context.Background(), req); err != nil {
+				t.Fatalf("CreateCompletion() error = %v", err)
+			}
+		}
+		if calls != 2 || otherCalls != 1 {
+			t.Errorf("calls = %d and %d, want 2 and 1", calls, otherCalls)
+		}
+	})
+
+	t.Run("stream replayed from cache", func(t *testing.T) {
+		var calls int
+		server := newCountingServer(&calls)
+		defer server.Close()
+
+		service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)), chat.WithResponseCache(respcache.NewMemory(10, 0)))
+		for i := 0; i < 2; i++ {
+			stream, err := service.CreateCompletionStream(context.Background(), req)
+			if err != nil {
+				t.Fatalf("CreateCompletionStream() error = %v", err)
+			}
+			acc := stream.Accumulated()
+			for _, err := range stream.All() {
+				if err != nil {
+					t.Fatalf("stream error = %v", err)
+				}
+			}
+			stream.Close()
+
+			if acc.Content() != "Hello there" || acc.Usage() == nil || acc.Usage().TotalTokens != 7 {
+				t.Errorf("round %d: content = %q, usage = %+v", i, acc.Content(), acc.Usage())
+			}
+			if reason := acc.Response().Choices[0].FinishReason; reason != "stop" {
+				t.Errorf("round %d: finish reason = %q, want stop", i, reason)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+
+		// The non-streaming form of the request shares the entry
+		if _, err := service.CreateCompletion(context.Background(), req); err != nil {
+			t.Fatalf("CreateCompletion() error = %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d after CreateCompletion, want 1", calls)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		creative := req
+		creative.Temperature = utils.Float64(0.8)
+		cacheAll := func(types.ChatCompletionRequest) bool { return true }
+
+		tests := []struct {
+			name      string
+			opts      []chat.ServiceOption
+			wantCalls int
+		}{
+			{name: "deterministic only by default", wantCalls: 2},
+			{name: "custom filter", opts: []chat.ServiceOption{chat.WithCacheFilter(cacheAll)}, wantCalls: 1},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var calls int
+				server := newCountingServer(&calls)
+				defer server.Close()
+
+				opts := append([]chat.ServiceOption{chat.WithResponseCache(respcache.NewMemory(10, 0))}, tt.opts...)
+				service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)), opts...)
+				for i := 0; i < 2; i++ {
+					if _, err := service.CreateCompletion(context.Background(), creative); err != nil {
+						t.Fatalf("CreateCompletion() error = %v", err)
+					}
+				}
+				if calls != tt.wantCalls {
+					t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+				}
+			})
+		}
+	})
+
+	t.Run("request options that alter the request bypass the cache", func(t *testing.T) {
+		var calls int
+		server := newCountingServer(&calls)
+		defer server.Close()
+
+		service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)), chat.WithResponseCache(respcache.NewMemory(10, 0)))
+		for _, opt := range []client.RequestOption{
+			client.WithExtraBody(map[string]any{"thinking": true}),
+			client.WithRequestAPIKey("other-key"),
+			client.WithRequestBaseURL(server.URL),
+		} {
+			if _, err := service.CreateCompletion(context.Background(), req, opt); err != nil {
+				t.Fatalf("CreateCompletion() error = %v", err)
+			}
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+
+		// A hit sends no request and leaves the metadata untouched
+		if _, err := service.CreateCompletion(context.Background(), req); err != nil {
+			t.Fatalf("CreateCompletion() error = %v", err)
+		}
+		var meta client.ResponseMeta
+		if _, err := service.CreateCompletion(context.Background(), req, client.WithResponseMeta(&meta)); err != nil {
+			t.Fatalf("CreateCompletion() error = %v", err)
+		}
+		if calls != 4 || meta.StatusCode != 0 {
+			t.Errorf("calls = %d, meta = %+v, want 4 calls and empty metadata", calls, meta)
+		}
+	})
+}
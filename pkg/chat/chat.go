@@ -11,6 +11,7 @@ import (
 
 	"github.com/rizome-dev/go-moonshot/pkg/client"
 	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
 	"github.com/rizome-dev/go-moonshot/pkg/types"
 )
 
@@ -20,28 +21,36 @@ const (
 
 // Service handles chat-related operations
 type Service struct {
-	client *client.Client
+	client      *client.Client
+	cache       respcache.Cache
+	cacheFilter func(types.ChatCompletionRequest) bool
 }
 
+// ServiceOption is a function that configures a Service
+type ServiceOption func(*Service)
+
 // NewService creates a new chat service
-func NewService(c *client.Client) *Service {
-	return &Service{
+func NewService(c *client.Client, opts ...ServiceOption) *Service {
+	s := &Service{
 		client: c,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // CreateCompletion creates a chat completion
-func (s *Service) CreateCompletion(ctx context.Context, req types.ChatCompletionRequest) (*types.ChatCompletionResponse, error) {
+func (s *Service) CreateCompletion(ctx context.Context, req types.ChatCompletionRequest, opts ...client.RequestOption) (*types.ChatCompletionResponse, error) {
 	// Ensure streaming is disabled for non-streaming request
-	req.Stream = &[]bool{false}[0]
+	prepareRequest(&req, false, s.client.DefaultModel())
 	
-	// Adjust temperature for Moonshot API (maps by real_temperature = request_temperature * 0.6)
-	if req.Temperature != nil {
-		adjustedTemp := *req.Temperature * 0.6
-		req.Temperature = &adjustedTemp
+	key, cached := s.cachedResponse(ctx, req, opts)
+	if cached != nil {
+		return cached, nil
 	}
 	
-	resp, err := s.client.Request(ctx, http.MethodPost, completionsEndpoint, req)
+	resp, err := s.client.Request(ctx, http.MethodPost, completionsEndpoint, req, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,21 +65,64 @@ func (s *Service) CreateCompletion(ctx context.Context, req types.ChatCompletion
 		return nil, fmt.Errorf("decoding response: %w", err)
 	}
 	
+	s.storeResponse(ctx, key, &completionResp)
+	
 	return &completionResp, nil
 }
 
+// prepareRequest sets the stream flag and the model, if req names none,
+// and applies the request adjustments the Moonshot API expects
+func prepareRequest(req *types.ChatCompletionRequest, stream bool, model string) {
+	req.Stream = &stream
+	if req.Model == "" {
+		req.Model = model
+	}
+	
+	// Adjust temperature for Moonshot API (maps by real_temperature = request_temperature * 0.6)
+	if req.Temperature != nil {
+		adjustedTemp := *req.Temperature * 0.6
+		req.Temperature = &adjustedTemp
+	}
+	
+	// Reasoning from earlier turns is not sent back to thinking models
+	req.Messages = types.StripReasoning(req.Messages)
+}
+
+// CombinedContent returns the answer text of the first choice of resp,
+// preceded by the prefix of req's partial-mode message, if any. In partial
+// mode the API returns only the continuation of the prefix.
+func CombinedContent(req types.ChatCompletionRequest, resp *types.ChatCompletionResponse) string {
+	if resp == nil || len(resp.Choices) == 0 {
+		return req.PartialPrefix()
+	}
+	content, _ := resp.Choices[0].Message.Content.(string)
+	return req.PartialPrefix() + content
+}
+
 // StreamReader represents a reader for streaming responses
 type StreamReader struct {
-	reader   *bufio.Reader
-	response *http.Response
+	reader      *bufio.Reader
+	response    *http.Response
+	accumulator *Accumulator
+	prefix      string
+	// done is set once the end-of-stream event has been read
+	done bool
+	// onDone, if set, is called with the accumulated response once the
+	// end of the stream is read
+	onDone func(*types.ChatCompletionResponse)
 }
 
-// Read reads the next streaming chunk
+// Read reads the next streaming chunk. It returns io.EOF after the
+// end-of-stream event, and an error wrapping io.ErrUnexpectedEOF if the
+// response ends without one.
 func (sr *StreamReader) Read() (*types.ChatCompletionStream, error) {
+	if sr.done {
+		return nil, io.EOF
+	}
 	line, err := sr.reader.ReadString('\n')
 	if err != nil {
 		if err == io.EOF {
-			return nil, io.EOF
+			err = io.ErrUnexpectedEOF
 		}
 		return nil, fmt.Errorf("reading stream: %w", err)
 	}
@@ -92,6 +144,11 @@ func (sr *StreamReader) Read() (*types.ChatCompletionStream, error) {
 	
 	// Check for end of stream
 	if data == "[DONE]" {
+		sr.done = true
+		if sr.onDone != nil {
+			sr.onDone(sr.accumulator.Response())
+			sr.onDone = nil
+		}
 		return nil, io.EOF
 	}
 	
@@ -101,9 +158,50 @@ func (sr *StreamReader) Read() (*types.ChatCompletionStream, error) {
 		return nil, fmt.Errorf("parsing stream chunk: %w", err)
 	}
 	
+	if sr.accumulator != nil {
+		sr.accumulator.Add(&chunk)
+	}
+	
 	return &chunk, nil
 }
 
+// newStreamReader returns a reader of the SSE stream r. In partial mode,
+// when prefix is set, accumulation is on from the start so that
+// CombinedContent covers the whole answer.
+func newStreamReader(r io.Reader, resp *http.Response, prefix string) *StreamReader {
+	sr := &StreamReader{
+		reader:   bufio.NewReader(r),
+		response: resp,
+		prefix:   prefix,
+	}
+	if prefix != "" {
+		sr.Accumulated()
+	}
+	return sr
+}
+
+// Accumulated returns the accumulation of the chunks read so far.
+// Accumulation is opt-in: the first call turns it on, and chunks read before
+// it are not included, so call it before reading the stream. It is always on
+// for partial-mode requests.
+func (sr *StreamReader) Accumulated() *Accumulator {
+	if sr.accumulator == nil {
+		sr.accumulator = &Accumulator{}
+	}
+	return sr.accumulator
+}
+
+// CombinedContent returns the answer text accumulated so far, preceded by
+// the prefix of the request's partial-mode message, if any. In partial mode
+// it covers the whole stream; otherwise, like Accumulated, it only covers
+// chunks read after Accumulated was first called.
+func (sr *StreamReader) CombinedContent() string {
+	if sr.accumulator == nil {
+		return sr.prefix
+	}
+	return sr.prefix + sr.accumulator.Content()
+}
+
 // Close closes the stream reader
 func (sr *StreamReader) Close() error {
 	if sr.response != nil {
@@ -113,17 +211,16 @@ func (sr *StreamReader) Close() error {
 }
 
 // CreateCompletionStream creates a streaming chat completion
-func (s *Service) CreateCompletionStream(ctx context.Context, req types.ChatCompletionRequest) (*StreamReader, error) {
+func (s *Service) CreateCompletionStream(ctx context.Context, req types.ChatCompletionRequest, opts ...client.RequestOption) (*StreamReader, error) {
 	// Ensure streaming is enabled
-	req.Stream = &[]bool{true}[0]
+	prepareRequest(&req, true, s.client.DefaultModel())
 	
-	// Adjust temperature for Moonshot API (maps by real_temperature = request_temperature * 0.6)
-	if req.Temperature != nil {
-		adjustedTemp := *req.Temperature * 0.6
-		req.Temperature = &adjustedTemp
+	key, cached := s.cachedResponse(ctx, req, opts)
+	if cached != nil {
+		return replayStream(cached, req.PartialPrefix()), nil
 	}
 	
-	resp, err := s.client.StreamRequest(ctx, http.MethodPost, completionsEndpoint, req)
+	resp, err := s.client.StreamRequest(ctx, http.MethodPost, completionsEndpoint, req, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -133,15 +230,20 @@ func (s *Service) CreateCompletionStream(ctx context.Context, req types.ChatComp
 		return nil, errors.HandleErrorResponse(resp)
 	}
 	
-	return &StreamReader{
-		reader:   bufio.NewReader(resp.Body),
-		response: resp,
-	}, nil
+	sr := newStreamReader(resp.Body, resp, req.PartialPrefix())
+	if key != "" {
+		// The response is cached once complete, which needs the chunks
+		sr.Accumulated()
+		sr.onDone = func(completed *types.ChatCompletionResponse) {
+			s.storeResponse(ctx, key, completed)
+		}
+	}
+	return sr, nil
 }
 
 // CreateCompletionWithCallback creates a streaming chat completion with a callback for each chunk
-func (s *Service) CreateCompletionWithCallback(ctx context.Context, req types.ChatCompletionRequest, callback func(*types.ChatCompletionStream) error) error {
-	stream, err := s.CreateCompletionStream(ctx, req)
+func (s *Service) CreateCompletionWithCallback(ctx context.Context, req types.ChatCompletionRequest, callback func(*types.ChatCompletionStream) error, opts ...client.RequestOption) error {
+	stream, err := s.CreateCompletionStream(ctx, req, opts...)
 	if err != nil {
 		return err
 	}
@@ -163,8 +265,11 @@ func (s *Service) CreateCompletionWithCallback(ctx context.Context, req types.Ch
 }
 
 // CountTokens counts the number of tokens in a message sequence
-func (s *Service) CountTokens(ctx context.Context, req types.TokenCountRequest) (*types.TokenCountResponse, error) {
-	resp, err := s.client.Request(ctx, http.MethodPost, "/tokenizers/estimate_token_count", req)
+func (s *Service) CountTokens(ctx context.Context, req types.TokenCountRequest, opts ...client.RequestOption) (*types.TokenCountResponse, error) {
+	if req.Model == "" {
+		req.Model = s.client.DefaultModel()
+	}
+	resp, err := s.client.Request(ctx, http.MethodPost, "/tokenizers/estimate_token_count", req, opts...)
 	if err != nil {
 		return nil, err
 	}
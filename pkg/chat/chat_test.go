@@ -4,17 +4,22 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/rizome-dev/go-moonshot/pkg/chat"
 	"github.com/rizome-dev/go-moonshot/pkg/client"
 	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/fault"
 	"github.com/rizome-dev/go-moonshot/pkg/models"
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
 	"github.com/rizome-dev/go-moonshot/pkg/types"
 	"github.com/rizome-dev/go-moonshot/pkg/utils"
 )
@@ -473,4 +478,274 @@ data: [DONE]
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestService_CreateCompletion_ResponseMeta(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Msh-Request-Id", "req-chat")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "42")
+		json.NewEncoder(w).Encode(types.ChatCompletionResponse{ID: "chatcmpl-123"})
+	}))
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+
+	var meta client.ResponseMeta
+	_, err := s.CreateCompletion(context.Background(), types.ChatCompletionRequest{
+		Model:    models.MoonshotV18K.String(),
+		Messages: []types.Message{{Role: "user", Content: "Hello"}},
+	}, client.WithResponseMeta(&meta))
+	if err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+
+	if meta.RequestID != "req-chat" {
+		t.Errorf("RequestID = %q, want %q", meta.RequestID, "req-chat")
+	}
+	if meta.RateLimit.RemainingRequests != 42 {
+		t.Errorf("RateLimit.RemainingRequests = %d, want 42", meta.RateLimit.RemainingRequests)
+	}
+}
+
+func TestService_DefaultModel(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		got = append(got, req.Model)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"total_tokens": 1}`))
+	}))
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL), client.WithDefaultModel("kimi-k2")))
+	messages := []types.Message{{Role: "user", Content: "Hello"}}
+
+	s.CreateCompletion(context.Background(), types.ChatCompletionRequest{Messages: messages})
+	s.CreateCompletion(context.Background(), types.ChatCompletionRequest{Model: "moonshot-v1-8k", Messages: messages})
+	s.CountTokens(context.Background(), types.TokenCountRequest{Messages: messages})
+
+	want := []string{"kimi-k2", "moonshot-v1-8k", "kimi-k2"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("models sent = %v, want %v", got, want)
+	}
+}
+
+func TestService_PartialMode(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req types.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != "assistant" || !last.Partial {
+			t.Errorf("last message = %+v, want partial assistant message", last)
+		}
+
+		if req.Stream != nil && *req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"\"name\": "}}]}`+"\n\n")
+			fmt.Fprint(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"\"Kimi\"}"}}]}`+"\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		json.NewEncoder(w).Encode(types.ChatCompletionResponse{
+			ID:      "chatcmpl-123",
+			Choices: []types.Choice{{Message: types.Message{Role: "assistant", Content: `"name": "Kimi"}`}}},
+		})
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	s := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	req := types.ChatCompletionRequest{
+		Model: models.MoonshotV18K.String(),
+		Messages: []types.Message{
+			{Role: "user", Content: "Reply with your name as JSON"},
+			types.PartialMessage("{"),
+		},
+	}
+	want := `{"name": "Kimi"}`
+
+	t.Run("non-streaming", func(t *testing.T) {
+		resp, err := s.CreateCompletion(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CreateCompletion() error = %v", err)
+		}
+		if got := chat.CombinedContent(req, resp); got != want {
+			t.Errorf("CombinedContent() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		stream, err := s.CreateCompletionStream(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CreateCompletionStream() error = %v", err)
+		}
+		defer stream.Close()
+
+		for _, err := range stream.All() {
+			if err != nil {
+				t.Fatalf("All() error = %v", err)
+			}
+		}
+		if got := stream.CombinedContent(); got != want {
+			t.Errorf("CombinedContent() = %q, want %q", got, want)
+		}
+	})
+}
+
+// sseBody is a complete stream of two chunks
+const sseBody = "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hello\"}}]}\n\n" +
+	"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" there\"},\"finish_reason\":\"stop\"}]}\n\n" +
+	"data: [DONE]\n\n"
+
+// firstEventLen is the length of the first event of sseBody
+var firstEventLen = strings.Index(sseBody, "\n\n") + 2
+
+func TestService_CreateCompletionStream_Faults(t *testing.T) {
+	req := types.ChatCompletionRequest{
+		Model:    models.KimiK2.String(),
+		Messages: []types.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	tests := []struct {
+		name        string
+		rules       []fault.Rule
+		retry       client.RetryPolicy
+		wantErr     bool
+		wantStatus  int
+		wantReadErr error
+		wantContent string
+		wantCalls   int
+	}{
+		{
+			name:        "connection reset mid-stream",
+			rules:       []fault.Rule{{Fault: fault.ResetAfter(firstEventLen)}},
+			wantReadErr: syscall.ECONNRESET,
+			wantContent: "Hello",
+			wantCalls:   1,
+		},
+		{
+			name:        "truncated stream",
+			rules:       []fault.Rule{{Fault: fault.TruncateAfter(firstEventLen)}},
+			wantReadErr: io.ErrUnexpectedEOF,
+			wantContent: "Hello",
+			wantCalls:   1,
+		},
+		{
+			name:        "latency spike",
+			rules:       []fault.Rule{{Fault: fault.Latency(20 * time.Millisecond)}},
+			wantContent: "Hello there",
+			wantCalls:   1,
+		},
+		{
+			name:        "502 retried",
+			rules:       []fault.Rule{{Nth: 1, Fault: fault.BadGateway()}},
+			retry:       client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond},
+			wantContent: "Hello there",
+			wantCalls:   1,
+		},
+		{
+			name:       "429 storm exhausts retries",
+			rules:      []fault.Rule{{Path: "/chat/completions", Fault: fault.RateLimit(0)}},
+			retry:      client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond},
+			wantErr:    true,
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, sseBody)
+			}))
+			defer server.Close()
+
+			tr := fault.New(tt.rules)
+			c := client.New("test-key", client.WithBaseURL(server.URL), client.WithHTTPClient(tr.Client()), client.WithRetryPolicy(tt.retry))
+			s := chat.NewService(c)
+
+			stream, err := s.CreateCompletionStream(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateCompletionStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				apiErr, ok := errors.IsAPIError(err)
+				if !ok || apiErr.StatusCode != tt.wantStatus {
+					t.Errorf("error = %v, want status %d", err, tt.wantStatus)
+				}
+				if tr.Injected() != tt.retry.MaxRetries+1 {
+					t.Errorf("Injected() = %d, want %d", tr.Injected(), tt.retry.MaxRetries+1)
+				}
+				return
+			}
+			defer stream.Close()
+
+			acc := stream.Accumulated()
+			var readErr error
+			for _, err := range stream.All() {
+				readErr = err
+			}
+			if tt.wantReadErr != nil {
+				if !stderrors.Is(readErr, tt.wantReadErr) {
+					t.Errorf("read error = %v, want %v", readErr, tt.wantReadErr)
+				}
+			} else if readErr != nil {
+				t.Errorf("read error = %v", readErr)
+			}
+			if got := acc.Content(); got != tt.wantContent {
+				t.Errorf("content = %q, want %q", got, tt.wantContent)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("server calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestService_ResponseCache_TruncatedStream(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, sseBody)
+	}))
+	defer server.Close()
+
+	// The first stream is cut short, so it must not be cached
+	tr := fault.New([]fault.Rule{{Nth: 1, Fault: fault.TruncateAfter(firstEventLen)}})
+	c := client.New("test-key", client.WithBaseURL(server.URL), client.WithHTTPClient(tr.Client()))
+	s := chat.NewService(c, chat.WithResponseCache(respcache.NewMemory(10, 0)))
+
+	req := types.ChatCompletionRequest{
+		Model:       models.KimiK2.String(),
+		Messages:    []types.Message{{Role: "user", Content: "Hello"}},
+		Temperature: utils.Float64(0),
+	}
+	for i, want := range []string{"Hello", "Hello there", "Hello there"} {
+		stream, err := s.CreateCompletionStream(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CreateCompletionStream() error = %v", err)
+		}
+		acc := stream.Accumulated()
+		for _, err := range stream.All() {
+			if err != nil && (i > 0 || !stderrors.Is(err, io.ErrUnexpectedEOF)) {
+				t.Fatalf("round %d: stream error = %v", i, err)
+			}
+		}
+		stream.Close()
+		if got := acc.Content(); got != want {
+			t.Errorf("round %d: content = %q, want %q", i, got, want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("server calls = %d, want 2", calls)
+	}
+}
@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+const defaultFanOutConcurrency = 4
+
+// FanOutOptions configures CreateCompletions and CreateCompletionsAsCompleted
+type FanOutOptions struct {
+	// Concurrency is the number of requests in flight (default 4)
+	Concurrency int
+	// FailFast stops the fan-out at the first failed request. Requests that
+	// have not completed then fail with the context's error.
+	FailFast bool
+	// RateLimiter, if set, paces the requests of this fan-out in addition to
+	// any limiter configured on the client
+	RateLimiter client.RateLimiter
+	// RequestOptions are applied to every request
+	RequestOptions []client.RequestOption
+}
+
+// FanOutResult is the outcome of one request of a fan-out
+type FanOutResult struct {
+	// Index is the position of the request in the input
+	Index    int
+	Response *types.ChatCompletionResponse
+	Err      error
+}
+
+// CreateCompletions sends independent completion requests concurrently and
+// returns their results in input order. Per-request failures are reported
+// in the results; the returned error is set only when ctx is done or, with
+// FailFast, to the first failure. Requests cancelled because of that
+// failure do not count as failures themselves, even if they complete first.
+func (s *Service) CreateCompletions(ctx context.Context, reqs []types.ChatCompletionRequest, opts FanOutOptions) ([]FanOutResult, error) {
+	// Cancelled on return so the feeder below never outlives the fan-out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	in := make(chan types.ChatCompletionRequest)
+	go func() {
+		defer close(in)
+		for _, req := range reqs {
+			select {
+			case in <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make([]FanOutResult, len(reqs))
+	for i := range results {
+		results[i] = FanOutResult{Index: i, Err: context.Canceled}
+	}
+
+	var firstErr error
+	for res := range s.CreateCompletionsAsCompleted(ctx, in, opts) {
+		results[res.Index] = res
+		if res.Err != nil && opts.FailFast && firstErr == nil && !stderrors.Is(res.Err, context.Canceled) {
+			firstErr = res.Err
+		}
+	}
+
+	if firstErr != nil {
+		return results, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		for i := range results {
+			if results[i].Response == nil && results[i].Err == context.Canceled {
+				results[i].Err = err
+			}
+		}
+		return results, err
+	}
+	return results, nil
+}
+
+// CreateCompletionsAsCompleted sends the requests received from reqs
+// concurrently and delivers each result as soon as it is available. Result
+// indexes count requests in the order they were received. The returned
+// channel is closed once reqs is closed and all requests have completed, or
+// after ctx is done or, with FailFast, the first failure.
+//
+// Callers that stop receiving before the channel is closed must cancel ctx;
+// results not yet delivered are then dropped and the workers exit.
+func (s *Service) CreateCompletionsAsCompleted(ctx context.Context, reqs <-chan types.ChatCompletionRequest, opts FanOutOptions) <-chan FanOutResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultFanOutConcurrency
+	}
+
+	// Results are delivered until the caller's context is done; the derived
+	// one is also cancelled by FailFast, whose results must still arrive
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan FanOutResult)
+
+	type job struct {
+		index int
+		req   types.ChatCompletionRequest
+	}
+	jobs := make(chan job)
+
+	// Number the requests as they arrive
+	go func() {
+		defer close(jobs)
+		for index := 0; ; index++ {
+			select {
+			case req, ok := <-reqs:
+				if !ok {
+					return
+				}
+				select {
+				case jobs <- job{index: index, req: req}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg     sync.WaitGroup
+		failed sync.Once
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := FanOutResult{Index: j.index}
+				if opts.RateLimiter != nil {
+					res.Err = opts.RateLimiter.Wait(ctx)
+				}
+				if res.Err == nil {
+					res.Response, res.Err = s.CreateCompletion(ctx, j.req, opts.RequestOptions...)
+				}
+				if res.Err != nil && opts.FailFast {
+					failed.Do(cancel)
+				}
+				select {
+				case out <- res:
+				case <-parent.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+
+	return out
+}
@@ -0,0 +1,240 @@
+package chat_test
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// newEchoServer answers each completion with the content of its last
+// message, failing requests whose content is "fail". Requests whose content
+// is "slow" wait for the client to give up.
+func newEchoServer(t *testing.T, inFlight, maxInFlight *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			max := atomic.LoadInt32(maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(maxInFlight, max, n) {
+				break
+			}
+		}
+
+		var req types.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		content := req.Messages[len(req.Messages)-1].Content
+		time.Sleep(10 * time.Millisecond)
+
+		if content == "slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		if content == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]string{"message": "bad request", "type": "invalid_request_error"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(types.ChatCompletionResponse{
+			Choices: []types.Choice{{Message: types.Message{Role: "assistant", Content: content}}},
+		})
+	}))
+}
+
+func fanOutRequests(contents ...string) []types.ChatCompletionRequest {
+	reqs := make([]types.ChatCompletionRequest, len(contents))
+	for i, content := range contents {
+		reqs[i] = types.ChatCompletionRequest{
+			Model:    "kimi-k2-0711-preview",
+			Messages: []types.Message{{Role: "user", Content: content}},
+		}
+	}
+	return reqs
+}
+
+func TestService_CreateCompletions(t *testing.T) {
+	tests := []struct {
+		name        string
+		contents    []string
+		opts        chat.FanOutOptions
+		wantErr     bool
+		wantFailed  []int
+		concurrency int32
+	}{
+		{
+			name:        "results in input order",
+			contents:    []string{"a", "b", "c", "d", "e", "f"},
+			opts:        chat.FanOutOptions{Concurrency: 2},
+			concurrency: 2,
+		},
+		{
+			name:        "failures reported per request",
+			contents:    []string{"a", "fail", "c"},
+			opts:        chat.FanOutOptions{Concurrency: 3},
+			wantFailed:  []int{1},
+			concurrency: 3,
+		},
+		{
+			name:        "fail fast",
+			contents:    []string{"fail", "b", "c", "d", "e", "f"},
+			opts:        chat.FanOutOptions{Concurrency: 1, FailFast: true},
+			wantErr:     true,
+			wantFailed:  []int{0, 1, 2, 3, 4, 5},
+			concurrency: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, maxInFlight int32
+			server := newEchoServer(t, &inFlight, &maxInFlight)
+			defer server.Close()
+
+			service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+			results, err := service.CreateCompletions(context.Background(), fanOutRequests(tt.contents...), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateCompletions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(results) != len(tt.contents) {
+				t.Fatalf("len(results) = %d, want %d", len(results), len(tt.contents))
+			}
+
+			failed := map[int]bool{}
+			for _, i := range tt.wantFailed {
+				failed[i] = true
+			}
+			for i, res := range results {
+				if res.Index != i {
+					t.Errorf("results[%d].Index = %d", i, res.Index)
+				}
+				if failed[i] {
+					if res.Err == nil {
+						t.Errorf("results[%d].Err = nil, want error", i)
+					}
+					continue
+				}
+				if res.Err != nil {
+					t.Errorf("results[%d].Err = %v", i, res.Err)
+					continue
+				}
+				if got := res.Response.Choices[0].Message.Content; got != tt.contents[i] {
+					t.Errorf("results[%d] content = %q, want %q", i, got, tt.contents[i])
+				}
+			}
+
+			if maxInFlight > tt.concurrency {
+				t.Errorf("max in flight = %d, want at most %d", maxInFlight, tt.concurrency)
+			}
+		})
+	}
+}
+
+func TestService_CreateCompletions_FailFastConcurrent(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := newEchoServer(t, &inFlight, &maxInFlight)
+	defer server.Close()
+
+	// The slow requests are cancelled by the failure and may be reported
+	// before it; the failure is still the returned error
+	service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	for i := 0; i < 5; i++ {
+		results, err := service.CreateCompletions(context.Background(), fanOutRequests("slow", "slow", "fail", "slow"), chat.FanOutOptions{Concurrency: 4, FailFast: true})
+		if _, ok := errors.IsAPIError(err); !ok {
+			t.Fatalf("CreateCompletions() error = %v, want the API error", err)
+		}
+		for _, i := range []int{0, 1, 3} {
+			if !stderrors.Is(results[i].Err, context.Canceled) {
+				t.Errorf("results[%d].Err = %v, want cancelled", i, results[i].Err)
+			}
+		}
+	}
+}
+
+func TestService_CreateCompletions_ContextCancelled(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := newEchoServer(t, &inFlight, &maxInFlight)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Millisecond)
+	defer cancel()
+
+	service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+	results, err := service.CreateCompletions(ctx, fanOutRequests("a", "b", "c", "d", "e", "f"), chat.FanOutOptions{Concurrency: 1})
+	if err == nil {
+		t.Fatal("CreateCompletions() error = nil, want context error")
+	}
+	if results[len(results)-1].Err == nil {
+		t.Error("last result error = nil, want error")
+	}
+}
+
+func TestService_CreateCompletionsAsCompleted(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := newEchoServer(t, &inFlight, &maxInFlight)
+	defer server.Close()
+
+	service := chat.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+
+	contents := []string{"a", "b", "c", "d"}
+	reqs := make(chan types.ChatCompletionRequest)
+	go func() {
+		defer close(reqs)
+		for _, req := range fanOutRequests(contents...) {
+			reqs <- req
+		}
+	}()
+
+	seen := map[int]bool{}
+	limiter := client.NewRateLimiter(1000, 1)
+	for res := range service.CreateCompletionsAsCompleted(context.Background(), reqs, chat.FanOutOptions{Concurrency: 2, RateLimiter: limiter}) {
+		if res.Err != nil {
+			t.Fatalf("result %d error = %v", res.Index, res.Err)
+		}
+		if got := res.Response.Choices[0].Message.Content; got != contents[res.Index] {
+			t.Errorf("result %d content = %q, want %q", res.Index, got, contents[res.Index])
+		}
+		seen[res.Index] = true
+	}
+	if len(seen) != len(contents) {
+		t.Errorf("got %d results, want %d", len(seen), len(contents))
+	}
+
+	t.Run("abandoned by the caller", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		reqs := make(chan types.ChatCompletionRequest, len(contents))
+		for _, req := range fanOutRequests(contents...) {
+			reqs <- req
+		}
+		close(reqs)
+
+		out := service.CreateCompletionsAsCompleted(ctx, reqs, chat.FanOutOptions{Concurrency: 4})
+		// Let the workers finish and block on delivery, then give up
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+
+		var delivered int
+		for range out {
+			delivered++
+		}
+		if delivered != 0 {
+			t.Errorf("delivered %d results after cancel, want 0", delivered)
+		}
+	})
+}
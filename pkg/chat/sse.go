@@ -0,0 +1,232 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+const defaultHeartbeat = 15 * time.Second
+
+// RequestBuilder builds the completion request to stream for an incoming
+// HTTP request. An error is reported to the client with status 400.
+type RequestBuilder func(r *http.Request) (types.ChatCompletionRequest, error)
+
+// SSEOptions configures how a completion stream is sent to an HTTP client
+// as server-sent events.
+//
+// By default each chunk is sent as an OpenAI-style event with the chunk as
+// JSON data, followed by a chunk without choices that carries the usage of
+// the whole completion, and a final "data: [DONE]" event. With TextOnly,
+// events carry only the answer text of the first choice as
+// {"content": "..."} and usage is sent as {"usage": {...}}. A failure after
+// the stream has started, including an upstream stream that ends before its
+// own [DONE], is sent as {"error": {...}} and ends the stream without
+// [DONE].
+type SSEOptions struct {
+	// TextOnly sends only answer text deltas, leaving out roles, reasoning
+	// and tool calls
+	TextOnly bool
+	// Heartbeat is the interval of SSE comments sent while the model is
+	// silent, so proxies do not close the connection (default 15s; a
+	// negative value disables heartbeats)
+	Heartbeat time.Duration
+	// OmitUsage leaves out the final usage event
+	OmitUsage bool
+	// RequestOptions are applied to completion requests made by
+	// StreamHandler
+	RequestOptions []client.RequestOption
+}
+
+// StreamHandler returns an http.Handler that streams the completion built
+// by build for each request to the client as server-sent events. The
+// completion is cancelled when the client disconnects.
+func (s *Service) StreamHandler(build RequestBuilder, opts SSEOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := build(r)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, errors.APIError{Message: err.Error(), Type: "invalid_request_error"})
+			return
+		}
+
+		stream, err := s.CreateCompletionStream(r.Context(), req, opts.RequestOptions...)
+		if err != nil {
+			WriteStreamError(w, err)
+			return
+		}
+		defer stream.Close()
+
+		ServeStream(w, r, stream, opts)
+	})
+}
+
+// ServeStream sends stream to the client of r as server-sent events,
+// flushing each event as it is written. It returns nil once the whole
+// stream was sent, and otherwise the error that ended it. If the client
+// disconnects, ServeStream closes stream; create the stream with r's
+// context so that the completion is cancelled too.
+func ServeStream(w http.ResponseWriter, r *http.Request, stream *StreamReader, opts SSEOptions) error {
+	heartbeat := opts.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	send := func(v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			data, _ = json.Marshal(errors.ErrorResponse{Error: errors.APIError{Message: err.Error(), Type: "api_error"}})
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flush()
+	}
+	flush()
+
+	// The final usage event is built from the accumulated chunks
+	var acc *Accumulator
+	if !opts.OmitUsage {
+		acc = stream.Accumulated()
+	}
+
+	type readResult struct {
+		chunk *types.ChatCompletionStream
+		err   error
+	}
+	results := make(chan readResult)
+	go func() {
+		for {
+			chunk, err := stream.Read()
+			results <- readResult{chunk: chunk, err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// Unblock the reader, then wait for it so the stream is no
+			// longer in use when we return
+			stream.Close()
+			for res := range results {
+				if res.err != nil {
+					break
+				}
+			}
+			return r.Context().Err()
+
+		case <-tick:
+			io.WriteString(w, ": ping\n\n")
+			flush()
+
+		case res := <-results:
+			if res.err == io.EOF {
+				if !opts.OmitUsage {
+					send(usageEvent(acc, opts.TextOnly))
+				}
+				io.WriteString(w, "data: [DONE]\n\n")
+				flush()
+				return nil
+			}
+			if res.err != nil {
+				send(errors.ErrorResponse{Error: streamError(res.err)})
+				return res.err
+			}
+			if !opts.TextOnly {
+				send(res.chunk)
+				continue
+			}
+			if text := chunkText(res.chunk); text != "" {
+				send(textEvent{Content: text})
+			}
+		}
+	}
+}
+
+// textEvent is the data of an event in TextOnly mode
+type textEvent struct {
+	Content string `json:"content"`
+}
+
+// chunkText returns the answer text of the first choice in chunk
+func chunkText(chunk *types.ChatCompletionStream) string {
+	for _, c := range chunk.Choices {
+		if c.Index == 0 && c.Delta.Content != nil {
+			return *c.Delta.Content
+		}
+	}
+	return ""
+}
+
+// usageEvent returns the data of the final usage event
+func usageEvent(acc *Accumulator, textOnly bool) any {
+	usage := acc.Usage()
+	if usage == nil {
+		usage = &types.Usage{}
+	}
+	if textOnly {
+		return struct {
+			Usage *types.Usage `json:"usage"`
+		}{usage}
+	}
+	resp := acc.Response()
+	return types.ChatCompletionStream{
+		ID:                resp.ID,
+		Object:            "chat.completion.chunk",
+		Created:           resp.Created,
+		Model:             resp.Model,
+		Choices:           []types.ChatCompletionStreamChoice{},
+		SystemFingerprint: resp.SystemFingerprint,
+		Usage:             usage,
+	}
+}
+
+// streamError converts err to the API error sent to the client
+func streamError(err error) errors.APIError {
+	if apiErr, ok := errors.IsAPIError(err); ok {
+		return *apiErr
+	}
+	return errors.APIError{Message: err.Error(), Type: "api_error", Code: "stream_error"}
+}
+
+// WriteStreamError reports an error that prevented a stream from starting.
+// API errors keep their status and error body; other errors are reported
+// with status 502.
+func WriteStreamError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	if apiErr, ok := errors.IsAPIError(err); ok && apiErr.StatusCode != 0 {
+		status = apiErr.StatusCode
+	}
+	writeErrorResponse(w, status, streamError(err))
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, apiErr errors.APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errors.ErrorResponse{Error: apiErr})
+}
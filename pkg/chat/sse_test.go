@@ -0,0 +1,245 @@
+package chat_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// questionRequest builds a completion request from the q query parameter
+func questionRequest(r *http.Request) (types.ChatCompletionRequest, error) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		return types.ChatCompletionRequest{}, stderrors.New("missing q")
+	}
+	return types.ChatCompletionRequest{
+		Model:    "kimi-k2",
+		Messages: []types.Message{{Role: "user", Content: q}},
+	}, nil
+}
+
+// readEvents returns the data of each event in an SSE body, and the
+// comments sent between them
+func readEvents(t *testing.T, body io.Reader) (events []string, comments int) {
+	t.Helper()
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, ":"):
+			comments++
+		case strings.HasPrefix(line, "data: "):
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+	return events, comments
+}
+
+func TestService_StreamHandler(t *testing.T) {
+	upstream := moonshottest.NewServer()
+	defer upstream.Close()
+	s := chat.NewService(upstream.Client())
+
+	t.Run("chunks", func(t *testing.T) {
+		server := httptest.NewServer(s.StreamHandler(questionRequest, chat.SSEOptions{}))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "?q=one+two")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+		}
+
+		events, _ := readEvents(t, resp.Body)
+		if events[len(events)-1] != "[DONE]" {
+			t.Fatalf("last event = %q, want [DONE]", events[len(events)-1])
+		}
+		var acc chat.Accumulator
+		for _, data := range events[:len(events)-2] {
+			var chunk types.ChatCompletionStream
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				t.Fatalf("decoding chunk %q: %v", data, err)
+			}
+			acc.Add(&chunk)
+		}
+		if acc.Content() != "echo: one two" {
+			t.Errorf("content = %q", acc.Content())
+		}
+
+		var usage types.ChatCompletionStream
+		if err := json.Unmarshal([]byte(events[len(events)-2]), &usage); err != nil {
+			t.Fatal(err)
+		}
+		if usage.Usage == nil || usage.Usage.TotalTokens == 0 || len(usage.Choices) != 0 || usage.Object != "chat.completion.chunk" {
+			t.Errorf("usage event = %s", events[len(events)-2])
+		}
+	})
+
+	t.Run("text only", func(t *testing.T) {
+		server := httptest.NewServer(s.StreamHandler(questionRequest, chat.SSEOptions{TextOnly: true}))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "?q=one+two")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		events, _ := readEvents(t, resp.Body)
+		var text strings.Builder
+		for _, data := range events[:len(events)-2] {
+			var ev struct {
+				Content *string `json:"content"`
+			}
+			if err := json.Unmarshal([]byte(data), &ev); err != nil || ev.Content == nil {
+				t.Fatalf("event %q is not a text event", data)
+			}
+			text.WriteString(*ev.Content)
+		}
+		if text.String() != "echo: one two" {
+			t.Errorf("text = %q", text.String())
+		}
+		if !strings.HasPrefix(events[len(events)-2], `{"usage":{`) || events[len(events)-1] != "[DONE]" {
+			t.Errorf("final events = %q", events[len(events)-2:])
+		}
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		upstream.InjectFault(moonshottest.SlowFirstToken(50 * time.Millisecond))
+		server := httptest.NewServer(s.StreamHandler(questionRequest, chat.SSEOptions{Heartbeat: 10 * time.Millisecond, OmitUsage: true}))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "?q=hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		events, comments := readEvents(t, resp.Body)
+		if comments == 0 {
+			t.Error("no heartbeats sent")
+		}
+		for _, data := range events {
+			if strings.Contains(data, `"choices":[]`) {
+				t.Errorf("usage event sent with OmitUsage: %q", data)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		server := httptest.NewServer(s.StreamHandler(questionRequest, chat.SSEOptions{}))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("builder error: status = %d", resp.StatusCode)
+		}
+
+		upstream.InjectFault(moonshottest.RateLimited(0))
+		resp, err = http.Get(server.URL + "?q=hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || !strings.Contains(string(body), "rate_limit_reached_error") {
+			t.Errorf("upstream error: status = %d, body = %s", resp.StatusCode, body)
+		}
+
+		upstream.InjectFault(moonshottest.MalformedStream())
+		resp, err = http.Get(server.URL + "?q=hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, _ := readEvents(t, resp.Body)
+		resp.Body.Close()
+		if last := events[len(events)-1]; !strings.HasPrefix(last, `{"error":{`) {
+			t.Errorf("last event = %q, want an error", last)
+		}
+	})
+
+	t.Run("truncated upstream", func(t *testing.T) {
+		truncated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"partial"}}]}`+"\n\n")
+		}))
+		defer truncated.Close()
+		s := chat.NewService(client.New("test-key", client.WithBaseURL(truncated.URL)))
+		server := httptest.NewServer(s.StreamHandler(questionRequest, chat.SSEOptions{}))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "?q=hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		events, _ := readEvents(t, resp.Body)
+		if len(events) != 2 || !strings.Contains(events[0], "partial") {
+			t.Fatalf("events = %q, want the chunk and an error", events)
+		}
+		if !strings.HasPrefix(events[1], `{"error":{`) || !strings.Contains(events[1], "unexpected EOF") {
+			t.Errorf("last event = %q, want an unexpected EOF error without [DONE]", events[1])
+		}
+	})
+}
+
+func TestServeStream_ClientDisconnect(t *testing.T) {
+	upstream := moonshottest.NewServer()
+	defer upstream.Close()
+	upstream.InjectFault(moonshottest.SlowFirstToken(10 * time.Second))
+	s := chat.NewService(upstream.Client())
+
+	served := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := questionRequest(r)
+		stream, err := s.CreateCompletionStream(r.Context(), req)
+		if err != nil {
+			served <- err
+			return
+		}
+		defer stream.Close()
+		served <- chat.ServeStream(w, r, stream, chat.SSEOptions{})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?q=hi", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err := <-served:
+		if !stderrors.Is(err, context.Canceled) {
+			t.Errorf("ServeStream() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeStream did not return after the client disconnected")
+	}
+}
@@ -4,15 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
 )
 
 const (
-	defaultBaseURL = "https://api.moonshot.ai/v1"
+	defaultBaseURL = GlobalBaseURL
 	defaultTimeout = 30 * time.Second
 	EnvAPIKey      = "MOONSHOT_API_KEY"
 	Version        = "0.1.0"
@@ -20,18 +24,56 @@ const (
 
 // Client is the main client for interacting with the Moonshot API
 type Client struct {
-	httpClient *http.Client
-	baseURL    string
-	apiKey     string
-	userAgent  string
+	httpClient  *http.Client
+	baseURL     string
+	apiKey      string
+	userAgent   string
+	retry       RetryPolicy
+	middlewares []Middleware
+	checks      []RequestCheck
+	limiter     RateLimiter
+	model       string
+
+	// applied holds the value each recorded option was given, and
+	// conflicts the options given again with a different value
+	applied   map[string]string
+	conflicts []string
 }
 
 // Option is a function that configures a Client
 type Option func(*Client)
 
-// WithHTTPClient sets a custom HTTP client
+// Handler sends a single HTTP request
+type Handler func(*http.Request) (*http.Response, error)
+
+// Middleware wraps the Handler that sends requests to the API. Middleware
+// sees every attempt, including retries, after per-request options have
+// been applied.
+type Middleware func(next Handler) Handler
+
+// RequestCheck is called once before a request is sent, ahead of any
+// retries. If it returns an error, the request is not sent and Request or
+// Do returns the error unchanged.
+type RequestCheck func(req *http.Request) error
+
+// WithAPIKey sets the API key. Without it the key is read from the
+// MOONSHOT_API_KEY environment variable.
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.record("WithAPIKey", apiKey)
+		c.apiKey = apiKey
+	}
+}
+
+// WithHTTPClient sets a custom HTTP client. A nil client is a
+// configuration error; the default client is kept in its place.
 func WithHTTPClient(httpClient *http.Client) Option {
 	return func(c *Client) {
+		if httpClient == nil {
+			c.record("WithHTTPClient", "nil")
+			return
+		}
+		c.record("WithHTTPClient", fmt.Sprintf("%p", httpClient))
 		c.httpClient = httpClient
 	}
 }
@@ -39,6 +81,7 @@ func WithHTTPClient(httpClient *http.Client) Option {
 // WithBaseURL sets a custom base URL
 func WithBaseURL(baseURL string) Option {
 	return func(c *Client) {
+		c.record("WithBaseURL", baseURL)
 		c.baseURL = baseURL
 	}
 }
@@ -46,6 +89,7 @@ func WithBaseURL(baseURL string) Option {
 // WithTimeout sets the HTTP client timeout
 func WithTimeout(timeout time.Duration) Option {
 	return func(c *Client) {
+		c.record("WithTimeout", timeout.String())
 		c.httpClient.Timeout = timeout
 	}
 }
@@ -57,7 +101,59 @@ func WithUserAgent(userAgent string) Option {
 	}
 }
 
-// New creates a new Moonshot client.
+// WithRetryPolicy sets the default retry policy for all requests
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithDefaultModel sets the model used by requests that name none
+func WithDefaultModel(model string) Option {
+	return func(c *Client) {
+		c.model = model
+	}
+}
+
+// WithMiddleware appends middleware to the request chain. The first
+// middleware given is the outermost.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, mw...)
+	}
+}
+
+// WithRequestCheck adds a check run before each request, such as the
+// balance guard of the balance package
+func WithRequestCheck(check RequestCheck) Option {
+	return func(c *Client) {
+		c.checks = append(c.checks, check)
+	}
+}
+
+// NewClient creates a Moonshot client and validates its configuration.
+// It returns a ConfigError if no API key is given by WithAPIKey or the
+// MOONSHOT_API_KEY environment variable, if the base URL is not an http or
+// https URL, or if options conflict: the same option given twice with
+// different values, or WithTimeout with WithHTTPClient (set the timeout on
+// the http.Client instead).
+//
+//	c, err := client.NewClient(
+//		client.WithAPIKey("sk-..."),
+//		client.WithTimeout(30*time.Second),
+//	)
+func NewClient(opts ...Option) (*Client, error) {
+	c := newClient(opts)
+	if err := c.validate(true); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New creates a new Moonshot client from an API key string and options.
+// It is the untyped form of NewClient, kept for compatibility: it does not
+// validate the configuration, parameters of other types are ignored, and
+// of several keys the last wins.
 // Usage:
 //
 //	client.New()                    // Uses MOONSHOT_API_KEY env var
@@ -65,26 +161,37 @@ func WithUserAgent(userAgent string) Option {
 //	client.New(client.WithTimeout(30*time.Second))  // With options only
 //	client.New("sk-...", client.WithTimeout(30*time.Second))  // With API key and options
 func New(params ...interface{}) *Client {
-	c := &Client{
-		httpClient: &http.Client{
-			Timeout: defaultTimeout,
-		},
-		baseURL:   defaultBaseURL,
-		userAgent: fmt.Sprintf("go-moonshot/%s", Version),
-	}
+	var opts []Option
 	
 	// Process parameters - can be string (API key) or Option
 	for _, param := range params {
 		switch v := param.(type) {
 		case string:
-			c.apiKey = v
+			opts = append(opts, WithAPIKey(v))
 		case Option:
-			v(c)
+			opts = append(opts, v)
 		case func(*Client):
-			v(c)
+			opts = append(opts, v)
 		}
 	}
 	
+	return newClient(opts)
+}
+
+// newClient creates a client with the defaults and opts applied. If no
+// API key is set, it is read from the environment.
+func newClient(opts []Option) *Client {
+	c := &Client{
+		httpClient: &http.Client{
+			Timeout: defaultTimeout,
+		},
+		baseURL:   defaultBaseURL,
+		userAgent: fmt.Sprintf("go-moonshot/%s", Version),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	
 	// If no API key provided, try environment variable
 	if c.apiKey == "" {
 		c.apiKey = os.Getenv(EnvAPIKey)
@@ -93,15 +200,71 @@ func New(params ...interface{}) *Client {
 	return c
 }
 
+// record notes the value an option set, so that an option given again
+// with a different value can be reported as a conflict
+func (c *Client) record(option, value string) {
+	if c.applied == nil {
+		c.applied = map[string]string{}
+	}
+	if prev, ok := c.applied[option]; ok && prev != value {
+		c.conflicts = append(c.conflicts, option)
+	}
+	c.applied[option] = value
+}
+
+// validate reports the problems of c's configuration, including
+// conflicting options if conflicts is set
+func (c *Client) validate(conflicts bool) error {
+	var errs []error
+	if conflicts {
+		seen := map[string]bool{}
+		for _, option := range c.conflicts {
+			if !seen[option] {
+				seen[option] = true
+				errs = append(errs, errors.ConfigError{Setting: option, Message: option + " is given more than once with different values"})
+			}
+		}
+	}
+	// A timeout or proxy would be lost on, or would change, a caller's client
+	if custom := c.applied["WithHTTPClient"]; custom != "" && custom != "nil" {
+		if _, ok := c.applied["WithTimeout"]; ok {
+			errs = append(errs, errors.ConfigError{Setting: "WithTimeout", Message: "WithTimeout conflicts with WithHTTPClient; set the timeout on the http.Client"})
+		}
+		if _, ok := c.applied["proxy"]; ok {
+			errs = append(errs, errors.ConfigError{Setting: "proxy", Message: "the configured proxy conflicts with WithHTTPClient; set the proxy on the http.Client"})
+		}
+	}
+	if c.applied["WithHTTPClient"] == "nil" {
+		errs = append(errs, errors.ConfigError{Setting: "http_client", Message: "WithHTTPClient is given a nil *http.Client"})
+	}
+	if c.apiKey == "" {
+		errs = append(errs, errors.ConfigError{Setting: "api_key", Message: "no API key given and " + EnvAPIKey + " is not set"})
+	}
+	if err := checkURL(c.baseURL); err != nil {
+		errs = append(errs, errors.ConfigError{Setting: "base_url", Message: "base url: " + err.Error()})
+	}
+	return stderrors.Join(errs...)
+}
+
+// DefaultModel returns the model set with WithDefaultModel, or ""
+func (c *Client) DefaultModel() string {
+	return c.model
+}
+
 // Request performs an HTTP request to the Moonshot API
-func (c *Client) Request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+func (c *Client) Request(ctx context.Context, method, path string, body interface{}, opts ...RequestOption) (*http.Response, error) {
+	cfg := newRequestConfig(opts)
+	
 	url := c.baseURL + path
+	if cfg.baseURL != "" {
+		url = cfg.baseURL + path
+	}
 	
 	var reqBody io.Reader
 	if body != nil {
-		data, err := json.Marshal(body)
+		data, err := marshalBody(body, cfg.extraBody)
 		if err != nil {
-			return nil, fmt.Errorf("marshaling request body: %w", err)
+			return nil, err
 		}
 		reqBody = bytes.NewReader(data)
 	}
@@ -111,23 +274,192 @@ func (c *Client) Request(ctx context.Context, method, path string, body interfac
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
 	
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("Content-Type", "application/json")
+	
+	return c.do(req, cfg)
+}
+
+// Do sends a prepared request to the Moonshot API, adding authentication and
+// user agent headers. It is used for requests whose body is not JSON, such as
+// multipart file uploads. WithExtraBody has no effect on requests sent this way.
+func (c *Client) Do(req *http.Request, opts ...RequestOption) (*http.Response, error) {
+	cfg := newRequestConfig(opts)
+	if cfg.baseURL != "" && strings.HasPrefix(req.URL.String(), c.baseURL) {
+		u, err := req.URL.Parse(cfg.baseURL + strings.TrimPrefix(req.URL.String(), c.baseURL))
+		if err != nil {
+			return nil, fmt.Errorf("applying base url: %w", err)
+		}
+		req.URL = u
+		req.Host = ""
+	}
+	return c.do(req, cfg)
+}
+
+// do applies the per-request configuration and sends req through the
+// middleware chain, retrying according to the effective retry policy
+func (c *Client) do(req *http.Request, cfg *requestConfig) (*http.Response, error) {
+	for _, check := range c.checks {
+		if err := check(req); err != nil {
+			return nil, err
+		}
+	}
+	
+	apiKey := c.apiKey
+	if cfg.apiKey != "" {
+		apiKey = cfg.apiKey
+	}
+	
+	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("User-Agent", c.userAgent)
+	if req.Header.Get("Content-Type") == "" && req.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cfg.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", cfg.idempotencyKey)
+	}
+	for key, values := range cfg.header {
+		req.Header[key] = values
+	}
+	
+	req, cancel := withTimeout(req, cfg.timeout)
 	
-	resp, err := c.httpClient.Do(req)
+	policy := c.retry
+	if cfg.retry != nil {
+		policy = *cfg.retry
+	}
+	
+	send := c.handler()
+	
+	var (
+		resp     *http.Response
+		err      error
+		start    time.Time
+		attempts int
+	)
+	for {
+		attempts++
+		attemptReq := req
+		if attempts > 1 {
+			if attemptReq, err = rewindRequest(req); err != nil {
+				cancel()
+				return nil, err
+			}
+		}
+		
+		if c.limiter != nil {
+			if err := c.limiter.Wait(req.Context()); err != nil {
+				cancel()
+				return nil, fmt.Errorf("waiting for rate limiter: %w", err)
+			}
+		}
+		
+		written := false
+		start = time.Now()
+		resp, err = send(traceWritten(attemptReq, &written))
+		
+		replayable := !written || isIdempotent(req)
+		wait, retry := policy.shouldRetry(req.Context(), attempts, resp, err, replayable)
+		if !retry {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := sleepContext(req.Context(), wait); err != nil {
+			cancel()
+			return nil, fmt.Errorf("performing request: %w", err)
+		}
+	}
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("performing request: %w", err)
 	}
 	
+	if cfg.meta != nil {
+		*cfg.meta = ResponseMeta{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			RequestID:  errors.RequestIDFromHeader(resp.Header),
+			RateLimit:  errors.ParseRateLimit(resp.Header),
+			Latency:    time.Since(start),
+			Attempts:   attempts,
+		}
+	}
+	
+	// The timeout context must outlive this call so streamed bodies can be
+	// read; release it when the body is closed
+	if cfg.timeout > 0 {
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	}
+	
 	return resp, nil
 }
 
+// handler returns the middleware chain wrapped around the HTTP client
+func (c *Client) handler() Handler {
+	h := Handler(c.httpClient.Do)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		h = c.middlewares[i](h)
+	}
+	return h
+}
+
+// withTimeout bounds req by timeout, if positive. The returned function
+// releases the timeout context.
+func withTimeout(req *http.Request, timeout time.Duration) (*http.Request, context.CancelFunc) {
+	if timeout <= 0 {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return req.WithContext(ctx), cancel
+}
+
+// marshalBody encodes body as JSON and merges extra into the top-level object
+func marshalBody(body interface{}, extra map[string]any) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request body: %w", err)
+	}
+	if len(extra) == 0 {
+		return data, nil
+	}
+	
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("merging extra body: request body is not a JSON object: %w", err)
+	}
+	for key, value := range extra {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling extra body field %q: %w", key, err)
+		}
+		fields[key] = raw
+	}
+	
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request body: %w", err)
+	}
+	return data, nil
+}
+
+// cancelOnClose releases a request context when the response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
 // StreamRequest performs a streaming HTTP request to the Moonshot API
-func (c *Client) StreamRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+func (c *Client) StreamRequest(ctx context.Context, method, path string, body interface{}, opts ...RequestOption) (*http.Response, error) {
 	// For streaming requests, we need to ensure the body includes stream: true
 	// This is handled by the caller, but we use the same request method
-	return c.Request(ctx, method, path, body)
+	return c.Request(ctx, method, path, body, opts...)
 }
 
 // BaseURL returns the base URL of the client
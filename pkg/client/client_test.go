@@ -2,13 +2,19 @@ package client_test
 
 import (
 	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
 )
 
 func TestNew(t *testing.T) {
@@ -98,6 +104,89 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []client.Option
+		envKey  string
+		wantErr []string // settings of the expected ConfigErrors
+	}{
+		{
+			name: "with api key",
+			opts: []client.Option{client.WithAPIKey("test-api-key"), client.WithTimeout(time.Minute)},
+		},
+		{
+			name:   "with env var",
+			envKey: "env-api-key",
+		},
+		{
+			name:    "missing api key",
+			wantErr: []string{"api_key"},
+		},
+		{
+			name:    "malformed base url",
+			opts:    []client.Option{client.WithAPIKey("test-api-key"), client.WithBaseURL("api.moonshot.cn/v1")},
+			wantErr: []string{"base_url"},
+		},
+		{
+			name:    "two api keys",
+			opts:    []client.Option{client.WithAPIKey("key-1"), client.WithAPIKey("key-2")},
+			wantErr: []string{"WithAPIKey"},
+		},
+		{
+			name: "same option twice",
+			opts: []client.Option{client.WithAPIKey("key-1"), client.WithAPIKey("key-1")},
+		},
+		{
+			name:    "timeout with http client",
+			opts:    []client.Option{client.WithAPIKey("test-api-key"), client.WithHTTPClient(&http.Client{}), client.WithTimeout(time.Second)},
+			wantErr: []string{"WithTimeout"},
+		},
+		{
+			name:    "nil http client",
+			opts:    []client.Option{client.WithAPIKey("test-api-key"), client.WithHTTPClient(nil), client.WithTimeout(time.Second)},
+			wantErr: []string{"http_client"},
+		},
+		{
+			name:    "several problems",
+			opts:    []client.Option{client.WithBaseURL("ftp://example.com"), client.WithBaseURL("://")},
+			wantErr: []string{"WithBaseURL", "api_key", "base_url"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(client.EnvAPIKey, tt.envKey)
+
+			c, err := client.NewClient(tt.opts...)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("NewClient() error = %v", err)
+				}
+				if c.APIKey() == "" {
+					t.Error("expected API key to be set")
+				}
+				return
+			}
+
+			if c != nil || err == nil {
+				t.Fatalf("NewClient() = %v, %v; want an error", c, err)
+			}
+			var settings []string
+			for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+				var configErr errors.ConfigError
+				if !stderrors.As(e, &configErr) {
+					t.Fatalf("error %v is not a ConfigError", e)
+				}
+				settings = append(settings, configErr.Setting)
+			}
+			if strings.Join(settings, ",") != strings.Join(tt.wantErr, ",") {
+				t.Errorf("errors for %v, want %v: %v", settings, tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestClient_Request(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -197,4 +286,393 @@ func TestOptions(t *testing.T) {
 		}
 		// Note: We can't directly test the user agent as it's not exported
 	})
-}
\ No newline at end of file
+}
+
+func TestWithResponseMeta(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Msh-Request-Id", "req-123")
+		w.Header().Set("X-Ratelimit-Remaining-Tokens", "9000")
+		w.Header().Set("Server-Timing", "upstream;dur=42")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	c := client.New("test-key", client.WithBaseURL(server.URL))
+
+	var meta client.ResponseMeta
+	resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil, client.WithResponseMeta(&meta))
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if meta.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", meta.StatusCode, http.StatusOK)
+	}
+	if meta.RequestID != "req-123" {
+		t.Errorf("RequestID = %q, want %q", meta.RequestID, "req-123")
+	}
+	if meta.RateLimit.RemainingTokens != 9000 {
+		t.Errorf("RateLimit.RemainingTokens = %d, want 9000", meta.RateLimit.RemainingTokens)
+	}
+	if meta.Header.Get("Server-Timing") != "upstream;dur=42" {
+		t.Errorf("Header[Server-Timing] = %q", meta.Header.Get("Server-Timing"))
+	}
+	if meta.Latency <= 0 {
+		t.Errorf("Latency = %v, want > 0", meta.Latency)
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	var got *http.Request
+	var gotBody map[string]any
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody = nil
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	other := httptest.NewServer(handler)
+	defer other.Close()
+
+	c := client.New("test-key", client.WithBaseURL(server.URL))
+
+	t.Run("headers and idempotency key", func(t *testing.T) {
+		resp, err := c.Request(context.Background(), http.MethodPost, "/test", map[string]string{"a": "b"},
+			client.WithHeader("X-Trace", "abc"),
+			client.WithIdempotencyKey("idem-1"),
+		)
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if got.Header.Get("X-Trace") != "abc" {
+			t.Errorf("X-Trace = %q, want %q", got.Header.Get("X-Trace"), "abc")
+		}
+		if got.Header.Get("Idempotency-Key") != "idem-1" {
+			t.Errorf("Idempotency-Key = %q, want %q", got.Header.Get("Idempotency-Key"), "idem-1")
+		}
+	})
+
+	t.Run("extra body", func(t *testing.T) {
+		resp, err := c.Request(context.Background(), http.MethodPost, "/test", map[string]string{"model": "m"},
+			client.WithExtraBody(map[string]any{"thinking": map[string]string{"type": "enabled"}}),
+		)
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if gotBody["model"] != "m" {
+			t.Errorf("body[model] = %v, want m", gotBody["model"])
+		}
+		if _, ok := gotBody["thinking"].(map[string]any); !ok {
+			t.Errorf("body[thinking] = %v, want object", gotBody["thinking"])
+		}
+	})
+
+	t.Run("extra body without request body", func(t *testing.T) {
+		resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil,
+			client.WithExtraBody(map[string]any{"thinking": true}),
+		)
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if got.ContentLength != 0 || gotBody != nil {
+			t.Errorf("GET body = %v (length %d), want none", gotBody, got.ContentLength)
+		}
+	})
+
+	t.Run("api key and base url", func(t *testing.T) {
+		resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil,
+			client.WithRequestAPIKey("other-key"),
+			client.WithRequestBaseURL(other.URL),
+		)
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if got.Header.Get("Authorization") != "Bearer other-key" {
+			t.Errorf("Authorization = %q, want %q", got.Header.Get("Authorization"), "Bearer other-key")
+		}
+		if "http://"+got.Host != other.URL {
+			t.Errorf("Host = %q, want %q", got.Host, other.URL)
+		}
+	})
+}
+
+func TestRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	c := client.New("test-key", client.WithBaseURL(server.URL))
+
+	_, err := c.Request(context.Background(), http.MethodGet, "/test", nil, client.WithRequestTimeout(20*time.Millisecond))
+	if err == nil {
+		t.Fatal("Request() error = nil, want timeout")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		body         string
+		wantStatus   int
+		wantAttempts int
+	}{
+		{
+			name:         "retries server errors",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after max retries",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests},
+			body:         `{"error":{"message":"slow down","type":"rate_limit_reached_error"}}`,
+			wantStatus:   http.StatusTooManyRequests,
+			wantAttempts: 3,
+		},
+		{
+			name:         "does not retry quota errors",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			body:         `{"error":{"message":"no money","type":"exceeded_current_quota_error"}}`,
+			wantStatus:   http.StatusTooManyRequests,
+			wantAttempts: 1,
+		},
+		{
+			name:         "does not retry client errors",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantStatus:   http.StatusBadRequest,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"a":"b"}` {
+					t.Errorf("attempt %d body = %q, want replayed body", attempts+1, body)
+				}
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(tt.statuses[attempts])
+				w.Write([]byte(tt.body))
+				attempts++
+			}))
+			defer server.Close()
+
+			c := client.New("test-key",
+				client.WithBaseURL(server.URL),
+				client.WithRetryPolicy(client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+			)
+
+			var meta client.ResponseMeta
+			resp, err := c.Request(context.Background(), http.MethodPost, "/test", map[string]string{"a": "b"}, client.WithResponseMeta(&meta))
+			if err != nil {
+				t.Fatalf("Request() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts || meta.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d (meta %d), want %d", attempts, meta.Attempts, tt.wantAttempts)
+			}
+			if tt.body != "" {
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.body {
+					t.Errorf("body = %q, want %q", body, tt.body)
+				}
+			}
+		})
+	}
+
+	t.Run("per-request policy overrides client", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		c := client.New("test-key", client.WithBaseURL(server.URL))
+		resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil,
+			client.WithRequestRetryPolicy(client.RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond}),
+		)
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if attempts != 2 {
+			t.Errorf("attempts = %d, want 2", attempts)
+		}
+	})
+
+	t.Run("transport errors after sending", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			method       string
+			opts         []client.RequestOption
+			wantAttempts int
+		}{
+			{name: "POST is not resent", method: http.MethodPost, wantAttempts: 1},
+			{name: "POST with idempotency key is resent", method: http.MethodPost, opts: []client.RequestOption{client.WithIdempotencyKey("idem-1")}, wantAttempts: 2},
+			{name: "GET is resent", method: http.MethodGet, wantAttempts: 2},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var attempts atomic.Int32
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if attempts.Add(1) == 1 {
+						// Drop the connection after the request was received
+						conn, _, _ := w.(http.Hijacker).Hijack()
+						conn.Close()
+						return
+					}
+					w.WriteHeader(http.StatusOK)
+				}))
+				defer server.Close()
+
+				c := client.New("test-key",
+					client.WithBaseURL(server.URL),
+					client.WithRetryPolicy(client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+				)
+				resp, err := c.Request(context.Background(), tt.method, "/test", map[string]string{"a": "b"}, tt.opts...)
+				if err == nil {
+					resp.Body.Close()
+				}
+				if int(attempts.Load()) != tt.wantAttempts {
+					t.Errorf("attempts = %d, want %d (err = %v)", attempts.Load(), tt.wantAttempts, err)
+				}
+				if (err != nil) != (tt.wantAttempts == 1) {
+					t.Errorf("Request() error = %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestWithMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var order []string
+	mw := func(name string) client.Middleware {
+		return func(next client.Handler) client.Handler {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+":"+req.Header.Get("X-Trace"))
+				return next(req)
+			}
+		}
+	}
+
+	c := client.New("test-key", client.WithBaseURL(server.URL), client.WithMiddleware(mw("outer"), mw("inner")))
+	resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil, client.WithHeader("X-Trace", "t1"))
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	resp.Body.Close()
+
+	want := []string{"outer:t1", "inner:t1"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("middleware order = %v, want %v", order, want)
+	}
+}
+
+func TestWithRequestCheck(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	checks := 0
+	stop := stderrors.New("stop")
+	c := client.New("test-key",
+		client.WithBaseURL(server.URL),
+		client.WithRetryPolicy(client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond}),
+		client.WithRequestCheck(func(req *http.Request) error {
+			checks++
+			if req.URL.Path == "/blocked" {
+				return stop
+			}
+			return nil
+		}),
+	)
+
+	if _, err := c.Request(context.Background(), http.MethodGet, "/blocked", nil); err != stop {
+		t.Errorf("Request(/blocked) error = %v, want %v", err, stop)
+	}
+	resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil)
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if checks != 2 || calls != 3 {
+		t.Errorf("checks = %d, calls = %d, want one check per request and 3 attempts", checks, calls)
+	}
+}
+
+func TestWithRateLimiter(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// A burst of 2 at 20 rps lets two requests through at once and spaces
+	// the next ones by 50ms
+	c := client.New("test-key", client.WithBaseURL(server.URL), client.WithRateLimiter(client.NewRateLimiter(20, 2)))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		resp, err := c.Request(context.Background(), http.MethodGet, "/test", nil)
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 requests took %v, want at least 100ms", elapsed)
+	}
+	if calls != 4 {
+		t.Errorf("calls = %d, want 4", calls)
+	}
+
+	t.Run("context cancelled while waiting", func(t *testing.T) {
+		limiter := client.NewRateLimiter(0.1, 1)
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		c := client.New("test-key", client.WithBaseURL(server.URL), client.WithRateLimiter(limiter))
+		if _, err := c.Request(ctx, http.MethodGet, "/test", nil); err == nil {
+			t.Error("Request() error = nil, want context error")
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Base URLs of the Moonshot API regions
+const (
+	GlobalBaseURL = "https://api.moonshot.ai/v1"
+	ChinaBaseURL  = "https://api.moonshot.cn/v1"
+)
+
+// Environment variables read by LoadConfig. MOONSHOT_API_KEY and
+// MOONSHOT_BASE_URL override the config file.
+const (
+	EnvBaseURL = "MOONSHOT_BASE_URL"
+	EnvProfile = "MOONSHOT_PROFILE"
+	EnvConfig  = "MOONSHOT_CONFIG"
+)
+
+// builtinProfiles are available without being defined in the config file.
+// A profile of the same name in the file is applied on top.
+var builtinProfiles = map[string]Config{
+	"global": {BaseURL: GlobalBaseURL},
+	"cn":     {BaseURL: ChinaBaseURL},
+}
+
+// Config holds client settings, usually read from a config file with
+// LoadConfig. Zero fields keep the client defaults.
+type Config struct {
+	// Profile is the name of the profile the settings were read from
+	Profile string `json:"-"`
+
+	APIKey       string   `json:"api_key,omitempty"`
+	BaseURL      string   `json:"base_url,omitempty"`
+	Timeout      Duration `json:"timeout,omitempty"`
+	DefaultModel string   `json:"default_model,omitempty"`
+	// Proxy is the URL of the HTTP proxy requests are sent through
+	Proxy      string `json:"proxy,omitempty"`
+	MaxRetries *int   `json:"max_retries,omitempty"`
+}
+
+// configFile is the layout of the config file: default settings, the
+// profile used when none is asked for, and named profiles
+type configFile struct {
+	Config
+	DefaultProfile string            `json:"profile,omitempty"`
+	Profiles       map[string]Config `json:"profiles,omitempty"`
+}
+
+// Duration is a time.Duration written in JSON as a string such as "30s"
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ConfigPath returns the path of the config file: $MOONSHOT_CONFIG, or
+// moonshot/config in $XDG_CONFIG_HOME (default ~/.config). It returns ""
+// if the home directory is unknown.
+func ConfigPath() string {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "moonshot", "config")
+}
+
+// LoadConfig reads the settings of profile from the config file at
+// ConfigPath and applies the environment on top. A missing config file is
+// not an error unless it was named by $MOONSHOT_CONFIG.
+//
+// If profile is empty, $MOONSHOT_PROFILE is used, then the file's
+// "profile" field; without any, only the file's top-level settings apply.
+// The config file is JSON:
+//
+//	{
+//	  "profile": "cn",
+//	  "timeout": "60s",
+//	  "profiles": {
+//	    "cn": {"api_key": "sk-..."},
+//	    "global": {"api_key": "sk-...", "default_model": "kimi-k2"}
+//	  }
+//	}
+//
+// The "global" and "cn" profiles exist without being defined and select
+// the api.moonshot.ai and api.moonshot.cn endpoints.
+func LoadConfig(profile string) (*Config, error) {
+	path := ConfigPath()
+	if path == "" {
+		return resolveConfig(&configFile{}, profile)
+	}
+	return loadConfig(path, profile, os.Getenv(EnvConfig) != "")
+}
+
+// LoadConfigFile is like LoadConfig but reads the config file at path,
+// which must exist
+func LoadConfigFile(path, profile string) (*Config, error) {
+	return loadConfig(path, profile, true)
+}
+
+func loadConfig(path, profile string, required bool) (*Config, error) {
+	file := &configFile{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(file); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case !required && errors.Is(err, fs.ErrNotExist):
+	default:
+		return nil, err
+	}
+	return resolveConfig(file, profile)
+}
+
+// resolveConfig merges the file's settings, the selected profile and the
+// environment, in that order
+func resolveConfig(file *configFile, profile string) (*Config, error) {
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = file.DefaultProfile
+	}
+
+	cfg := file.Config
+	if profile != "" {
+		builtin, isBuiltin := builtinProfiles[profile]
+		defined, isDefined := file.Profiles[profile]
+		if !isBuiltin && !isDefined {
+			return nil, fmt.Errorf("unknown profile %q", profile)
+		}
+		cfg.merge(builtin)
+		cfg.merge(defined)
+		cfg.Profile = profile
+	}
+	cfg.merge(Config{APIKey: os.Getenv(EnvAPIKey), BaseURL: os.Getenv(EnvBaseURL)})
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// merge overwrites c's settings with the ones set in o
+func (c *Config) merge(o Config) {
+	if o.APIKey != "" {
+		c.APIKey = o.APIKey
+	}
+	if o.BaseURL != "" {
+		c.BaseURL = o.BaseURL
+	}
+	if o.Timeout != 0 {
+		c.Timeout = o.Timeout
+	}
+	if o.DefaultModel != "" {
+		c.DefaultModel = o.DefaultModel
+	}
+	if o.Proxy != "" {
+		c.Proxy = o.Proxy
+	}
+	if o.MaxRetries != nil {
+		c.MaxRetries = o.MaxRetries
+	}
+}
+
+func (c *Config) validate() error {
+	if c.BaseURL != "" {
+		if err := checkURL(c.BaseURL); err != nil {
+			return fmt.Errorf("base url: %w", err)
+		}
+	}
+	if c.Proxy != "" {
+		if err := checkURL(c.Proxy); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if c.MaxRetries != nil && *c.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	return nil
+}
+
+// checkURL reports whether s is an absolute http or https URL
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", s)
+	}
+	return nil
+}
+
+// Options returns the client options that apply cfg
+func (c *Config) Options() ([]Option, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.APIKey != "" {
+		opts = append(opts, WithAPIKey(c.APIKey))
+	}
+	if c.BaseURL != "" {
+		opts = append(opts, WithBaseURL(c.BaseURL))
+	}
+	if c.Proxy != "" {
+		proxy, _ := url.Parse(c.Proxy)
+		opts = append(opts, func(cl *Client) {
+			cl.record("proxy", c.Proxy)
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(proxy)
+			cl.httpClient.Transport = transport
+		})
+	}
+	if c.Timeout != 0 {
+		opts = append(opts, WithTimeout(time.Duration(c.Timeout)))
+	}
+	if c.DefaultModel != "" {
+		opts = append(opts, WithDefaultModel(c.DefaultModel))
+	}
+	if c.MaxRetries != nil {
+		opts = append(opts, WithRetryPolicy(RetryPolicy{MaxRetries: *c.MaxRetries}))
+	}
+	return opts, nil
+}
+
+// NewFromConfig creates a client configured by cfg. opts are applied
+// after the configuration and take precedence over it. Like NewClient, it
+// returns a ConfigError if there is no API key or the base URL is invalid,
+// and if opts include WithHTTPClient while cfg sets a proxy or timeout,
+// which would otherwise be lost.
+//
+//	cfg, err := client.LoadConfig("cn")
+//	if err != nil { ... }
+//	c, err := client.NewFromConfig(cfg)
+func NewFromConfig(cfg *Config, opts ...Option) (*Client, error) {
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	c := newClient(append(cfgOpts, opts...))
+	if err := c.validate(false); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
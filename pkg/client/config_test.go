@@ -0,0 +1,252 @@
+package client_test
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+)
+
+const testConfig = `{
+  "profile": "cn",
+  "timeout": "45s",
+  "api_key": "sk-default",
+  "profiles": {
+    "cn": {"api_key": "sk-cn"},
+    "work": {"base_url": "https://llm.example.com/v1", "default_model": "kimi-k2", "max_retries": 3}
+  }
+}`
+
+// clearConfigEnv isolates a test from the config environment variables
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{client.EnvAPIKey, client.EnvBaseURL, client.EnvProfile, client.EnvConfig} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	tests := []struct {
+		name    string
+		profile string
+		env     map[string]string
+		want    client.Config
+		wantErr string
+	}{
+		{
+			name: "file default profile",
+			want: client.Config{Profile: "cn", APIKey: "sk-cn", BaseURL: client.ChinaBaseURL, Timeout: client.Duration(45 * time.Second)},
+		},
+		{
+			name:    "builtin profile",
+			profile: "global",
+			want:    client.Config{Profile: "global", APIKey: "sk-default", BaseURL: client.GlobalBaseURL, Timeout: client.Duration(45 * time.Second)},
+		},
+		{
+			name:    "file profile",
+			profile: "work",
+			want:    client.Config{Profile: "work", APIKey: "sk-default", BaseURL: "https://llm.example.com/v1", Timeout: client.Duration(45 * time.Second), DefaultModel: "kimi-k2"},
+		},
+		{
+			name: "profile from environment",
+			env:  map[string]string{client.EnvProfile: "global"},
+			want: client.Config{Profile: "global", APIKey: "sk-default", BaseURL: client.GlobalBaseURL, Timeout: client.Duration(45 * time.Second)},
+		},
+		{
+			name: "environment overrides",
+			env:  map[string]string{client.EnvAPIKey: "sk-env", client.EnvBaseURL: "http://localhost:9999/v1"},
+			want: client.Config{Profile: "cn", APIKey: "sk-env", BaseURL: "http://localhost:9999/v1", Timeout: client.Duration(45 * time.Second)},
+		},
+		{
+			name:    "unknown profile",
+			profile: "nope",
+			wantErr: `unknown profile "nope"`,
+		},
+		{
+			name:    "invalid base url from environment",
+			env:     map[string]string{client.EnvBaseURL: "api.moonshot.cn"},
+			wantErr: "base url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := client.LoadConfigFile(path, tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			retries := cfg.MaxRetries
+			cfg.MaxRetries = nil
+			if *cfg != tt.want {
+				t.Errorf("config = %+v, want %+v", *cfg, tt.want)
+			}
+			if tt.profile == "work" && (retries == nil || *retries != 3) {
+				t.Errorf("max retries = %v, want 3", retries)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"not json", `api_key: sk`, "parsing"},
+		{"unknown field", `{"apikey": "sk"}`, "unknown field"},
+		{"bad duration", `{"timeout": 30}`, "duration"},
+		{"bad proxy", `{"proxy": "localhost:3128"}`, "proxy"},
+		{"negative retries", `{"max_retries": -1}`, "max_retries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			_, err := client.LoadConfigFile(writeConfig(t, tt.content), "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		clearConfigEnv(t)
+		t.Setenv(client.EnvAPIKey, "sk-env")
+		cfg, err := client.LoadConfig("cn")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.APIKey != "sk-env" || cfg.BaseURL != client.ChinaBaseURL {
+			t.Errorf("config = %+v", *cfg)
+		}
+	})
+
+	t.Run("default path", func(t *testing.T) {
+		clearConfigEnv(t)
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		os.MkdirAll(filepath.Join(dir, "moonshot"), 0o700)
+		os.WriteFile(filepath.Join(dir, "moonshot", "config"), []byte(testConfig), 0o600)
+		if got := client.ConfigPath(); got != filepath.Join(dir, "moonshot", "config") {
+			t.Errorf("ConfigPath() = %q", got)
+		}
+		cfg, err := client.LoadConfig("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.APIKey != "sk-cn" {
+			t.Errorf("api key = %q, want sk-cn", cfg.APIKey)
+		}
+	})
+
+	t.Run("missing file named by environment", func(t *testing.T) {
+		clearConfigEnv(t)
+		t.Setenv(client.EnvConfig, filepath.Join(t.TempDir(), "missing"))
+		if _, err := client.LoadConfig(""); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestNewFromConfig(t *testing.T) {
+	var gotAuth, gotURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotURL = r.Header.Get("Authorization"), r.URL.String()
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	t.Run("base url", func(t *testing.T) {
+		c, err := client.NewFromConfig(&client.Config{APIKey: "sk-cfg", BaseURL: server.URL + "/v1", DefaultModel: "kimi-k2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.DefaultModel() != "kimi-k2" {
+			t.Errorf("DefaultModel() = %q", c.DefaultModel())
+		}
+		resp, err := c.Request(context.Background(), http.MethodGet, "/models", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if gotAuth != "Bearer sk-cfg" || gotURL != "/v1/models" {
+			t.Errorf("auth = %q, url = %q", gotAuth, gotURL)
+		}
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		c, err := client.NewFromConfig(&client.Config{APIKey: "sk-cfg", BaseURL: "http://api.example.invalid/v1", Proxy: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Request(context.Background(), http.MethodGet, "/models", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if gotURL != "http://api.example.invalid/v1/models" {
+			t.Errorf("proxy saw url %q", gotURL)
+		}
+	})
+
+	t.Run("http client conflicts", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			cfg     client.Config
+			setting string
+		}{
+			{name: "proxy", cfg: client.Config{APIKey: "sk-cfg", Proxy: server.URL}, setting: "proxy"},
+			{name: "timeout", cfg: client.Config{APIKey: "sk-cfg", Timeout: client.Duration(time.Second)}, setting: "WithTimeout"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := client.NewFromConfig(&tt.cfg, client.WithHTTPClient(&http.Client{}))
+				var configErr errors.ConfigError
+				if !stderrors.As(err, &configErr) || configErr.Setting != tt.setting {
+					t.Errorf("NewFromConfig() error = %v, want a ConfigError for %s", err, tt.setting)
+				}
+			})
+		}
+
+		if _, err := client.NewFromConfig(&client.Config{APIKey: "sk-cfg"}, client.WithHTTPClient(&http.Client{})); err != nil {
+			t.Errorf("NewFromConfig() without proxy or timeout: error = %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := client.NewFromConfig(&client.Config{BaseURL: "://nope"}); err == nil {
+			t.Error("expected an error for a malformed base url")
+		}
+	})
+}
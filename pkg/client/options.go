@@ -0,0 +1,139 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+)
+
+// ResponseMeta holds details of the HTTP response behind an API call
+type ResponseMeta struct {
+	StatusCode int
+	Header     http.Header
+	RequestID  string
+	RateLimit  errors.RateLimit
+	// Latency is the time from sending the final attempt until the response
+	// headers arrived. For streaming calls this is the time to first byte.
+	Latency time.Duration
+	// Attempts is the number of requests sent, including retries
+	Attempts int
+}
+
+// RequestOption configures a single API call. Request options override the
+// client's configuration for that call and are applied before middleware.
+type RequestOption func(*requestConfig)
+
+// requestConfig collects the settings applied by RequestOptions
+type requestConfig struct {
+	header         http.Header
+	extraBody      map[string]any
+	timeout        time.Duration
+	idempotencyKey string
+	baseURL        string
+	apiKey         string
+	retry          *RetryPolicy
+	meta           *ResponseMeta
+}
+
+func newRequestConfig(opts []RequestOption) *requestConfig {
+	cfg := &requestConfig{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	return cfg
+}
+
+// AltersRequest reports whether opts change where a request is sent, the
+// API key it is sent with or its body, so that its response may differ from
+// that of the same call without them
+func AltersRequest(opts ...RequestOption) bool {
+	cfg := newRequestConfig(opts)
+	return cfg.baseURL != "" || cfg.apiKey != "" || len(cfg.extraBody) > 0
+}
+
+// CombineRequestOptions returns a request option that applies opts in order
+func CombineRequestOptions(opts ...RequestOption) RequestOption {
+	return func(cfg *requestConfig) {
+		for _, opt := range opts {
+			if opt != nil {
+				opt(cfg)
+			}
+		}
+	}
+}
+
+// WithResponseMeta fills meta with the response status, headers, request ID,
+// rate-limit state and latency once the call has received a response
+func WithResponseMeta(meta *ResponseMeta) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.meta = meta
+	}
+}
+
+// WithHeader sets an extra HTTP header on the request, replacing any value
+// set by the client
+func WithHeader(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		if cfg.header == nil {
+			cfg.header = http.Header{}
+		}
+		cfg.header.Set(key, value)
+	}
+}
+
+// WithExtraBody merges fields into the top-level JSON request body. It is
+// intended for API parameters the SDK does not model yet; fields given here
+// override fields of the same name set by the SDK. Requests without a body,
+// such as GET requests, are sent unchanged.
+func WithExtraBody(fields map[string]any) RequestOption {
+	return func(cfg *requestConfig) {
+		if cfg.extraBody == nil {
+			cfg.extraBody = make(map[string]any, len(fields))
+		}
+		for key, value := range fields {
+			cfg.extraBody[key] = value
+		}
+	}
+}
+
+// WithRequestTimeout bounds the whole call, including retries and reading a
+// streamed response, by timeout
+func WithRequestTimeout(timeout time.Duration) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithIdempotencyKey sets the Idempotency-Key header so that retried
+// requests can be recognised as duplicates
+func WithIdempotencyKey(key string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.idempotencyKey = key
+	}
+}
+
+// WithRequestBaseURL sends the request to baseURL instead of the client's
+// base URL
+func WithRequestBaseURL(baseURL string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.baseURL = baseURL
+	}
+}
+
+// WithRequestAPIKey authenticates the request with apiKey instead of the
+// client's API key
+func WithRequestAPIKey(apiKey string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.apiKey = apiKey
+	}
+}
+
+// WithRequestRetryPolicy overrides the client's retry policy for the request
+func WithRequestRetryPolicy(policy RetryPolicy) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.retry = &policy
+	}
+}
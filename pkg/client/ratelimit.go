@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces requests. Wait blocks until a request may be sent or
+// ctx is done.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// WithRateLimiter makes the client wait on limiter before every attempt,
+// including retries. Share one limiter between clients to keep them under a
+// common account limit.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// NewRateLimiter returns a token bucket limiter allowing rps requests per
+// second on average with bursts of up to burst requests. A non-positive
+// rps disables limiting.
+func NewRateLimiter(rps float64, burst int) RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// tokenBucket is a RateLimiter refilled continuously at rate tokens per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Wait implements RateLimiter
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return ctx.Err()
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+)
+
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 8 * time.Second
+)
+
+// RetryPolicy controls how failed requests are retried. The zero value
+// disables retries.
+//
+// Responses are retried when errors.APIError.Retryable reports true.
+// Transport errors are retried unless the request context is done, but
+// only if the request never reached the server or is safe to repeat: a
+// GET, HEAD, OPTIONS, PUT or DELETE, or one sent with WithIdempotencyKey.
+// A chat completion whose connection broke after it was sent is not
+// retried, as it may have been processed and billed. A Retry-After header
+// from the server takes precedence over the computed backoff.
+type RetryPolicy struct {
+	// MaxRetries is the number of additional attempts after the first
+	MaxRetries int
+	// MinBackoff is the delay before the first retry (default 500ms)
+	MinBackoff time.Duration
+	// MaxBackoff caps the exponential backoff (default 8s)
+	MaxBackoff time.Duration
+}
+
+// shouldRetry reports whether another attempt should be made after the
+// given attempt produced resp or err, and how long to wait before it.
+// replayable reports whether a request that failed with err may be sent
+// again.
+func (p RetryPolicy) shouldRetry(ctx context.Context, attempt int, resp *http.Response, err error, replayable bool) (time.Duration, bool) {
+	if attempt > p.MaxRetries || ctx.Err() != nil {
+		return 0, false
+	}
+	if err != nil && !replayable {
+		return 0, false
+	}
+
+	var retryAfter time.Duration
+	if err == nil {
+		if resp.StatusCode < http.StatusBadRequest {
+			return 0, false
+		}
+		apiErr, ok := errors.IsAPIError(peekError(resp))
+		if !ok || !apiErr.Retryable() {
+			return 0, false
+		}
+		retryAfter = apiErr.RetryAfter
+	}
+
+	wait := p.backoff(attempt)
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+	return wait, true
+}
+
+// backoff returns the jittered exponential delay before the given retry
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	d := minBackoff << (attempt - 1)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	// Equal jitter: half fixed, half random
+	return d/2 + rand.N(d/2+1)
+}
+
+// peekError decodes the error in resp without consuming its body, which is
+// replaced by a buffered copy
+func peekError(resp *http.Response) error {
+	data, readErr := io.ReadAll(io.LimitReader(resp.Body, errors.MaxRawBodySize))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+
+	peek := *resp
+	peek.Body = io.NopCloser(bytes.NewReader(data))
+	if readErr != nil {
+		return readErr
+	}
+	return errors.HandleErrorResponse(&peek)
+}
+
+// traceWritten returns a copy of req that sets *written once the request
+// has been fully sent to the server
+func traceWritten(req *http.Request, written *bool) *http.Request {
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				*written = true
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// isIdempotent reports whether req can be repeated without side effects
+// beyond those of sending it once
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// rewindRequest returns a copy of req with a fresh body for another attempt
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("retrying request: body cannot be replayed")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("retrying request: %w", err)
+	}
+	clone.Body = body
+	return clone, nil
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
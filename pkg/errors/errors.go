@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
+// MaxRawBodySize caps how much of an error response body is read and kept
+// on APIError.RawBody.
+const MaxRawBodySize = 16 << 10
+
 // Error represents a general error
 type Error struct {
 	Message string
@@ -23,11 +28,68 @@ type APIError struct {
 	Message    string `json:"message"`
 	Type       string `json:"type"`
 	StatusCode int    `json:"-"`
+
+	// The fields below are taken from the HTTP exchange rather than the
+	// error body, so they are available when reporting issues upstream.
+	RequestID  string        `json:"-"`
+	RateLimit  RateLimit     `json:"-"`
+	RetryAfter time.Duration `json:"-"`
+	RawBody    string        `json:"-"`
+	Method     string        `json:"-"`
+	Path       string        `json:"-"`
 }
 
 // Error implements the error interface
 func (e APIError) Error() string {
-	return fmt.Sprintf("moonshot api error (status %d): %s - %s", e.StatusCode, e.Code, e.Message)
+	msg := fmt.Sprintf("moonshot api error (status %d): %s - %s", e.StatusCode, e.Code, e.Message)
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request id: %s)", e.RequestID)
+	}
+	return msg
+}
+
+// Retryable reports whether the request that produced the error may succeed
+// if sent again. Rate limits, timeouts and transient server failures are
+// retryable; an exhausted account quota is not.
+func (e APIError) Retryable() bool {
+	if e.Type == ErrTypeQuotaExceeded {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// BalanceError is returned by a client with a balance guard when the
+// available account balance is below the configured threshold
+type BalanceError struct {
+	Available float64
+	Threshold float64
+}
+
+// Error implements the error interface
+func (e BalanceError) Error() string {
+	return fmt.Sprintf("moonshot account balance %.2f is below threshold %.2f", e.Available, e.Threshold)
+}
+
+// ConfigError is returned by client.NewClient for an invalid client
+// configuration. Setting names what is wrong, such as "api_key" or
+// "base_url"; several problems are reported together with errors.Join.
+type ConfigError struct {
+	Setting string
+	Message string
+}
+
+// Error implements the error interface
+func (e ConfigError) Error() string {
+	return "moonshot client: " + e.Message
 }
 
 // ErrorResponse represents the structure of an error response from the API
@@ -40,34 +102,51 @@ func HandleErrorResponse(resp *http.Response) error {
 	defer resp.Body.Close()
 	
 	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxRawBodySize))
 	if err != nil {
-		return APIError{
-			Code:       "read_error",
-			Message:    fmt.Sprintf("failed to read error response: %v", err),
-			Type:       "client_error",
-			StatusCode: resp.StatusCode,
+		apiErr := APIError{
+			Code:    "read_error",
+			Message: fmt.Sprintf("failed to read error response: %v", err),
+			Type:    "client_error",
 		}
+		fillResponseDetails(&apiErr, resp, body)
+		return apiErr
 	}
 	
 	// Try to parse as standard error response
 	var errResp ErrorResponse
 	if err := json.Unmarshal(body, &errResp); err != nil {
 		// If parsing fails, return a generic error with the body content
-		return APIError{
-			Code:       "parse_error",
-			Message:    string(body),
-			Type:       "client_error",
-			StatusCode: resp.StatusCode,
+		apiErr := APIError{
+			Code:    "parse_error",
+			Message: string(body),
+			Type:    "client_error",
 		}
+		fillResponseDetails(&apiErr, resp, body)
+		return apiErr
 	}
 	
-	// Set the status code
-	errResp.Error.StatusCode = resp.StatusCode
+	fillResponseDetails(&errResp.Error, resp, body)
 	
 	return errResp.Error
 }
 
+// fillResponseDetails copies status, headers and request details from resp
+// onto e.
+func fillResponseDetails(e *APIError, resp *http.Response, body []byte) {
+	e.StatusCode = resp.StatusCode
+	e.RawBody = string(body)
+	e.RequestID = RequestIDFromHeader(resp.Header)
+	e.RateLimit = ParseRateLimit(resp.Header)
+	e.RetryAfter = ParseRetryAfter(resp.Header)
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		if resp.Request.URL != nil {
+			e.Path = resp.Request.URL.Path
+		}
+	}
+}
+
 // IsAPIError checks if an error is an APIError
 func IsAPIError(err error) (*APIError, bool) {
 	apiErr, ok := err.(APIError)
@@ -77,6 +156,15 @@ func IsAPIError(err error) (*APIError, bool) {
 	return nil, false
 }
 
+// IsBalanceError checks if an error is a BalanceError
+func IsBalanceError(err error) (*BalanceError, bool) {
+	balanceErr, ok := err.(BalanceError)
+	if ok {
+		return &balanceErr, true
+	}
+	return nil, false
+}
+
 // Common error codes from Moonshot API
 const (
 	ErrCodeInvalidRequest     = "invalid_request"
@@ -86,4 +174,11 @@ const (
 	ErrCodeRateLimitExceeded = "rate_limit_exceeded"
 	ErrCodeServerError       = "server_error"
 	ErrCodeTimeout           = "timeout"
+)
+
+// Error types reported by the Moonshot API in the "type" field
+const (
+	ErrTypeQuotaExceeded = "exceeded_current_quota_error"
+	ErrTypeRateLimit     = "rate_limit_reached_error"
+	ErrTypeOverloaded    = "engine_overloaded_error"
 )
\ No newline at end of file
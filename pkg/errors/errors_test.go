@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rizome-dev/go-moonshot/pkg/errors"
 )
@@ -234,4 +236,138 @@ func TestErrorConstants(t *testing.T) {
 			t.Errorf("Error constant %d = %v, want %v", i, constant, expectedValues[i])
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestHandleErrorResponse_ResponseDetails(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.moonshot.ai/v1/chat/completions", nil)
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header: http.Header{
+			"Msh-Request-Id":                 []string{"req-abc"},
+			"Retry-After":                    []string{"3"},
+			"X-Ratelimit-Limit-Requests":     []string{"200"},
+			"X-Ratelimit-Remaining-Requests": []string{"0"},
+			"X-Ratelimit-Reset-Requests":     []string{"1.5s"},
+			"X-Ratelimit-Remaining-Tokens":   []string{"1200"},
+		},
+		Body:    io.NopCloser(bytes.NewBufferString(`{"error": {"message": "slow down", "type": "rate_limit_reached_error"}}`)),
+		Request: req,
+	}
+
+	err := errors.HandleErrorResponse(resp)
+	apiErr, ok := errors.IsAPIError(err)
+	if !ok {
+		t.Fatalf("HandleErrorResponse() returned non-APIError type: %T", err)
+	}
+
+	if apiErr.RequestID != "req-abc" {
+		t.Errorf("RequestID = %q, want %q", apiErr.RequestID, "req-abc")
+	}
+	if apiErr.RetryAfter != 3*time.Second {
+		t.Errorf("RetryAfter = %v, want 3s", apiErr.RetryAfter)
+	}
+	if !apiErr.RateLimit.Present || apiErr.RateLimit.LimitRequests != 200 || apiErr.RateLimit.RemainingRequests != 0 {
+		t.Errorf("RateLimit requests = %d/%d, want 0/200", apiErr.RateLimit.RemainingRequests, apiErr.RateLimit.LimitRequests)
+	}
+	if apiErr.RateLimit.ResetRequests != 1500*time.Millisecond {
+		t.Errorf("RateLimit.ResetRequests = %v, want 1.5s", apiErr.RateLimit.ResetRequests)
+	}
+	if apiErr.RateLimit.RemainingTokens != 1200 {
+		t.Errorf("RateLimit.RemainingTokens = %d, want 1200", apiErr.RateLimit.RemainingTokens)
+	}
+	if apiErr.Method != http.MethodPost || apiErr.Path != "/v1/chat/completions" {
+		t.Errorf("Method/Path = %s %s, want POST /v1/chat/completions", apiErr.Method, apiErr.Path)
+	}
+	if !strings.Contains(apiErr.RawBody, "slow down") {
+		t.Errorf("RawBody = %q, want it to contain the response body", apiErr.RawBody)
+	}
+	if !strings.Contains(apiErr.Error(), "req-abc") {
+		t.Errorf("Error() = %q, want it to mention the request id", apiErr.Error())
+	}
+}
+
+func TestHandleErrorResponse_RawBodyCapped(t *testing.T) {
+	body := strings.Repeat("x", errors.MaxRawBodySize*2)
+	resp := &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+
+	apiErr, _ := errors.IsAPIError(errors.HandleErrorResponse(resp))
+	if len(apiErr.RawBody) != errors.MaxRawBodySize {
+		t.Errorf("len(RawBody) = %d, want %d", len(apiErr.RawBody), errors.MaxRawBodySize)
+	}
+}
+
+func TestAPIError_Retryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  errors.APIError
+		want bool
+	}{
+		{name: "bad request", err: errors.APIError{StatusCode: 400}, want: false},
+		{name: "unauthorized", err: errors.APIError{StatusCode: 401}, want: false},
+		{name: "rate limited", err: errors.APIError{StatusCode: 429, Type: errors.ErrTypeRateLimit}, want: true},
+		{name: "quota exceeded", err: errors.APIError{StatusCode: 429, Type: errors.ErrTypeQuotaExceeded}, want: false},
+		{name: "server error", err: errors.APIError{StatusCode: 500}, want: true},
+		{name: "bad gateway", err: errors.APIError{StatusCode: 502}, want: true},
+		{name: "unavailable", err: errors.APIError{StatusCode: 503}, want: true},
+		{name: "not implemented", err: errors.APIError{StatusCode: 501}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Retryable(); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "absent", value: "", want: 0},
+		{name: "seconds", value: "20", want: 20 * time.Second},
+		{name: "invalid", value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.value != "" {
+				h.Set("Retry-After", tt.value)
+			}
+			if got := errors.ParseRetryAfter(h); got != tt.want {
+				t.Errorf("ParseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("http date", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		if got := errors.ParseRetryAfter(h); got <= 0 || got > time.Minute {
+			t.Errorf("ParseRetryAfter() = %v, want within (0, 1m]", got)
+		}
+	})
+}
+
+func TestParseRateLimit_Present(t *testing.T) {
+	if rl := errors.ParseRateLimit(http.Header{}); rl.Present || !rl.IsZero() {
+		t.Errorf("ParseRateLimit(no headers) = %+v, want not present", rl)
+	}
+
+	h := http.Header{}
+	h.Set("x-ratelimit-remaining-requests", "0")
+	rl := errors.ParseRateLimit(h)
+	if !rl.Present || rl.IsZero() {
+		t.Errorf("ParseRateLimit(exhausted) = %+v, want present", rl)
+	}
+	if rl.RemainingRequests != 0 {
+		t.Errorf("RemainingRequests = %d, want 0", rl.RemainingRequests)
+	}
+}
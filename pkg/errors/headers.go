@@ -0,0 +1,107 @@
+package errors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Response headers carrying request identifiers, checked in order.
+var requestIDHeaders = []string{
+	"Msh-Request-Id",
+	"X-Request-Id",
+	"Request-Id",
+}
+
+// RateLimit holds the rate-limit state reported in response headers.
+// Present reports whether any x-ratelimit-* header was sent, so that an
+// exhausted limit (RemainingRequests == 0) can be told from a response
+// without rate-limit headers. Fields of absent headers are zero.
+type RateLimit struct {
+	Present           bool
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration
+}
+
+// IsZero reports whether no rate-limit headers were present
+func (r RateLimit) IsZero() bool {
+	return !r.Present
+}
+
+// RequestIDFromHeader returns the request ID assigned by the API, if any
+func RequestIDFromHeader(h http.Header) string {
+	for _, name := range requestIDHeaders {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ParseRateLimit extracts the x-ratelimit-* headers from h
+func ParseRateLimit(h http.Header) RateLimit {
+	present := false
+	for name := range h {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Ratelimit-") {
+			present = true
+			break
+		}
+	}
+	return RateLimit{
+		Present:           present,
+		LimitRequests:     headerInt(h, "X-Ratelimit-Limit-Requests"),
+		RemainingRequests: headerInt(h, "X-Ratelimit-Remaining-Requests"),
+		ResetRequests:     headerDuration(h, "X-Ratelimit-Reset-Requests"),
+		LimitTokens:       headerInt(h, "X-Ratelimit-Limit-Tokens"),
+		RemainingTokens:   headerInt(h, "X-Ratelimit-Remaining-Tokens"),
+		ResetTokens:       headerDuration(h, "X-Ratelimit-Reset-Tokens"),
+	}
+}
+
+// ParseRetryAfter returns the delay requested by the Retry-After header,
+// which may be given in seconds or as an HTTP date. It returns 0 when the
+// header is absent or invalid.
+func ParseRetryAfter(h http.Header) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func headerInt(h http.Header, name string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(h.Get(name)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// headerDuration parses reset headers, which are sent either as Go-style
+// durations ("1s", "6m0s") or as a number of seconds.
+func headerDuration(h http.Header, name string) time.Duration {
+	v := strings.TrimSpace(h.Get(name))
+	if v == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return 0
+}
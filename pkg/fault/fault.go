@@ -0,0 +1,329 @@
+// Package fault provides an http.RoundTripper that injects the failures seen
+// in production (connection resets, truncated streams, latency spikes and
+// error statuses) for testing retry and fallback logic.
+//
+// Plug it into the SDK with client.WithHTTPClient(t.Client()).
+package fault
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// kind is what a Fault does to a request
+type kind int
+
+const (
+	kindStatus kind = iota
+	kindLatency
+	kindConnReset
+	kindConnResetAfterWrite
+	kindResetBody
+	kindTruncateBody
+)
+
+// Fault is a failure to inject. Create one with the functions below.
+type Fault struct {
+	kind       kind
+	status     int
+	errType    string
+	retryAfter time.Duration
+	latency    time.Duration
+	after      int
+}
+
+// Status answers with an API error of the given HTTP status without
+// reaching the server
+func Status(code int) Fault {
+	return Fault{kind: kindStatus, status: code, errType: "server_error"}
+}
+
+// RateLimit answers with 429 and, if positive, a Retry-After header
+func RateLimit(retryAfter time.Duration) Fault {
+	return Fault{kind: kindStatus, status: http.StatusTooManyRequests, errType: "rate_limit_reached_error", retryAfter: retryAfter}
+}
+
+// BadGateway answers with 502
+func BadGateway() Fault {
+	return Status(http.StatusBadGateway)
+}
+
+// Latency delays the request by d before sending it on
+func Latency(d time.Duration) Fault {
+	return Fault{kind: kindLatency, latency: d}
+}
+
+// ConnReset fails the request with a connection reset before it is sent,
+// so the server never sees it
+func ConnReset() Fault {
+	return Fault{kind: kindConnReset}
+}
+
+// ConnResetAfterWrite sends the request to the server, then fails it with a
+// connection reset instead of returning the response, as when a connection
+// drops while the server is answering. Clients cannot tell whether such a
+// request was processed.
+func ConnResetAfterWrite() Fault {
+	return Fault{kind: kindConnResetAfterWrite}
+}
+
+// ResetAfter lets n bytes of the response body through, then fails reading
+// it with a connection reset, as when a stream is cut mid-way
+func ResetAfter(n int) Fault {
+	return Fault{kind: kindResetBody, after: n}
+}
+
+// TruncateAfter ends the response body cleanly after n bytes, as when a
+// proxy drops the rest of a stream
+func TruncateAfter(n int) Fault {
+	return Fault{kind: kindTruncateBody, after: n}
+}
+
+// String describes the fault
+func (f Fault) String() string {
+	switch f.kind {
+	case kindStatus:
+		return fmt.Sprintf("status %d", f.status)
+	case kindLatency:
+		return fmt.Sprintf("latency %v", f.latency)
+	case kindConnReset:
+		return "connection reset"
+	case kindConnResetAfterWrite:
+		return "connection reset after write"
+	case kindResetBody:
+		return fmt.Sprintf("connection reset after %d bytes", f.after)
+	default:
+		return fmt.Sprintf("truncated after %d bytes", f.after)
+	}
+}
+
+// Rule decides which requests a fault is injected into. Among the matching
+// requests, a rule fires on the Nth, on every Every-th, or at random with
+// Probability; with none of them set it fires on every matching request.
+type Rule struct {
+	// Method limits the rule to one HTTP method
+	Method string
+	// Path limits the rule to requests whose URL path contains Path, such
+	// as "/chat/completions"
+	Path string
+
+	// Nth fires on the nth matching request, counting from 1
+	Nth int
+	// Every fires on every Every-th matching request
+	Every int
+	// Probability fires at random with this probability, from 0 to 1
+	Probability float64
+
+	// Times caps how often the rule fires; zero means no limit
+	Times int
+
+	Fault Fault
+}
+
+// Transport is an http.RoundTripper injecting faults into requests sent
+// through Base
+type Transport struct {
+	base  http.RoundTripper
+	rules []*ruleState
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	injected int
+}
+
+type ruleState struct {
+	Rule
+	matched int
+	fired   int
+}
+
+// Option is a function that configures a Transport
+type Option func(*Transport)
+
+// WithBase sets the transport requests are sent through. The default is
+// http.DefaultTransport.
+func WithBase(rt http.RoundTripper) Option {
+	return func(t *Transport) {
+		t.base = rt
+	}
+}
+
+// WithSeed seeds the random source of probabilistic rules, making a run
+// reproducible
+func WithSeed(seed uint64) Option {
+	return func(t *Transport) {
+		t.rand = rand.New(rand.NewPCG(seed, seed))
+	}
+}
+
+// New creates a Transport applying rules in order; the first rule that
+// fires for a request decides its fault
+func New(rules []Rule, opts ...Option) *Transport {
+	t := &Transport{
+		base: http.DefaultTransport,
+		rand: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+	for _, r := range rules {
+		t.rules = append(t.rules, &ruleState{Rule: r})
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Client returns an HTTP client using the Transport
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// Injected returns how many faults have been injected so far
+func (t *Transport) Injected() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.injected
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f, ok := t.pick(req)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	switch f.kind {
+	case kindStatus:
+		closeBody(req)
+		return statusResponse(req, f), nil
+
+	case kindLatency:
+		select {
+		case <-time.After(f.latency):
+		case <-req.Context().Done():
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+		return t.base.RoundTrip(req)
+
+	case kindConnReset:
+		closeBody(req)
+		return nil, connReset("write")
+
+	case kindConnResetAfterWrite:
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return nil, connReset("read")
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &cutBody{ReadCloser: resp.Body, remaining: f.after, reset: f.kind == kindResetBody}
+	resp.ContentLength = -1
+	return resp, nil
+}
+
+// pick returns the fault for req, if a rule fires
+func (t *Transport) pick(req *http.Request) (Fault, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, r := range t.rules {
+		if r.Method != "" && r.Method != req.Method {
+			continue
+		}
+		if !strings.Contains(req.URL.Path, r.Path) {
+			continue
+		}
+		r.matched++
+		if r.Times > 0 && r.fired >= r.Times {
+			continue
+		}
+
+		var fire bool
+		switch {
+		case r.Nth > 0:
+			fire = r.matched == r.Nth
+		case r.Every > 0:
+			fire = r.matched%r.Every == 0
+		case r.Probability > 0:
+			fire = t.rand.Float64() < r.Probability
+		default:
+			fire = true
+		}
+		if fire {
+			r.fired++
+			t.injected++
+			return r.Fault, true
+		}
+	}
+	return Fault{}, false
+}
+
+// statusResponse builds the API error response for a status fault
+func statusResponse(req *http.Request, f Fault) *http.Response {
+	body := fmt.Sprintf(`{"error":{"type":%q,"message":"injected fault: %s"}}`, f.errType, http.StatusText(f.status))
+	header := http.Header{"Content-Type": {"application/json"}}
+	if f.retryAfter > 0 {
+		header.Set("Retry-After", fmt.Sprint(int(math.Ceil(f.retryAfter.Seconds()))))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.status, http.StatusText(f.status)),
+		StatusCode:    f.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// connReset returns the error a reset TCP connection produces
+func connReset(op string) error {
+	return &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, syscall.ECONNRESET)}
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// cutBody ends a response body after a number of bytes, either cleanly or
+// with a connection reset
+type cutBody struct {
+	io.ReadCloser
+	remaining int
+	reset     bool
+}
+
+func (b *cutBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		if b.reset {
+			return 0, connReset("read")
+		}
+		return 0, io.EOF
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= n
+	return n, err
+}
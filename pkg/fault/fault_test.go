@@ -0,0 +1,207 @@
+package fault_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/fault"
+)
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "0123456789")
+	}))
+}
+
+// statuses sends n GET requests to path and returns the status of each,
+// or 0 for transport errors
+func statuses(t *testing.T, c *http.Client, url string, n int) []int {
+	t.Helper()
+	var got []int
+	for i := 0; i < n; i++ {
+		resp, err := c.Get(url)
+		if err != nil {
+			got = append(got, 0)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		got = append(got, resp.StatusCode)
+	}
+	return got
+}
+
+func TestRules(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		rules []fault.Rule
+		path  string
+		want  []int
+	}{
+		{
+			name:  "nth request",
+			rules: []fault.Rule{{Nth: 2, Fault: fault.BadGateway()}},
+			path:  "/chat/completions",
+			want:  []int{200, 502, 200, 200},
+		},
+		{
+			name:  "every request",
+			rules: []fault.Rule{{Every: 2, Fault: fault.Status(500)}},
+			path:  "/chat/completions",
+			want:  []int{200, 500, 200, 500},
+		},
+		{
+			name:  "times",
+			rules: []fault.Rule{{Times: 3, Fault: fault.RateLimit(0)}},
+			path:  "/chat/completions",
+			want:  []int{429, 429, 429, 200},
+		},
+		{
+			name:  "other path unaffected",
+			rules: []fault.Rule{{Path: "/files", Fault: fault.BadGateway()}},
+			path:  "/chat/completions",
+			want:  []int{200, 200},
+		},
+		{
+			name:  "other method unaffected",
+			rules: []fault.Rule{{Method: http.MethodPost, Fault: fault.BadGateway()}},
+			path:  "/files",
+			want:  []int{200, 200},
+		},
+		{
+			name: "first firing rule wins",
+			rules: []fault.Rule{
+				{Nth: 1, Fault: fault.Status(500)},
+				{Fault: fault.ConnReset()},
+			},
+			path: "/files",
+			want: []int{500, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := fault.New(tt.rules)
+			got := statuses(t, tr.Client(), server.URL+tt.path, len(tt.want))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("statuses = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestProbability(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	run := func(seed uint64) []int {
+		tr := fault.New([]fault.Rule{{Probability: 0.5, Fault: fault.BadGateway()}}, fault.WithSeed(seed))
+		got := statuses(t, tr.Client(), server.URL, 40)
+		if n := tr.Injected(); n < 5 || n > 35 {
+			t.Errorf("Injected() = %d of 40 at probability 0.5", n)
+		}
+		return got
+	}
+
+	a, b := run(7), run(7)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed gave %v and %v", a, b)
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	t.Run("rate limit retry after", func(t *testing.T) {
+		tr := fault.New([]fault.Rule{{Fault: fault.RateLimit(1500 * time.Millisecond)}})
+		resp, err := tr.Client().Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 429 || resp.Header.Get("Retry-After") != "2" {
+			t.Errorf("status = %d, Retry-After = %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		tr := fault.New([]fault.Rule{{Fault: fault.Latency(30 * time.Millisecond)}})
+		start := time.Now()
+		if got := statuses(t, tr.Client(), server.URL, 1); got[0] != 200 {
+			t.Errorf("status = %d, want 200", got[0])
+		}
+		if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+			t.Errorf("request took %v, want at least 30ms", elapsed)
+		}
+	})
+
+	t.Run("connection reset", func(t *testing.T) {
+		tr := fault.New([]fault.Rule{{Fault: fault.ConnReset()}})
+		_, err := tr.Client().Get(server.URL)
+		if !errors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("error = %v, want ECONNRESET", err)
+		}
+	})
+
+	t.Run("connection reset after write", func(t *testing.T) {
+		var received atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received.Add(1)
+		}))
+		defer server.Close()
+
+		tr := fault.New([]fault.Rule{{Fault: fault.ConnResetAfterWrite()}})
+		_, err := tr.Client().Get(server.URL)
+		if !errors.Is(err, syscall.ECONNRESET) || received.Load() != 1 {
+			t.Errorf("error = %v, server received %d; want ECONNRESET after 1", err, received.Load())
+		}
+	})
+
+	t.Run("body reset", func(t *testing.T) {
+		tr := fault.New([]fault.Rule{{Fault: fault.ResetAfter(4)}})
+		resp, err := tr.Client().Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if string(data) != "0123" || !errors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("body = %q, err = %v", data, err)
+		}
+	})
+
+	t.Run("body truncated", func(t *testing.T) {
+		tr := fault.New([]fault.Rule{{Fault: fault.TruncateAfter(6)}})
+		resp, err := tr.Client().Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if string(data) != "012345" || err != nil {
+			t.Errorf("body = %q, err = %v", data, err)
+		}
+	})
+
+	t.Run("string", func(t *testing.T) {
+		if s := fault.ResetAfter(10).String(); !strings.Contains(s, "10 bytes") {
+			t.Errorf("String() = %q", s)
+		}
+	})
+}
@@ -11,7 +11,6 @@ import (
 	"net/textproto"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/rizome-dev/go-moonshot/pkg/client"
 	"github.com/rizome-dev/go-moonshot/pkg/errors"
@@ -35,7 +34,7 @@ func NewService(c *client.Client) *Service {
 }
 
 // Upload uploads a file to the Moonshot API
-func (s *Service) Upload(ctx context.Context, file io.Reader, filename string, purpose string) (*types.File, error) {
+func (s *Service) Upload(ctx context.Context, file io.Reader, filename string, purpose string, opts ...client.RequestOption) (*types.File, error) {
 	// Create a buffer to write our multipart form
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
@@ -71,13 +70,11 @@ func (s *Service) Upload(ctx context.Context, file io.Reader, filename string, p
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
 	
-	// Set headers
-	req.Header.Set("Authorization", "Bearer "+s.client.APIKey())
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	
-	// Execute the request directly (not using client.Request which would override Content-Type)
-	httpClient := &http.Client{Timeout: 30 * time.Second}
-	resp, err := httpClient.Do(req)
+	// Send through client.Do rather than client.Request, which would encode
+	// the body as JSON
+	resp, err := s.client.Do(req, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +93,7 @@ func (s *Service) Upload(ctx context.Context, file io.Reader, filename string, p
 }
 
 // UploadFile is a convenience method that accepts a file path
-func (s *Service) UploadFile(ctx context.Context, filePath string, purpose string) (*types.File, error) {
+func (s *Service) UploadFile(ctx context.Context, filePath string, purpose string, opts ...client.RequestOption) (*types.File, error) {
 	// Open the file
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -107,17 +104,17 @@ func (s *Service) UploadFile(ctx context.Context, filePath string, purpose strin
 	// Get the filename from the path
 	filename := filepath.Base(filePath)
 	
-	return s.Upload(ctx, file, filename, purpose)
+	return s.Upload(ctx, file, filename, purpose, opts...)
 }
 
 // List lists all files
-func (s *Service) List(ctx context.Context, params *types.FileListParams) (*types.FileListResponse, error) {
+func (s *Service) List(ctx context.Context, params *types.FileListParams, opts ...client.RequestOption) (*types.FileListResponse, error) {
 	endpoint := filesEndpoint
 	if params != nil && params.Purpose != "" {
 		endpoint += "?purpose=" + params.Purpose
 	}
 	
-	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil)
+	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -136,10 +133,10 @@ func (s *Service) List(ctx context.Context, params *types.FileListParams) (*type
 }
 
 // Get retrieves a file by ID
-func (s *Service) Get(ctx context.Context, fileID string) (*types.File, error) {
+func (s *Service) Get(ctx context.Context, fileID string, opts ...client.RequestOption) (*types.File, error) {
 	endpoint := fmt.Sprintf("%s/%s", filesEndpoint, fileID)
 	
-	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil)
+	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -158,10 +155,10 @@ func (s *Service) Get(ctx context.Context, fileID string) (*types.File, error) {
 }
 
 // Delete deletes a file by ID
-func (s *Service) Delete(ctx context.Context, fileID string) error {
+func (s *Service) Delete(ctx context.Context, fileID string, opts ...client.RequestOption) error {
 	endpoint := fmt.Sprintf("%s/%s", filesEndpoint, fileID)
 	
-	resp, err := s.client.Request(ctx, http.MethodDelete, endpoint, nil)
+	resp, err := s.client.Request(ctx, http.MethodDelete, endpoint, nil, opts...)
 	if err != nil {
 		return err
 	}
@@ -175,10 +172,10 @@ func (s *Service) Delete(ctx context.Context, fileID string) error {
 }
 
 // GetContent retrieves the content of a file
-func (s *Service) GetContent(ctx context.Context, fileID string) ([]byte, error) {
+func (s *Service) GetContent(ctx context.Context, fileID string, opts ...client.RequestOption) ([]byte, error) {
 	endpoint := fmt.Sprintf("%s/%s/content", filesEndpoint, fileID)
 	
-	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil)
+	resp, err := s.client.Request(ctx, http.MethodGet, endpoint, nil, opts...)
 	if err != nil {
 		return nil, err
 	}
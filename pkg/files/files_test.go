@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/rizome-dev/go-moonshot/pkg/client"
 	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/fault"
 	"github.com/rizome-dev/go-moonshot/pkg/files"
 	"github.com/rizome-dev/go-moonshot/pkg/types"
 )
@@ -555,4 +559,109 @@ func TestService_GetContent(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestService_Upload_ResponseMeta(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Error("missing or incorrect Authorization header")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Msh-Request-Id", "req-upload")
+		json.NewEncoder(w).Encode(types.File{ID: "file-123"})
+	}))
+	defer server.Close()
+
+	s := files.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+
+	var meta client.ResponseMeta
+	file, err := s.Upload(context.Background(), strings.NewReader("content"), "test.txt", "file-extract", client.WithResponseMeta(&meta))
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if file.ID != "file-123" {
+		t.Errorf("ID = %q, want %q", file.ID, "file-123")
+	}
+	if meta.RequestID != "req-upload" {
+		t.Errorf("RequestID = %q, want %q", meta.RequestID, "req-upload")
+	}
+}
+
+func TestService_Faults(t *testing.T) {
+	var uploads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost:
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				t.Errorf("reading uploaded file: %v", err)
+				return
+			}
+			data, _ := io.ReadAll(file)
+			uploads = append(uploads, string(data))
+			json.NewEncoder(w).Encode(types.File{ID: "file-123"})
+		case strings.HasSuffix(r.URL.Path, "/content"):
+			io.WriteString(w, strings.Repeat("x", 1024))
+		default:
+			json.NewEncoder(w).Encode(types.FileListResponse{Object: "list"})
+		}
+	}))
+	defer server.Close()
+
+	newService := func(rules []fault.Rule, opts ...interface{}) *files.Service {
+		tr := fault.New(rules)
+		params := []interface{}{"test-key", client.WithBaseURL(server.URL), client.WithHTTPClient(tr.Client())}
+		return files.NewService(client.New(append(params, opts...)...))
+	}
+	retry := client.WithRetryPolicy(client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond})
+
+	t.Run("upload retried after 502 resends the body", func(t *testing.T) {
+		uploads = nil
+		s := newService([]fault.Rule{{Nth: 1, Fault: fault.BadGateway()}}, retry)
+		if _, err := s.Upload(context.Background(), strings.NewReader("content"), "test.txt", "file-extract"); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if len(uploads) != 1 || uploads[0] != "content" {
+			t.Errorf("uploads = %q, want one complete upload", uploads)
+		}
+	})
+
+	t.Run("upload retried after connection reset", func(t *testing.T) {
+		uploads = nil
+		s := newService([]fault.Rule{{Method: http.MethodPost, Nth: 1, Fault: fault.ConnReset()}}, retry)
+		if _, err := s.Upload(context.Background(), strings.NewReader("content"), "test.txt", "file-extract"); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if len(uploads) != 1 || uploads[0] != "content" {
+			t.Errorf("uploads = %q, want one complete upload", uploads)
+		}
+	})
+
+	t.Run("upload not resent after a reset once sent", func(t *testing.T) {
+		uploads = nil
+		s := newService([]fault.Rule{{Method: http.MethodPost, Nth: 1, Fault: fault.ConnResetAfterWrite()}}, retry)
+		_, err := s.Upload(context.Background(), strings.NewReader("content"), "test.txt", "file-extract")
+		if !stderrors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("Upload() error = %v, want connection reset", err)
+		}
+		if len(uploads) != 1 {
+			t.Errorf("uploads = %q, want the upload sent once", uploads)
+		}
+	})
+
+	t.Run("content cut mid-body", func(t *testing.T) {
+		s := newService([]fault.Rule{{Path: "/content", Fault: fault.ResetAfter(100)}})
+		_, err := s.GetContent(context.Background(), "file-123")
+		if !stderrors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("GetContent() error = %v, want connection reset", err)
+		}
+	})
+
+	t.Run("latency beyond request timeout", func(t *testing.T) {
+		s := newService([]fault.Rule{{Fault: fault.Latency(time.Second)}})
+		_, err := s.List(context.Background(), nil, client.WithRequestTimeout(20*time.Millisecond))
+		if !stderrors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("List() error = %v, want deadline exceeded", err)
+		}
+	})
+}
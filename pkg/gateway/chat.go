@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func (g *Gateway) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req types.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Invalid request body: "+err.Error())
+		return
+	}
+	if !g.withinBudget(w, r) || !g.wait(w, r) {
+		return
+	}
+
+	if req.Stream != nil && *req.Stream {
+		g.streamCompletion(w, r, req)
+		return
+	}
+
+	resp, err := g.chat.CreateCompletion(r.Context(), req, g.requestOpts...)
+	if err != nil {
+		g.account(r, req.Model, nil, true)
+		writeAPIError(w, err)
+		return
+	}
+	g.account(r, responseModel(req, resp), &resp.Usage, false)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// streamCompletion forwards a streaming completion as server-sent events
+func (g *Gateway) streamCompletion(w http.ResponseWriter, r *http.Request, req types.ChatCompletionRequest) {
+	stream, err := g.chat.CreateCompletionStream(r.Context(), req, g.requestOpts...)
+	if err != nil {
+		g.account(r, req.Model, nil, true)
+		writeAPIError(w, err)
+		return
+	}
+	defer stream.Close()
+	acc := stream.Accumulated()
+
+	// OpenAI clients only expect the final usage chunk when they ask for it
+	err = chat.ServeStream(w, r, stream, chat.SSEOptions{OmitUsage: !includeUsage(req)})
+	g.account(r, responseModel(req, acc.Response()), acc.Usage(), err != nil)
+}
+
+// includeUsage reports whether req asks for a usage chunk at the end of
+// the stream, with stream_options.include_usage
+func includeUsage(req types.ChatCompletionRequest) bool {
+	opts, _ := req.ExtraBody["stream_options"].(map[string]any)
+	include, _ := opts["include_usage"].(bool)
+	return include
+}
+
+// responseModel returns the model that answered req
+func responseModel(req types.ChatCompletionRequest, resp *types.ChatCompletionResponse) string {
+	if resp != nil && resp.Model != "" {
+		return resp.Model
+	}
+	return req.Model
+}
+
+// writeAPIError reports an error from the Moonshot API, keeping its status
+// and error type so OpenAI clients apply their usual handling
+func writeAPIError(w http.ResponseWriter, err error) {
+	if apiErr, ok := errors.IsAPIError(err); ok {
+		status := apiErr.StatusCode
+		if status == 0 {
+			status = http.StatusBadGateway
+		}
+		if apiErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(apiErr.RetryAfter.Seconds()+0.5)))
+		}
+		if apiErr.RequestID != "" {
+			w.Header().Set("X-Upstream-Request-Id", apiErr.RequestID)
+		}
+		writeError(w, status, apiErr.Type, apiErr.Code, apiErr.Message)
+		return
+	}
+	if _, ok := errors.IsBalanceError(err); ok {
+		writeError(w, http.StatusTooManyRequests, "insufficient_quota", "insufficient_balance", err.Error())
+		return
+	}
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "api_error", "timeout", err.Error())
+		return
+	}
+	writeError(w, http.StatusBadGateway, "api_error", "upstream_error", err.Error())
+}
@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// maxUploadMemory is the part of an upload kept in memory; the rest is
+// spooled to a temporary file
+const maxUploadMemory = 32 << 20
+
+func (g *Gateway) handleListModels(w http.ResponseWriter, r *http.Request) {
+	if !g.wait(w, r) {
+		return
+	}
+	resp, err := g.models.List(r.Context(), g.requestOpts...)
+	g.account(r, "", nil, err != nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (g *Gateway) handleGetModel(w http.ResponseWriter, r *http.Request) {
+	if !g.wait(w, r) {
+		return
+	}
+	resp, err := g.models.List(r.Context(), g.requestOpts...)
+	g.account(r, "", nil, err != nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	id := r.PathValue("id")
+	for _, m := range resp.Data {
+		if m.ID == id {
+			writeJSON(w, http.StatusOK, m)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "invalid_request_error", "model_not_found", "The model "+id+" does not exist")
+}
+
+func (g *Gateway) handleUploadFile(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Invalid multipart form: "+err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Missing file field")
+		return
+	}
+	defer file.Close()
+	purpose := r.FormValue("purpose")
+	if purpose == "" {
+		purpose = "file-extract"
+	}
+
+	if !g.wait(w, r) {
+		return
+	}
+	uploaded, err := g.files.Upload(r.Context(), file, header.Filename, purpose, g.requestOpts...)
+	g.account(r, "", nil, err != nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	g.mu.Lock()
+	g.owners[uploaded.ID] = keyID(keyFrom(r.Context()))
+	g.mu.Unlock()
+	writeJSON(w, http.StatusOK, uploaded)
+}
+
+// ownsFile reports whether the caller of r may access the file id: without
+// virtual keys any caller may, otherwise only the key that uploaded it
+func (g *Gateway) ownsFile(r *http.Request, id string) bool {
+	key := keyFrom(r.Context())
+	if key == nil {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	owner, ok := g.owners[id]
+	return ok && owner == key.Key
+}
+
+// checkOwner writes a not-found error and returns false if the caller of r
+// may not access the file named in the path
+func (g *Gateway) checkOwner(w http.ResponseWriter, r *http.Request) bool {
+	id := r.PathValue("id")
+	if g.ownsFile(r, id) {
+		return true
+	}
+	writeError(w, http.StatusNotFound, "invalid_request_error", "file_not_found", "The file "+id+" does not exist")
+	return false
+}
+
+func (g *Gateway) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	if !g.wait(w, r) {
+		return
+	}
+	resp, err := g.files.List(r.Context(), &types.FileListParams{Purpose: r.URL.Query().Get("purpose")}, g.requestOpts...)
+	g.account(r, "", nil, err != nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	owned := resp.Data[:0]
+	for _, f := range resp.Data {
+		if g.ownsFile(r, f.ID) {
+			owned = append(owned, f)
+		}
+	}
+	resp.Data = owned
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (g *Gateway) handleGetFile(w http.ResponseWriter, r *http.Request) {
+	if !g.checkOwner(w, r) || !g.wait(w, r) {
+		return
+	}
+	file, err := g.files.Get(r.Context(), r.PathValue("id"), g.requestOpts...)
+	g.account(r, "", nil, err != nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, file)
+}
+
+// deletedFile is the OpenAI response to a file deletion
+type deletedFile struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (g *Gateway) handleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	if !g.checkOwner(w, r) || !g.wait(w, r) {
+		return
+	}
+	id := r.PathValue("id")
+	err := g.files.Delete(r.Context(), id, g.requestOpts...)
+	g.account(r, "", nil, err != nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	g.mu.Lock()
+	delete(g.owners, id)
+	g.mu.Unlock()
+	writeJSON(w, http.StatusOK, deletedFile{ID: id, Object: "file", Deleted: true})
+}
+
+func (g *Gateway) handleFileContent(w http.ResponseWriter, r *http.Request) {
+	if !g.checkOwner(w, r) || !g.wait(w, r) {
+		return
+	}
+	content, err := g.files.GetContent(r.Context(), r.PathValue("id"), g.requestOpts...)
+	g.account(r, "", nil, err != nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(content))
+	w.Write(content)
+}
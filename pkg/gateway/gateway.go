@@ -0,0 +1,156 @@
+// Package gateway serves an OpenAI-compatible HTTP API backed by the
+// Moonshot API, for tools that only speak the OpenAI protocol.
+//
+// A Gateway forwards /v1/chat/completions, /v1/models and /v1/files through
+// the SDK services using the server's own API key, so the client's retries,
+// rate limiting, balance guard and middleware apply, and chat responses can
+// be cached. Callers can be given virtual keys with their own rate limits
+// and token budgets; usage is accounted per key. With virtual keys, files
+// uploaded through the gateway are only visible to the key that uploaded
+// them; ownership is kept in memory, so files uploaded before a restart or
+// outside the gateway are hidden from every key.
+//
+//	c := client.New(client.WithRetryPolicy(client.RetryPolicy{MaxRetries: 3}))
+//	gw := gateway.New(c, gateway.WithVirtualKeys(gateway.VirtualKey{Key: "vk-alice", Name: "alice"}))
+//	http.ListenAndServe("127.0.0.1:8080", gw)
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/files"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+)
+
+// Gateway is an http.Handler serving the OpenAI-compatible API
+type Gateway struct {
+	chat   *chat.Service
+	files  *files.Service
+	models *models.Service
+	mux    *http.ServeMux
+
+	chatOpts    []chat.ServiceOption
+	requestOpts []client.RequestOption
+	limiter     client.RateLimiter
+
+	mu   sync.Mutex
+	keys map[string]*VirtualKey
+	// usage and owners are keyed by VirtualKey.Key; owners maps file IDs
+	// to the key that uploaded them
+	usage  map[string]*Usage
+	owners map[string]string
+}
+
+// Option configures a Gateway
+type Option func(*Gateway)
+
+// WithChatOptions configures the chat service the gateway forwards
+// completions through, for example with chat.WithResponseCache
+func WithChatOptions(opts ...chat.ServiceOption) Option {
+	return func(g *Gateway) {
+		g.chatOpts = append(g.chatOpts, opts...)
+	}
+}
+
+// WithRequestOptions applies opts to every request forwarded to the API,
+// for example client.WithRequestRetryPolicy
+func WithRequestOptions(opts ...client.RequestOption) Option {
+	return func(g *Gateway) {
+		g.requestOpts = append(g.requestOpts, opts...)
+	}
+}
+
+// WithRateLimiter limits the rate of requests the gateway forwards for all
+// callers together. Requests over the limit wait.
+func WithRateLimiter(limiter client.RateLimiter) Option {
+	return func(g *Gateway) {
+		g.limiter = limiter
+	}
+}
+
+// WithVirtualKeys requires callers to authenticate with one of keys. Without
+// virtual keys the gateway accepts any caller, and usage is accounted under
+// the empty key name.
+func WithVirtualKeys(keys ...VirtualKey) Option {
+	return func(g *Gateway) {
+		if g.keys == nil {
+			g.keys = make(map[string]*VirtualKey)
+		}
+		for _, k := range keys {
+			g.keys[k.Key] = &k
+		}
+	}
+}
+
+// New creates a gateway forwarding requests through c
+func New(c *client.Client, opts ...Option) *Gateway {
+	g := &Gateway{
+		usage:  make(map[string]*Usage),
+		owners: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.chat = chat.NewService(c, g.chatOpts...)
+	g.files = files.NewService(c)
+	g.models = models.NewService(c)
+
+	g.mux = http.NewServeMux()
+	g.mux.HandleFunc("POST /v1/chat/completions", g.handleChatCompletions)
+	g.mux.HandleFunc("GET /v1/models", g.handleListModels)
+	g.mux.HandleFunc("GET /v1/models/{id}", g.handleGetModel)
+	g.mux.HandleFunc("POST /v1/files", g.handleUploadFile)
+	g.mux.HandleFunc("GET /v1/files", g.handleListFiles)
+	g.mux.HandleFunc("GET /v1/files/{id}", g.handleGetFile)
+	g.mux.HandleFunc("DELETE /v1/files/{id}", g.handleDeleteFile)
+	g.mux.HandleFunc("GET /v1/files/{id}/content", g.handleFileContent)
+	g.mux.HandleFunc("GET /v1/usage", g.handleUsage)
+	return g
+}
+
+// ServeHTTP authenticates the caller and dispatches the request
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := g.authenticate(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_authentication_error", "invalid_api_key", "Invalid virtual API key")
+		return
+	}
+	g.mux.ServeHTTP(w, r.WithContext(withKey(r.Context(), key)))
+}
+
+// authenticate returns the virtual key named by the request's bearer token.
+// Without configured keys every request is let through with a nil key.
+func (g *Gateway) authenticate(r *http.Request) (*VirtualKey, bool) {
+	if len(g.keys) == 0 {
+		return nil, true
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer"))
+	key, ok := g.keys[token]
+	return key, ok && token != ""
+}
+
+// errorBody is an OpenAI-style error response
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, code, message string) {
+	writeJSON(w, status, errorBody{Error: errorDetail{Message: message, Type: errType, Code: code}})
+}
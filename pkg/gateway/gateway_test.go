@@ -0,0 +1,384 @@
+package gateway_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/moonshottest"
+	"github.com/rizome-dev/go-moonshot/pkg/chat"
+	"github.com/rizome-dev/go-moonshot/pkg/gateway"
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// newGateway starts a gateway in front of a fake Moonshot API
+func newGateway(t *testing.T, opts ...gateway.Option) (*gateway.Gateway, *httptest.Server, *moonshottest.Server) {
+	t.Helper()
+	upstream := moonshottest.NewServer()
+	t.Cleanup(upstream.Close)
+	gw := gateway.New(upstream.Client(), opts...)
+	server := httptest.NewServer(gw)
+	t.Cleanup(server.Close)
+	return gw, server, upstream
+}
+
+// call sends a request to the gateway with key as the bearer token
+func call(t *testing.T, method, url, key, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func chatBody(content string, stream bool) io.Reader {
+	return strings.NewReader(`{"model":"kimi-k2","stream":` + map[bool]string{true: "true", false: "false"}[stream] +
+		`,"messages":[{"role":"user","content":"` + content + `"}],"stream_options":{"include_usage":true}}`)
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return v
+}
+
+func TestGateway_ChatCompletions(t *testing.T) {
+	gw, server, upstream := newGateway(t)
+
+	resp := call(t, http.MethodPost, server.URL+"/v1/chat/completions", "anything", "application/json", chatBody("hi", false))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	completion := decode[types.ChatCompletionResponse](t, resp)
+	if content, _ := completion.Choices[0].Message.Content.(string); content != "echo: hi" {
+		t.Errorf("content = %q", content)
+	}
+
+	got := upstream.LastChatRequest(t)
+	if _, ok := got.ExtraBody["stream_options"]; !ok {
+		t.Errorf("unknown request fields were not forwarded: %+v", got.ExtraBody)
+	}
+	if auth := upstream.Requests()[0].Header.Get("Authorization"); auth != "Bearer "+moonshottest.APIKey {
+		t.Errorf("upstream Authorization = %q, want the gateway's own key", auth)
+	}
+
+	usage := gw.Usage()
+	if len(usage) != 1 || usage[0].Requests != 1 || usage[0].TotalTokens != completion.Usage.TotalTokens || usage[0].Cost == 0 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestGateway_ChatCompletionsStream(t *testing.T) {
+	gw, server, _ := newGateway(t)
+
+	resp := call(t, http.MethodPost, server.URL+"/v1/chat/completions", "", "application/json", chatBody("one two three", true))
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, content type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var (
+		events  []string
+		content strings.Builder
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			t.Fatalf("unexpected line %q", line)
+		}
+		events = append(events, data)
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk types.ChatCompletionStream
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("decoding chunk %q: %v", data, err)
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content != nil {
+				content.WriteString(*c.Delta.Content)
+			}
+		}
+	}
+	if events[len(events)-1] != "[DONE]" {
+		t.Errorf("last event = %q, want [DONE]", events[len(events)-1])
+	}
+	if usage := events[len(events)-2]; !strings.Contains(usage, `"choices":[]`) || !strings.Contains(usage, `"usage":{`) {
+		t.Errorf("usage chunk requested with include_usage = %q", usage)
+	}
+	if content.String() != "echo: one two three" {
+		t.Errorf("content = %q", content.String())
+	}
+	if usage := gw.Usage(); len(usage) != 1 || usage[0].TotalTokens == 0 || usage[0].Failed != 0 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestGateway_StreamFailure(t *testing.T) {
+	gw, server, upstream := newGateway(t)
+	upstream.InjectFault(moonshottest.MalformedStream())
+
+	resp := call(t, http.MethodPost, server.URL+"/v1/chat/completions", "", "application/json", chatBody("hi", true))
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"code":"stream_error"`) || strings.Contains(string(body), "[DONE]") {
+		t.Errorf("body = %s", body)
+	}
+	if usage := gw.Usage(); usage[0].Failed != 1 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestGateway_VirtualKeys(t *testing.T) {
+	gw, server, upstream := newGateway(t, gateway.WithVirtualKeys(
+		gateway.VirtualKey{Key: "vk-alice", Name: "alice"},
+		gateway.VirtualKey{Key: "vk-bob", Name: "bob", TokenBudget: 1},
+	))
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+	}{
+		{name: "missing key", key: "", wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", key: "vk-eve", wantStatus: http.StatusUnauthorized},
+		{name: "real key", key: moonshottest.APIKey, wantStatus: http.StatusUnauthorized},
+		{name: "alice", key: "vk-alice", wantStatus: http.StatusOK},
+		{name: "bob within budget", key: "vk-bob", wantStatus: http.StatusOK},
+		{name: "bob over budget", key: "vk-bob", wantStatus: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := call(t, http.MethodPost, server.URL+"/v1/chat/completions", tt.key, "application/json", chatBody("hi", false))
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+	upstream.AssertRequestCount(t, "/chat/completions", 2)
+
+	usage := gw.Usage()
+	if len(usage) != 2 || usage[0].Name != "alice" || usage[1].Name != "bob" || usage[1].Requests != 1 {
+		t.Errorf("usage = %+v", usage)
+	}
+
+	resp := call(t, http.MethodGet, server.URL+"/v1/usage", "vk-alice", "", nil)
+	if own := decode[gateway.Usage](t, resp); own.Name != "alice" || own.Requests != 1 {
+		t.Errorf("own usage = %+v", own)
+	}
+}
+
+func TestGateway_VirtualKeysSharingName(t *testing.T) {
+	gw, server, _ := newGateway(t, gateway.WithVirtualKeys(
+		gateway.VirtualKey{Key: "vk-ci-1", Name: "ci", TokenBudget: 1},
+		gateway.VirtualKey{Key: "vk-ci-2", Name: "ci", TokenBudget: 1},
+	))
+
+	for _, key := range []string{"vk-ci-1", "vk-ci-2"} {
+		resp := call(t, http.MethodPost, server.URL+"/v1/chat/completions", key, "application/json", chatBody("hi", false))
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status = %d, want budget kept per key", key, resp.StatusCode)
+		}
+	}
+
+	usage := gw.Usage()
+	if len(usage) != 2 || usage[0].Name != "ci" || usage[0].Requests != 1 || usage[1].Requests != 1 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestGateway_UpstreamErrors(t *testing.T) {
+	_, server, upstream := newGateway(t)
+	upstream.InjectFault(moonshottest.RateLimited(2_000_000_000))
+
+	resp := call(t, http.MethodPost, server.URL+"/v1/chat/completions", "", "application/json", chatBody("hi", false))
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("status = %d, Retry-After = %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	body := decode[struct {
+		Error struct{ Type, Message string }
+	}](t, resp)
+	if body.Error.Type != "rate_limit_reached_error" {
+		t.Errorf("error = %+v", body.Error)
+	}
+
+	resp = call(t, http.MethodPost, server.URL+"/v1/chat/completions", "", "application/json", strings.NewReader("{"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid body: status = %d", resp.StatusCode)
+	}
+}
+
+func TestGateway_ResponseCache(t *testing.T) {
+	cacheAll := func(types.ChatCompletionRequest) bool { return true }
+	_, server, upstream := newGateway(t, gateway.WithChatOptions(chat.WithResponseCache(respcache.NewMemory(10, 0)), chat.WithCacheFilter(cacheAll)))
+
+	for _, stream := range []bool{false, false, true} {
+		resp := call(t, http.MethodPost, server.URL+"/v1/chat/completions", "", "application/json", chatBody("hi", stream))
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d", resp.StatusCode)
+		}
+	}
+	upstream.AssertRequestCount(t, "/chat/completions", 1)
+}
+
+// countingLimiter counts the requests it lets through
+type countingLimiter struct {
+	waits atomic.Int32
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.waits.Add(1)
+	return ctx.Err()
+}
+
+func TestGateway_RateLimiters(t *testing.T) {
+	global, alice := &countingLimiter{}, &countingLimiter{}
+	_, server, _ := newGateway(t,
+		gateway.WithRateLimiter(global),
+		gateway.WithVirtualKeys(
+			gateway.VirtualKey{Key: "vk-alice", Name: "alice", RateLimiter: alice},
+			gateway.VirtualKey{Key: "vk-bob", Name: "bob"},
+		),
+	)
+
+	call(t, http.MethodPost, server.URL+"/v1/chat/completions", "vk-alice", "application/json", chatBody("hi", false))
+	call(t, http.MethodGet, server.URL+"/v1/models", "vk-bob", "", nil)
+	if global.waits.Load() != 2 || alice.waits.Load() != 1 {
+		t.Errorf("global waits = %d, alice waits = %d", global.waits.Load(), alice.waits.Load())
+	}
+}
+
+func TestGateway_Models(t *testing.T) {
+	_, server, _ := newGateway(t)
+
+	resp := call(t, http.MethodGet, server.URL+"/v1/models", "", "", nil)
+	if list := decode[types.ModelListResponse](t, resp); len(list.Data) == 0 || list.Object != "list" {
+		t.Errorf("models = %+v", list)
+	}
+
+	resp = call(t, http.MethodGet, server.URL+"/v1/models/kimi-k2", "", "", nil)
+	if m := decode[types.ModelInfo](t, resp); m.ID != "kimi-k2" {
+		t.Errorf("model = %+v", m)
+	}
+
+	resp = call(t, http.MethodGet, server.URL+"/v1/models/gpt-4", "", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown model: status = %d", resp.StatusCode)
+	}
+}
+
+func TestGateway_Files(t *testing.T) {
+	_, server, upstream := newGateway(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("some notes"))
+	mw.WriteField("purpose", "file-extract")
+	mw.Close()
+
+	resp := call(t, http.MethodPost, server.URL+"/v1/files", "", mw.FormDataContentType(), &body)
+	uploaded := decode[types.File](t, resp)
+	if resp.StatusCode != http.StatusOK || uploaded.Filename != "notes.txt" || uploaded.Bytes != 10 {
+		t.Fatalf("status = %d, file = %+v", resp.StatusCode, uploaded)
+	}
+
+	resp = call(t, http.MethodGet, server.URL+"/v1/files?purpose=file-extract", "", "", nil)
+	if list := decode[types.FileListResponse](t, resp); len(list.Data) != 1 {
+		t.Errorf("files = %+v", list)
+	}
+
+	resp = call(t, http.MethodGet, server.URL+"/v1/files/"+uploaded.ID, "", "", nil)
+	if file := decode[types.File](t, resp); file.ID != uploaded.ID {
+		t.Errorf("file = %+v", file)
+	}
+
+	resp = call(t, http.MethodGet, server.URL+"/v1/files/"+uploaded.ID+"/content", "", "", nil)
+	if content, _ := io.ReadAll(resp.Body); !strings.Contains(string(content), "some notes") {
+		t.Errorf("content = %s", content)
+	}
+
+	resp = call(t, http.MethodDelete, server.URL+"/v1/files/"+uploaded.ID, "", "", nil)
+	if deleted := decode[map[string]any](t, resp); deleted["deleted"] != true {
+		t.Errorf("delete response = %v", deleted)
+	}
+
+	resp = call(t, http.MethodGet, server.URL+"/v1/files/"+uploaded.ID, "", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted file: status = %d", resp.StatusCode)
+	}
+	upstream.AssertRequestCount(t, "/files", 2) // upload and list
+}
+
+func TestGateway_FilesPerKey(t *testing.T) {
+	_, server, upstream := newGateway(t, gateway.WithVirtualKeys(
+		gateway.VirtualKey{Key: "vk-alice", Name: "alice"},
+		gateway.VirtualKey{Key: "vk-bob", Name: "bob"},
+	))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("some notes"))
+	mw.WriteField("purpose", "file-extract")
+	mw.Close()
+
+	resp := call(t, http.MethodPost, server.URL+"/v1/files", "vk-alice", mw.FormDataContentType(), &body)
+	uploaded := decode[types.File](t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+
+	resp = call(t, http.MethodGet, server.URL+"/v1/files", "vk-bob", "", nil)
+	if list := decode[types.FileListResponse](t, resp); len(list.Data) != 0 {
+		t.Errorf("bob's files = %+v", list.Data)
+	}
+	resp = call(t, http.MethodGet, server.URL+"/v1/files", "vk-alice", "", nil)
+	if list := decode[types.FileListResponse](t, resp); len(list.Data) != 1 {
+		t.Errorf("alice's files = %+v", list.Data)
+	}
+
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/files/" + uploaded.ID},
+		{http.MethodGet, "/v1/files/" + uploaded.ID + "/content"},
+		{http.MethodDelete, "/v1/files/" + uploaded.ID},
+	} {
+		if resp := call(t, tt.method, server.URL+tt.path, "vk-bob", "", nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("bob %s %s: status = %d, want %d", tt.method, tt.path, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+	upstream.AssertRequestCount(t, "/files/"+uploaded.ID, 0)
+
+	resp = call(t, http.MethodDelete, server.URL+"/v1/files/"+uploaded.ID, "vk-alice", "", nil)
+	if deleted := decode[map[string]any](t, resp); deleted["deleted"] != true {
+		t.Errorf("delete response = %v", deleted)
+	}
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// VirtualKey is an API key the gateway issues to a caller in place of the
+// real Moonshot key
+type VirtualKey struct {
+	// Key is the bearer token the caller sends
+	Key string `json:"key"`
+	// Name identifies the caller in usage reports
+	Name string `json:"name"`
+	// RateLimiter, if set, limits the caller's request rate. Requests over
+	// the limit wait.
+	RateLimiter client.RateLimiter `json:"-"`
+	// TokenBudget, if positive, is the number of tokens the caller may use.
+	// Once it is spent, chat completions are refused with status 429.
+	TokenBudget int `json:"token_budget,omitempty"`
+}
+
+// Usage is the usage accounted to a virtual key
+type Usage struct {
+	Name             string  `json:"name"`
+	Requests         int     `json:"requests"`
+	Failed           int     `json:"failed"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+type keyContextKey struct{}
+
+func withKey(ctx context.Context, key *VirtualKey) context.Context {
+	return context.WithValue(ctx, keyContextKey{}, key)
+}
+
+// keyFrom returns the caller's virtual key, or nil without virtual keys
+func keyFrom(ctx context.Context) *VirtualKey {
+	key, _ := ctx.Value(keyContextKey{}).(*VirtualKey)
+	return key
+}
+
+// keyID returns the token identifying key, or "" without virtual keys
+func keyID(key *VirtualKey) string {
+	if key == nil {
+		return ""
+	}
+	return key.Key
+}
+
+// keyName returns the name usage of key is reported under
+func keyName(key *VirtualKey) string {
+	if key == nil {
+		return ""
+	}
+	return key.Name
+}
+
+// Usage returns the usage accounted to each virtual key, ordered by name
+func (g *Gateway) Usage() []Usage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := make([]Usage, 0, len(g.usage))
+	for _, u := range g.usage {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// usageOf returns the usage record for key. Records are kept by key, so
+// keys sharing a name are accounted separately. The caller must hold g.mu.
+func (g *Gateway) usageOf(key *VirtualKey) *Usage {
+	id := keyID(key)
+	u, ok := g.usage[id]
+	if !ok {
+		u = &Usage{Name: keyName(key)}
+		g.usage[id] = u
+	}
+	return u
+}
+
+// withinBudget reports whether the caller has tokens left in its budget,
+// writing an error response if not
+func (g *Gateway) withinBudget(w http.ResponseWriter, r *http.Request) bool {
+	key := keyFrom(r.Context())
+	if key == nil || key.TokenBudget <= 0 {
+		return true
+	}
+	g.mu.Lock()
+	spent := g.usageOf(key).TotalTokens
+	g.mu.Unlock()
+	if spent >= key.TokenBudget {
+		writeError(w, http.StatusTooManyRequests, "insufficient_quota", "token_budget_exceeded", "The token budget of this key is spent")
+		return false
+	}
+	return true
+}
+
+// wait blocks until the gateway's and the caller's rate limiters allow the
+// request, writing an error response and returning false if the request is
+// cancelled first
+func (g *Gateway) wait(w http.ResponseWriter, r *http.Request) bool {
+	for _, limiter := range []client.RateLimiter{g.limiter, rateLimiterOf(keyFrom(r.Context()))} {
+		if limiter == nil {
+			continue
+		}
+		if err := limiter.Wait(r.Context()); err != nil {
+			writeError(w, http.StatusServiceUnavailable, "api_error", "rate_limited", "Gave up waiting for the rate limiter: "+err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+func rateLimiterOf(key *VirtualKey) client.RateLimiter {
+	if key == nil {
+		return nil
+	}
+	return key.RateLimiter
+}
+
+// account records a completed request for the caller. usage is nil for
+// requests that do not use tokens.
+func (g *Gateway) account(r *http.Request, model string, usage *types.Usage, failed bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	u := g.usageOf(keyFrom(r.Context()))
+	u.Requests++
+	if failed {
+		u.Failed++
+	}
+	if usage == nil {
+		return
+	}
+	u.PromptTokens += usage.PromptTokens
+	u.CachedTokens += usage.CachedTokens
+	u.CompletionTokens += usage.CompletionTokens
+	u.TotalTokens += usage.TotalTokens
+	if p, ok := models.Model(model).Pricing(); ok {
+		u.Cost += p.Cost(usage.PromptTokens, usage.CachedTokens, usage.CompletionTokens)
+	}
+}
+
+// handleUsage reports the caller's own usage
+func (g *Gateway) handleUsage(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	u := *g.usageOf(keyFrom(r.Context()))
+	g.mu.Unlock()
+	writeJSON(w, http.StatusOK, u)
+}
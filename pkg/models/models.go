@@ -21,6 +21,15 @@ const (
 	Moonshot128K = MoonshotV1128K
 )
 
+// All returns the models known to this package, in the order they are
+// declared
+func All() []Model {
+	return []Model{
+		MoonshotV18K, MoonshotV132K, MoonshotV1128K,
+		KimiK2, KimiK2Base, KimiK2Instruct,
+	}
+}
+
 // String returns the string representation of a model
 func (m Model) String() string {
 	return string(m)
@@ -132,4 +132,50 @@ func TestModel_SupportsVision(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestModel_Pricing(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  models.Model
+		wantOk bool
+	}{
+		{"MoonshotV18K", models.MoonshotV18K, true},
+		{"KimiK2", models.KimiK2, true},
+		{"Invalid model", models.Model("invalid-model"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := tt.model.Pricing()
+			if ok != tt.wantOk {
+				t.Errorf("Model.Pricing() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && (p.Input <= 0 || p.Output <= 0) {
+				t.Errorf("Model.Pricing() = %+v, want positive prices", p)
+			}
+		})
+	}
+}
+
+func TestPricing_Cost(t *testing.T) {
+	p := models.Pricing{Input: 1, CachedInput: 0.5, Output: 2}
+
+	// 600k uncached at $1, 400k cached at $0.5, 1M output at $2
+	got := p.Cost(1_000_000, 400_000, 1_000_000)
+	if got != 2.8 {
+		t.Errorf("Pricing.Cost() = %v, want 2.8", got)
+	}
+}
+
+func TestAll(t *testing.T) {
+	all := models.All()
+	if len(all) != 6 {
+		t.Errorf("All() returned %d models, want 6", len(all))
+	}
+	for _, m := range all {
+		if !m.IsValid() {
+			t.Errorf("All() includes invalid model %q", m)
+		}
+	}
+}
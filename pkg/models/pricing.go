@@ -0,0 +1,36 @@
+package models
+
+// Pricing is the list price of a model in USD per million tokens
+type Pricing struct {
+	Input       float64
+	CachedInput float64
+	Output      float64
+}
+
+// Pricing returns the list price of the model on the global platform
+// (api.moonshot.ai). Prices change; treat the result as an estimate and
+// supply your own pricing where accuracy matters.
+func (m Model) Pricing() (Pricing, bool) {
+	switch m {
+	case MoonshotV18K:
+		return Pricing{Input: 0.20, CachedInput: 0.20, Output: 2.00}, true
+	case MoonshotV132K:
+		return Pricing{Input: 1.00, CachedInput: 1.00, Output: 3.00}, true
+	case MoonshotV1128K:
+		return Pricing{Input: 2.00, CachedInput: 2.00, Output: 5.00}, true
+	case KimiK2, KimiK2Base, KimiK2Instruct:
+		return Pricing{Input: 0.60, CachedInput: 0.15, Output: 2.50}, true
+	default:
+		return Pricing{}, false
+	}
+}
+
+// Cost returns the price in USD of a call with the given token counts.
+// Cached prompt tokens are billed at the cached input rate.
+func (p Pricing) Cost(promptTokens, cachedTokens, completionTokens int) float64 {
+	if cachedTokens > promptTokens {
+		cachedTokens = promptTokens
+	}
+	uncached := promptTokens - cachedTokens
+	return (float64(uncached)*p.Input + float64(cachedTokens)*p.CachedInput + float64(completionTokens)*p.Output) / 1e6
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+const (
+	modelsEndpoint = "/models"
+)
+
+// Service lists the models available to the account
+type Service struct {
+	client *client.Client
+}
+
+// NewService creates a new models service
+func NewService(c *client.Client) *Service {
+	return &Service{
+		client: c,
+	}
+}
+
+// List retrieves the models the API currently serves
+func (s *Service) List(ctx context.Context, opts ...client.RequestOption) (*types.ModelListResponse, error) {
+	resp, err := s.client.Request(ctx, http.MethodGet, modelsEndpoint, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.HandleErrorResponse(resp)
+	}
+
+	var listResp types.ModelListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return &listResp, nil
+}
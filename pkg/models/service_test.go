@@ -0,0 +1,71 @@
+package models_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/client"
+	"github.com/rizome-dev/go-moonshot/pkg/errors"
+	"github.com/rizome-dev/go-moonshot/pkg/models"
+)
+
+func TestService_List(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "successful list",
+			statusCode: http.StatusOK,
+			body:       `{"object":"list","data":[{"id":"moonshot-v1-8k","object":"model","created":1711000000,"owned_by":"moonshot"},{"id":"kimi-k2","object":"model","created":1752000000,"owned_by":"moonshot"}]}`,
+			want:       []string{"moonshot-v1-8k", "kimi-k2"},
+		},
+		{
+			name:       "unauthorized",
+			statusCode: http.StatusUnauthorized,
+			body:       `{"error":{"message":"Invalid Authentication","type":"invalid_authentication_error"}}`,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/models" {
+					t.Errorf("got %s %s, want GET /models", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			s := models.NewService(client.New("test-key", client.WithBaseURL(server.URL)))
+			got, err := s.List(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("List() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, ok := errors.IsAPIError(err); !ok {
+					t.Errorf("List() error type = %T, want APIError", err)
+				}
+				return
+			}
+			if len(got.Data) != len(tt.want) {
+				t.Fatalf("List() returned %d models, want %d", len(got.Data), len(tt.want))
+			}
+			for i, id := range tt.want {
+				if got.Data[i].ID != id {
+					t.Errorf("Data[%d].ID = %q, want %q", i, got.Data[i].ID, id)
+				}
+			}
+			if got.Data[0].OwnedBy != "moonshot" || got.Data[0].Created != 1711000000 {
+				t.Errorf("Data[0] = %+v", got.Data[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package respcache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dir is a Cache storing one file per entry in a directory, so entries
+// survive process restarts and can be shared between CI runs. Entries
+// expire by file modification time.
+type Dir struct {
+	path string
+	ttl  time.Duration
+}
+
+// NewDir creates a Dir cache in path, creating the directory if needed.
+// Entries are kept for ttl; a non-positive ttl keeps them forever.
+func NewDir(path string, ttl time.Duration) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	return &Dir{path: path, ttl: ttl}, nil
+}
+
+// Get implements Cache
+func (d *Dir) Get(_ context.Context, key string) ([]byte, bool, error) {
+	name := d.file(key)
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("reading cache entry: %w", err)
+	}
+	if d.ttl > 0 && time.Since(info.ModTime()) > d.ttl {
+		os.Remove(name)
+		return nil, false, nil
+	}
+
+	value, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("reading cache entry: %w", err)
+	}
+	return value, true, nil
+}
+
+// Set implements Cache. The entry is written to a temporary file and
+// renamed into place so concurrent readers never see a partial entry.
+func (d *Dir) Set(_ context.Context, key string, value []byte) error {
+	tmp, err := os.CreateTemp(d.path, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), d.file(key)); err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	return nil
+}
+
+// file returns the path of the entry for key. Keys are used as file names,
+// so only the base name is kept.
+func (d *Dir) file(key string) string {
+	return filepath.Join(d.path, filepath.Base(key)+".json")
+}
@@ -0,0 +1,90 @@
+package respcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process Cache that evicts the least recently used entry
+// once it holds MaxEntries
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	entries    map[string]*list.Element
+	order      *list.List // front is most recently used
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory creates a Memory cache holding at most maxEntries entries, each
+// kept for ttl. A non-positive maxEntries or ttl means no limit.
+func NewMemory(maxEntries int, ttl time.Duration) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get implements Cache
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		m.remove(elem)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set implements Cache
+func (m *Memory) Set(_ context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expires time.Time
+	if m.ttl > 0 {
+		expires = time.Now().Add(m.ttl)
+	}
+	value = append([]byte(nil), value...)
+
+	if elem, ok := m.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.value, entry.expires = value, expires
+		m.order.MoveToFront(elem)
+		return nil
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	if m.maxEntries > 0 && m.order.Len() > m.maxEntries {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *Memory) remove(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.entries, elem.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,71 @@
+// Package respcache caches chat completion responses, so that identical
+// deterministic requests are answered without calling the API again.
+package respcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+// keyVersion is hashed into every key so a change to the key derivation
+// does not serve entries stored under the old scheme
+const keyVersion = "v2"
+
+// Cache stores encoded responses by key. Implementations must be safe for
+// concurrent use.
+type Cache interface {
+	// Get returns the value stored under key. ok is false if there is no
+	// entry or it has expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores value under key, replacing any existing entry
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// Scope identifies the API endpoint and account a request is sent to, so
+// that clients with different base URLs or API keys sharing a cache do not
+// get each other's responses. The API key is kept only as a fingerprint.
+func Scope(baseURL, apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return baseURL + "\n" + hex.EncodeToString(sum[:8])
+}
+
+// Key returns the cache key of req sent in scope, as returned by Scope: a
+// hash of the scope and the request's canonical JSON encoding, covering the
+// model, messages, tools, sampling parameters and ExtraBody. The stream
+// flag is ignored so streamed and non-streamed requests share entries.
+func Key(scope string, req types.ChatCompletionRequest) (string, error) {
+	req.Stream = nil
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("encoding request: %w", err)
+	}
+
+	// Round-trip through a generic value so object keys are sorted at every
+	// level, including maps supplied by the caller
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("canonicalizing request: %w", err)
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("canonicalizing request: %w", err)
+	}
+
+	sum := sha256.Sum256(append([]byte(keyVersion+"\n"+scope+"\n"), canonical...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Deterministic reports whether req asks for reproducible output: a
+// temperature of zero or a fixed seed
+func Deterministic(req types.ChatCompletionRequest) bool {
+	return (req.Temperature != nil && *req.Temperature == 0) || req.Seed != nil
+}
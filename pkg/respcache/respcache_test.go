@@ -0,0 +1,184 @@
+package respcache_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rizome-dev/go-moonshot/pkg/respcache"
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+func TestKey(t *testing.T) {
+	base := func() types.ChatCompletionRequest {
+		return types.ChatCompletionRequest{
+			Model:       "kimi-k2-0711-preview",
+			Messages:    []types.Message{{Role: "user", Content: "Hello"}},
+			Temperature: utils.Float64(0),
+			ExtraBody:   map[string]any{"b": 1, "a": map[string]any{"y": 2, "x": 1}},
+		}
+	}
+
+	scope := respcache.Scope("https://api.moonshot.cn/v1", "sk-one")
+	key, err := respcache.Key(scope, base())
+	if err != nil {
+		t.Fatalf("Key() error = %v", err)
+	}
+	if len(key) != 64 {
+		t.Errorf("Key() = %q, want a hex sha256", key)
+	}
+
+	tests := []struct {
+		name   string
+		scope  string
+		modify func(*types.ChatCompletionRequest)
+		same   bool
+	}{
+		{
+			name:   "base url",
+			scope:  respcache.Scope("https://api.moonshot.ai/v1", "sk-one"),
+			modify: func(r *types.ChatCompletionRequest) {},
+		},
+		{
+			name:   "api key",
+			scope:  respcache.Scope("https://api.moonshot.cn/v1", "sk-two"),
+			modify: func(r *types.ChatCompletionRequest) {},
+		},
+		{
+			name:   "stream flag ignored",
+			modify: func(r *types.ChatCompletionRequest) { r.Stream = utils.Bool(true) },
+			same:   true,
+		},
+		{
+			name: "map order ignored",
+			modify: func(r *types.ChatCompletionRequest) {
+				r.ExtraBody = map[string]any{"a": map[string]any{"x": 1, "y": 2}, "b": 1}
+			},
+			same: true,
+		},
+		{
+			name:   "model",
+			modify: func(r *types.ChatCompletionRequest) { r.Model = "moonshot-v1-8k" },
+		},
+		{
+			name:   "messages",
+			modify: func(r *types.ChatCompletionRequest) { r.Messages[0].Content = "Hi" },
+		},
+		{
+			name:   "params",
+			modify: func(r *types.ChatCompletionRequest) { r.Seed = utils.Int64(1) },
+		},
+		{
+			name:   "tools",
+			modify: func(r *types.ChatCompletionRequest) { r.Tools = []types.Tool{types.WebSearchTool()} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base()
+			tt.modify(&req)
+			if tt.scope == "" {
+				tt.scope = scope
+			}
+			got, err := respcache.Key(tt.scope, req)
+			if err != nil {
+				t.Fatalf("Key() error = %v", err)
+			}
+			if (got == key) != tt.same {
+				t.Errorf("Key() same = %v, want %v", got == key, tt.same)
+			}
+		})
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	tests := []struct {
+		name string
+		req  types.ChatCompletionRequest
+		want bool
+	}{
+		{name: "default", req: types.ChatCompletionRequest{}, want: false},
+		{name: "temperature 0", req: types.ChatCompletionRequest{Temperature: utils.Float64(0)}, want: true},
+		{name: "temperature 0.3", req: types.ChatCompletionRequest{Temperature: utils.Float64(0.3)}, want: false},
+		{name: "seed", req: types.ChatCompletionRequest{Seed: utils.Int64(42)}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := respcache.Deterministic(tt.req); got != tt.want {
+				t.Errorf("Deterministic() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		m := respcache.NewMemory(2, 0)
+		m.Set(ctx, "a", []byte("1"))
+		m.Set(ctx, "b", []byte("2"))
+		m.Get(ctx, "a")
+		m.Set(ctx, "c", []byte("3"))
+
+		if _, ok, _ := m.Get(ctx, "b"); ok {
+			t.Error("Get(b) hit, want evicted")
+		}
+		if value, ok, _ := m.Get(ctx, "a"); !ok || string(value) != "1" {
+			t.Errorf("Get(a) = %q, %v, want 1, true", value, ok)
+		}
+		if m.Len() != 2 {
+			t.Errorf("Len() = %d, want 2", m.Len())
+		}
+	})
+
+	t.Run("expires entries", func(t *testing.T) {
+		m := respcache.NewMemory(0, 10*time.Millisecond)
+		m.Set(ctx, "a", []byte("1"))
+		if _, ok, _ := m.Get(ctx, "a"); !ok {
+			t.Fatal("Get(a) missed before expiry")
+		}
+		time.Sleep(20 * time.Millisecond)
+		if _, ok, _ := m.Get(ctx, "a"); ok {
+			t.Error("Get(a) hit after expiry")
+		}
+	})
+}
+
+func TestDir(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache")
+
+	d, err := respcache.NewDir(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDir() error = %v", err)
+	}
+
+	if _, ok, err := d.Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("Get(missing) = %v, %v, want miss", ok, err)
+	}
+	if err := d.Set(ctx, "a", []byte(`{"id":"1"}`)); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// A second cache on the same directory sees the entry
+	d2, _ := respcache.NewDir(path, time.Hour)
+	value, ok, err := d2.Get(ctx, "a")
+	if err != nil || !ok || string(value) != `{"id":"1"}` {
+		t.Errorf("Get(a) = %q, %v, %v", value, ok, err)
+	}
+
+	// Entries older than the TTL are misses
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(path, "a.json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := d.Get(ctx, "a"); ok {
+		t.Error("Get(a) hit after expiry")
+	}
+}
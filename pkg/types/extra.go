@@ -0,0 +1,324 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// knownFieldsCache maps struct types to the JSON field names they model
+var knownFieldsCache sync.Map
+
+// knownFields returns the index of each field of the struct type t by its
+// JSON name
+func knownFields(t reflect.Type) map[string]int {
+	if cached, ok := knownFieldsCache.Load(t); ok {
+		return cached.(map[string]int)
+	}
+
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if n, _, _ := strings.Cut(tag, ","); n != "" {
+				name = n
+			}
+		}
+		fields[name] = i
+	}
+
+	knownFieldsCache.Store(t, fields)
+	return fields
+}
+
+// unmarshalWithExtra decodes data into v, a pointer to a struct without a
+// custom UnmarshalJSON, and returns the object fields that v does not model.
+// The object is split into its fields once; each known field is then decoded
+// into its struct field.
+func unmarshalWithExtra(data []byte, v any) (map[string]json.RawMessage, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	elem := reflect.ValueOf(v).Elem()
+	known := knownFields(elem.Type())
+	var extra map[string]json.RawMessage
+	for key, value := range raw {
+		i, ok := known[key]
+		if !ok {
+			if extra == nil {
+				extra = make(map[string]json.RawMessage)
+			}
+			extra[key] = value
+			continue
+		}
+		if err := json.Unmarshal(value, elem.Field(i).Addr().Interface()); err != nil {
+			return nil, fmt.Errorf("decoding field %q: %w", key, err)
+		}
+	}
+	return extra, nil
+}
+
+// marshalWithExtra encodes v, a struct without a custom MarshalJSON, and adds
+// the extra fields to the resulting object. Fields already present in v take
+// precedence over extra fields of the same name.
+func marshalWithExtra(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	return mergeFields(data, extra, false)
+}
+
+// mergeFields adds extra to the JSON object in data, keeping the order of
+// its fields and appending new ones sorted by name. When override is set,
+// extra fields replace existing fields of the same name in place.
+func mergeFields(data []byte, extra map[string]json.RawMessage, override bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("merging fields: not a JSON object")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeField := func(key string, value json.RawMessage) error {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		return json.Compact(&buf, value)
+	}
+
+	seen := make(map[string]bool)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if replacement, ok := extra[key]; ok && override {
+			value = replacement
+		}
+		seen[key] = true
+		if err := writeField(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := writeField(key, extra[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// rawFields encodes each value of m as JSON
+func rawFields(m map[string]any) (map[string]json.RawMessage, error) {
+	raw := make(map[string]json.RawMessage, len(m))
+	for key, value := range m {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		raw[key] = bytes.TrimSpace(data)
+	}
+	return raw, nil
+}
+
+// The aliases below have the same fields as their originals but none of the
+// JSON methods, so they can be encoded with the default behaviour.
+type (
+	messageAlias                    Message
+	choiceAlias                     Choice
+	usageAlias                      Usage
+	chatCompletionRequestAlias      ChatCompletionRequest
+	chatCompletionResponseAlias     ChatCompletionResponse
+	chatCompletionStreamAlias       ChatCompletionStream
+	chatCompletionStreamChoiceAlias ChatCompletionStreamChoice
+	chatCompletionStreamDeltaAlias  ChatCompletionStreamDelta
+)
+
+// MarshalJSON implements json.Marshaler, including ExtraFields
+func (m Message) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(messageAlias(m), m.ExtraFields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraFields
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var alias messageAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*m = Message(alias)
+	m.ExtraFields = extra
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, including ExtraFields
+func (c Choice) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(choiceAlias(c), c.ExtraFields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraFields
+func (c *Choice) UnmarshalJSON(data []byte) error {
+	var alias choiceAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*c = Choice(alias)
+	c.ExtraFields = extra
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, including ExtraFields
+func (u Usage) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(usageAlias(u), u.ExtraFields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraFields
+func (u *Usage) UnmarshalJSON(data []byte) error {
+	var alias usageAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*u = Usage(alias)
+	u.ExtraFields = extra
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. ExtraBody fields are merged into
+// the top-level object and take precedence over modelled fields.
+func (r ChatCompletionRequest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(chatCompletionRequestAlias(r))
+	if err != nil || len(r.ExtraBody) == 0 {
+		return data, err
+	}
+	extra, err := rawFields(r.ExtraBody)
+	if err != nil {
+		return nil, err
+	}
+	return mergeFields(data, extra, true)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraBody
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	var alias chatCompletionRequestAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*r = ChatCompletionRequest(alias)
+	r.ExtraBody = nil
+	for key, raw := range extra {
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if r.ExtraBody == nil {
+			r.ExtraBody = make(map[string]any, len(extra))
+		}
+		r.ExtraBody[key] = value
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, including ExtraFields
+func (r ChatCompletionResponse) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(chatCompletionResponseAlias(r), r.ExtraFields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraFields
+func (r *ChatCompletionResponse) UnmarshalJSON(data []byte) error {
+	var alias chatCompletionResponseAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*r = ChatCompletionResponse(alias)
+	r.ExtraFields = extra
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, including ExtraFields
+func (s ChatCompletionStream) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(chatCompletionStreamAlias(s), s.ExtraFields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraFields
+func (s *ChatCompletionStream) UnmarshalJSON(data []byte) error {
+	var alias chatCompletionStreamAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*s = ChatCompletionStream(alias)
+	s.ExtraFields = extra
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, including ExtraFields
+func (c ChatCompletionStreamChoice) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(chatCompletionStreamChoiceAlias(c), c.ExtraFields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraFields
+func (c *ChatCompletionStreamChoice) UnmarshalJSON(data []byte) error {
+	var alias chatCompletionStreamChoiceAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*c = ChatCompletionStreamChoice(alias)
+	c.ExtraFields = extra
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, including ExtraFields
+func (d ChatCompletionStreamDelta) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(chatCompletionStreamDeltaAlias(d), d.ExtraFields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unknown fields in ExtraFields
+func (d *ChatCompletionStreamDelta) UnmarshalJSON(data []byte) error {
+	var alias chatCompletionStreamDeltaAlias
+	extra, err := unmarshalWithExtra(data, &alias)
+	if err != nil {
+		return err
+	}
+	*d = ChatCompletionStreamDelta(alias)
+	d.ExtraFields = extra
+	return nil
+}
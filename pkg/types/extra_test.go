@@ -0,0 +1,169 @@
+package types_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+)
+
+func TestChatCompletionRequest_ExtraBody(t *testing.T) {
+	temp := 0.3
+	req := types.ChatCompletionRequest{
+		Model:       "kimi-k2",
+		Messages:    []types.Message{{Role: "user", Content: "Hi"}},
+		Temperature: &temp,
+		ExtraBody: map[string]any{
+			"thinking":    map[string]string{"type": "enabled"},
+			"temperature": 1,
+		},
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if fields["model"] != "kimi-k2" {
+		t.Errorf("model = %v, want kimi-k2", fields["model"])
+	}
+	if _, ok := fields["thinking"].(map[string]any); !ok {
+		t.Errorf("thinking = %v, want object", fields["thinking"])
+	}
+	if fields["temperature"] != float64(1) {
+		t.Errorf("temperature = %v, want ExtraBody value 1", fields["temperature"])
+	}
+
+	var decoded types.ChatCompletionRequest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.Model != "kimi-k2" || len(decoded.Messages) != 1 {
+		t.Errorf("decoded = %+v, want model and messages", decoded)
+	}
+	if _, ok := decoded.ExtraBody["thinking"]; !ok {
+		t.Errorf("ExtraBody = %v, want thinking", decoded.ExtraBody)
+	}
+	if _, ok := decoded.ExtraBody["model"]; ok {
+		t.Error("ExtraBody contains modelled field model")
+	}
+}
+
+func TestChatCompletionResponse_ExtraFields(t *testing.T) {
+	data := []byte(`{
+		"id": "chatcmpl-1",
+		"model": "kimi-k2",
+		"service_tier": "default",
+		"choices": [{
+			"index": 0,
+			"message": {"role": "assistant", "content": "Hi", "annotations": [1, 2]},
+			"finish_reason": "stop"
+		}],
+		"usage": {"prompt_tokens": 1, "completion_tokens": 2, "total_tokens": 3, "future_tokens": 1}
+	}`)
+
+	var resp types.ChatCompletionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if resp.ID != "chatcmpl-1" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("known fields not decoded: %+v", resp)
+	}
+	if string(resp.ExtraFields["service_tier"]) != `"default"` {
+		t.Errorf("ExtraFields[service_tier] = %s", resp.ExtraFields["service_tier"])
+	}
+	if _, ok := resp.ExtraFields["id"]; ok {
+		t.Error("ExtraFields contains modelled field id")
+	}
+	if string(resp.Choices[0].Message.ExtraFields["annotations"]) != `[1, 2]` {
+		t.Errorf("Message.ExtraFields[annotations] = %s", resp.Choices[0].Message.ExtraFields["annotations"])
+	}
+	if string(resp.Usage.ExtraFields["future_tokens"]) != `1` {
+		t.Errorf("Usage.ExtraFields[future_tokens] = %s", resp.Usage.ExtraFields["future_tokens"])
+	}
+
+	// Unknown fields survive a round trip
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var again types.ChatCompletionResponse
+	if err := json.Unmarshal(encoded, &again); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if string(again.ExtraFields["service_tier"]) != `"default"` {
+		t.Errorf("round trip lost service_tier: %s", encoded)
+	}
+	if _, ok := again.Choices[0].Message.ExtraFields["annotations"]; !ok {
+		t.Errorf("round trip lost message annotations: %s", encoded)
+	}
+}
+
+func TestChatCompletionStream_ExtraFields(t *testing.T) {
+	data := []byte(`{"id":"1","choices":[{"index":0,"delta":{"content":"a","future_field":"x"},"finish_reason":null}],"trace":"t"}`)
+
+	var chunk types.ChatCompletionStream
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if string(chunk.ExtraFields["trace"]) != `"t"` {
+		t.Errorf("ExtraFields[trace] = %s", chunk.ExtraFields["trace"])
+	}
+	delta := chunk.Choices[0].Delta
+	if delta.Content == nil || *delta.Content != "a" {
+		t.Errorf("Delta.Content = %v, want a", delta.Content)
+	}
+	if string(delta.ExtraFields["future_field"]) != `"x"` {
+		t.Errorf("Delta.ExtraFields[future_field] = %s", delta.ExtraFields["future_field"])
+	}
+}
+
+func TestMessage_MarshalExtraFields(t *testing.T) {
+	msg := types.Message{
+		Role:        "assistant",
+		Content:     "Hi",
+		ExtraFields: map[string]json.RawMessage{"role": json.RawMessage(`"system"`), "custom": json.RawMessage(`true`)},
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if fields["role"] != "assistant" {
+		t.Errorf("role = %v, want modelled value to win", fields["role"])
+	}
+	if fields["custom"] != true {
+		t.Errorf("custom = %v, want true", fields["custom"])
+	}
+}
+
+func TestChatCompletionRequest_ExtraBodyKeepsFieldOrder(t *testing.T) {
+	maxTokens := 10
+	req := types.ChatCompletionRequest{
+		Model:     "kimi-k2",
+		Messages:  []types.Message{{Role: "user", Content: "Hi"}},
+		MaxTokens: &maxTokens,
+		ExtraBody: map[string]any{"z_param": 1, "a_param": 2, "model": "override"},
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `{"model":"override","messages":[{"role":"user","content":"Hi"}],"max_tokens":10,"a_param":2,"z_param":1}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"encoding/json"
 	"io"
+	"strings"
 )
 
 // Message represents a message in a chat conversation
@@ -12,6 +13,18 @@ type Message struct {
 	Name       *string     `json:"name,omitempty"`
 	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
 	ToolCallID *string     `json:"tool_call_id,omitempty"`
+	
+	// ReasoningContent is the chain of thought produced by thinking models,
+	// returned separately from Content
+	ReasoningContent *string `json:"reasoning_content,omitempty"`
+	
+	// Partial marks a final assistant message as a prefix for the model to
+	// continue ("partial mode")
+	Partial bool `json:"partial,omitempty"`
+	
+	// ExtraFields holds fields the SDK does not model. They are kept when
+	// decoding and written back when encoding.
+	ExtraFields map[string]json.RawMessage `json:"-"`
 }
 
 // ContentPart represents a part of a message content (for multimodal)
@@ -27,26 +40,76 @@ type ImageURL struct {
 	Detail *string `json:"detail,omitempty"`
 }
 
+// Tool types
+const (
+	ToolTypeFunction        = "function"
+	ToolTypeBuiltinFunction = "builtin_function"
+)
+
+// Builtin functions executed by the Moonshot API
+const (
+	BuiltinWebSearch = "$web_search"
+)
+
 // Tool represents a tool/function that can be called
 type Tool struct {
 	Type     string   `json:"type"`
 	Function Function `json:"function"`
 }
 
-// Function represents a function definition
+// Function represents a function definition. Builtin functions only need a
+// name.
 type Function struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
 }
 
+// MarshalJSON implements json.Marshaler. Builtin functions are sent with
+// only their name, as the API defines the rest.
+func (t Tool) MarshalJSON() ([]byte, error) {
+	if t.Type == ToolTypeBuiltinFunction {
+		type builtinFunction struct {
+			Name string `json:"name"`
+		}
+		return json.Marshal(struct {
+			Type     string          `json:"type"`
+			Function builtinFunction `json:"function"`
+		}{t.Type, builtinFunction{t.Function.Name}})
+	}
+	type tool Tool
+	return json.Marshal(tool(t))
+}
+
+// BuiltinTool returns the definition of a builtin function such as
+// BuiltinWebSearch
+func BuiltinTool(name string) Tool {
+	return Tool{
+		Type:     ToolTypeBuiltinFunction,
+		Function: Function{Name: name},
+	}
+}
+
+// WebSearchTool returns the definition of the builtin $web_search tool
+func WebSearchTool() Tool {
+	return BuiltinTool(BuiltinWebSearch)
+}
+
 // ToolCall represents a tool call in a message
 type ToolCall struct {
+	// Index identifies the tool call across streamed deltas
+	Index    *int         `json:"index,omitempty"`
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
 }
 
+// IsBuiltin reports whether the call is to a builtin function executed by
+// the API rather than by the client
+func (tc ToolCall) IsBuiltin() bool {
+	return tc.Type == ToolTypeBuiltinFunction || strings.HasPrefix(tc.Function.Name, "$")
+}
+
 // FunctionCall represents a function call
 type FunctionCall struct {
 	Name      string `json:"name"`
@@ -63,6 +126,39 @@ type Usage struct {
 	TotalTokens        int     `json:"total_tokens"`
 	PromptCacheHitRate float64 `json:"prompt_cache_hit_rate,omitempty"`
 	PromptCacheMissRate float64 `json:"prompt_cache_miss_rate,omitempty"`
+	// CachedTokens is the number of prompt tokens served from a context cache
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+	
+	// ExtraFields holds usage fields the SDK does not model
+	ExtraFields map[string]json.RawMessage `json:"-"`
+}
+
+// CompletionTokensDetails breaks down completion token usage
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
+// ReasoningTokens returns the number of completion tokens spent on reasoning,
+// or 0 if the API did not report it
+func (u Usage) ReasoningTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
+}
+
+// CacheHitRate returns the fraction of prompt tokens served from a context
+// cache, preferring the rate reported by the API
+func (u Usage) CacheHitRate() float64 {
+	if u.PromptCacheHitRate > 0 {
+		return u.PromptCacheHitRate
+	}
+	if u.PromptTokens == 0 {
+		return 0
+	}
+	return float64(u.CachedTokens) / float64(u.PromptTokens)
 }
 
 // Choice represents a completion choice
@@ -71,6 +167,9 @@ type Choice struct {
 	Message      Message  `json:"message"`
 	FinishReason string   `json:"finish_reason"`
 	LogProbs     *json.RawMessage `json:"logprobs,omitempty"`
+	
+	// ExtraFields holds choice fields the SDK does not model
+	ExtraFields map[string]json.RawMessage `json:"-"`
 }
 
 // ChatCompletionRequest represents a request to the chat completion API
@@ -98,6 +197,11 @@ type ChatCompletionRequest struct {
 	
 	// File references
 	FileIDs []string `json:"file_ids,omitempty"`
+	
+	// ExtraBody is merged into the top-level request object, for API
+	// parameters the SDK does not model yet. Its fields take precedence over
+	// the modelled fields above.
+	ExtraBody map[string]any `json:"-"`
 }
 
 // ChatCompletionResponse represents a response from the chat completion API
@@ -109,6 +213,9 @@ type ChatCompletionResponse struct {
 	Choices           []Choice  `json:"choices"`
 	Usage             Usage     `json:"usage"`
 	SystemFingerprint string    `json:"system_fingerprint,omitempty"`
+	
+	// ExtraFields holds response fields the SDK does not model
+	ExtraFields map[string]json.RawMessage `json:"-"`
 }
 
 // ChatCompletionStream represents a streaming response chunk
@@ -120,6 +227,9 @@ type ChatCompletionStream struct {
 	Choices           []ChatCompletionStreamChoice `json:"choices"`
 	SystemFingerprint string                       `json:"system_fingerprint,omitempty"`
 	Usage             *Usage                       `json:"usage,omitempty"`
+	
+	// ExtraFields holds chunk fields the SDK does not model
+	ExtraFields map[string]json.RawMessage `json:"-"`
 }
 
 // ChatCompletionStreamChoice represents a choice in a streaming response
@@ -128,6 +238,11 @@ type ChatCompletionStreamChoice struct {
 	Delta        ChatCompletionStreamDelta `json:"delta"`
 	FinishReason *string                   `json:"finish_reason"`
 	LogProbs     *json.RawMessage          `json:"logprobs,omitempty"`
+	// Usage is sent on the final chunk of a choice by the Moonshot API
+	Usage *Usage `json:"usage,omitempty"`
+	
+	// ExtraFields holds choice fields the SDK does not model
+	ExtraFields map[string]json.RawMessage `json:"-"`
 }
 
 // ChatCompletionStreamDelta represents the delta in a streaming response
@@ -135,6 +250,12 @@ type ChatCompletionStreamDelta struct {
 	Role      *string    `json:"role,omitempty"`
 	Content   *string    `json:"content,omitempty"`
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	
+	// ReasoningContent carries the chain of thought of thinking models
+	ReasoningContent *string `json:"reasoning_content,omitempty"`
+	
+	// ExtraFields holds delta fields the SDK does not model
+	ExtraFields map[string]json.RawMessage `json:"-"`
 }
 
 // File represents a file in the Moonshot API
@@ -166,6 +287,20 @@ type FileListResponse struct {
 	Object string `json:"object"`
 }
 
+// ModelInfo represents a model available to the account
+type ModelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ModelListResponse represents a response from listing models
+type ModelListResponse struct {
+	Data   []ModelInfo `json:"data"`
+	Object string      `json:"object"`
+}
+
 // TokenCountRequest represents a request to count tokens
 type TokenCountRequest struct {
 	Model    string    `json:"model"`
@@ -175,4 +310,140 @@ type TokenCountRequest struct {
 // TokenCountResponse represents a response from token counting
 type TokenCountResponse struct {
 	TokenCount int `json:"token_count"`
-}
\ No newline at end of file
+}
+
+// PartialMessage returns an assistant message in partial mode, which the
+// model continues from prefix. It must be the last message of a request.
+func PartialMessage(prefix string) Message {
+	return Message{
+		Role:    "assistant",
+		Content: prefix,
+		Partial: true,
+	}
+}
+
+// PartialPrefix returns the content of the request's final message if it is
+// an assistant message in partial mode, and "" otherwise
+func (r ChatCompletionRequest) PartialPrefix() string {
+	if len(r.Messages) == 0 {
+		return ""
+	}
+	last := r.Messages[len(r.Messages)-1]
+	if last.Role != "assistant" || !last.Partial {
+		return ""
+	}
+	prefix, _ := last.Content.(string)
+	return prefix
+}
+
+// WithoutReasoning returns a copy of the message with ReasoningContent removed
+func (m Message) WithoutReasoning() Message {
+	m.ReasoningContent = nil
+	return m
+}
+
+// StripReasoning returns messages with the reasoning content of completed
+// assistant turns removed. Reasoning on assistant messages after the last
+// user message is kept, since thinking models expect it while they are
+// still working through tool calls for the current turn. The input slice is
+// not modified.
+func StripReasoning(messages []Message) []Message {
+	lastUser := -1
+	for i, m := range messages {
+		if m.Role == "user" {
+			lastUser = i
+		}
+	}
+	
+	var out []Message
+	for i := 0; i < lastUser; i++ {
+		if messages[i].ReasoningContent == nil {
+			continue
+		}
+		if out == nil {
+			out = make([]Message, len(messages))
+			copy(out, messages)
+		}
+		out[i] = messages[i].WithoutReasoning()
+	}
+	if out == nil {
+		return messages
+	}
+	return out
+}
+
+// Context cache statuses
+const (
+	ContextCacheStatusPending  = "pending"
+	ContextCacheStatusReady    = "ready"
+	ContextCacheStatusError    = "error"
+	ContextCacheStatusInactive = "inactive"
+)
+
+// ContextCache represents a context cache in the Moonshot API
+type ContextCache struct {
+	ID          string            `json:"id"`
+	Object      string            `json:"object"`
+	Status      string            `json:"status"`
+	Model       string            `json:"model"`
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Messages    []Message         `json:"messages,omitempty"`
+	Tools       []Tool            `json:"tools,omitempty"`
+	Tokens      int               `json:"tokens"`
+	CreatedAt   int64             `json:"created_at"`
+	ExpiredAt   int64             `json:"expired_at"`
+	Error       *string           `json:"error,omitempty"`
+}
+
+// ContextCacheCreateRequest represents a request to create a context cache.
+// Set either TTL or ExpiredAt to bound its lifetime.
+type ContextCacheCreateRequest struct {
+	Model       string            `json:"model"`
+	Messages    []Message         `json:"messages"`
+	Tools       []Tool            `json:"tools,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// TTL is the lifetime in seconds, renewed each time the cache is used
+	TTL       *int   `json:"ttl,omitempty"`
+	ExpiredAt *int64 `json:"expired_at,omitempty"`
+}
+
+// ContextCacheUpdateRequest represents a request to update a context cache
+type ContextCacheUpdateRequest struct {
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	TTL       *int              `json:"ttl,omitempty"`
+	ExpiredAt *int64            `json:"expired_at,omitempty"`
+}
+
+// ContextCacheListParams represents parameters for listing context caches
+type ContextCacheListParams struct {
+	Limit    int               `json:"limit,omitempty"`
+	Order    string            `json:"order,omitempty"`
+	After    string            `json:"after,omitempty"`
+	Before   string            `json:"before,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ContextCacheListResponse represents a response from listing context caches
+type ContextCacheListResponse struct {
+	Data   []ContextCache `json:"data"`
+	Object string         `json:"object"`
+}
+
+// Balance represents the account balance
+type Balance struct {
+	AvailableBalance float64 `json:"available_balance"`
+	VoucherBalance   float64 `json:"voucher_balance"`
+	CashBalance      float64 `json:"cash_balance"`
+}
+
+// BalanceResponse represents a response from the balance endpoint
+type BalanceResponse struct {
+	Code   int     `json:"code"`
+	Data   Balance `json:"data"`
+	SCode  string  `json:"scode"`
+	Status bool    `json:"status"`
+}
@@ -0,0 +1,102 @@
+package types_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rizome-dev/go-moonshot/pkg/types"
+	"github.com/rizome-dev/go-moonshot/pkg/utils"
+)
+
+func TestUsage_CacheHitRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage types.Usage
+		want  float64
+	}{
+		{name: "reported rate", usage: types.Usage{PromptTokens: 100, CachedTokens: 10, PromptCacheHitRate: 0.5}, want: 0.5},
+		{name: "from cached tokens", usage: types.Usage{PromptTokens: 100, CachedTokens: 80}, want: 0.8},
+		{name: "no prompt tokens", usage: types.Usage{}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.usage.CacheHitRate(); got != tt.want {
+				t.Errorf("CacheHitRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripReasoning(t *testing.T) {
+	messages := []types.Message{
+		{Role: "user", Content: "First"},
+		{Role: "assistant", Content: "Answer", ReasoningContent: utils.String("old")},
+		{Role: "user", Content: "Second"},
+		{Role: "assistant", ReasoningContent: utils.String("current")},
+	}
+
+	got := types.StripReasoning(messages)
+
+	if got[1].ReasoningContent != nil {
+		t.Error("reasoning of completed turn was kept")
+	}
+	if utils.StringValue(got[3].ReasoningContent) != "current" {
+		t.Error("reasoning of current turn was stripped")
+	}
+	if messages[1].ReasoningContent == nil {
+		t.Error("input slice was modified")
+	}
+}
+
+func TestChatCompletionRequest_PartialPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []types.Message
+		want     string
+	}{
+		{name: "no messages", want: ""},
+		{name: "partial assistant", messages: []types.Message{{Role: "user", Content: "Hi"}, types.PartialMessage("{")}, want: "{"},
+		{name: "assistant not partial", messages: []types.Message{{Role: "assistant", Content: "{"}}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := types.ChatCompletionRequest{Messages: tt.messages}
+			if got := req.PartialPrefix(); got != tt.want {
+				t.Errorf("PartialPrefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTool_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		tool types.Tool
+		want string
+	}{
+		{
+			name: "builtin function",
+			tool: types.WebSearchTool(),
+			want: `{"type":"builtin_function","function":{"name":"$web_search"}}`,
+		},
+		{
+			name: "function",
+			tool: types.Tool{Type: types.ToolTypeFunction, Function: types.Function{Name: "lookup"}},
+			want: `{"type":"function","function":{"name":"lookup","description":"","parameters":null}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.tool)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}